@@ -35,6 +35,16 @@ func getEAReg(opcode uint16) int {
 	return int(opcode & 0x07)
 }
 
+// addressStep returns how far the (An)+ and -(An) modes move An for an
+// operand of the given size. Byte accesses through A7 step by 2 so that the
+// stack pointer stays word-aligned.
+func addressStep(reg, size int) uint32 {
+	if size == 8 && reg == 7 {
+		return 2
+	}
+	return uint32(size / 8)
+}
+
 // readEA reads a value using the specified effective address
 func (cpu *CPU) readEA(mode, reg, size int) uint32 {
 	switch mode {
@@ -50,19 +60,11 @@ func (cpu *CPU) readEA(mode, reg, size int) uint32 {
 	case 3: // (An)+ - Address register indirect with postincrement
 		addr := cpu.a[reg]
 		val := cpu.readMem(addr, size)
-		inc := uint32(size / 8)
-		if size == 8 && reg == 7 {
-			inc = 2 // SP always increments by 2
-		}
-		cpu.a[reg] += inc
+		cpu.a[reg] += addressStep(reg, size)
 		return val
 
 	case 4: // -(An) - Address register indirect with predecrement
-		dec := uint32(size / 8)
-		if size == 8 && reg == 7 {
-			dec = 2 // SP always decrements by 2
-		}
-		cpu.a[reg] -= dec
+		cpu.a[reg] -= addressStep(reg, size)
 		return cpu.readMem(cpu.a[reg], size)
 
 	case 5: // (d16,An) - Address register indirect with displacement
@@ -71,19 +73,7 @@ func (cpu *CPU) readEA(mode, reg, size int) uint32 {
 		return cpu.readMem(addr, size)
 
 	case 6: // (d8,An,Xn) - Address register indirect with index
-		ext := uint32(cpu.readImmediate16())
-		disp := signExtend8(ext & 0xFF)
-		xn := int((ext >> 12) & 0x0F)
-		var index uint32
-		if ext&0x8000 != 0 { // Address register
-			index = cpu.a[xn&7]
-		} else { // Data register
-			index = cpu.d[xn&7]
-		}
-		if ext&0x800 == 0 { // Word index
-			index = signExtend16(index)
-		}
-		addr := cpu.a[reg] + disp + index
+		addr := cpu.indexedAddress(cpu.a[reg])
 		return cpu.readMem(addr, size)
 
 	case 7: // Special modes based on register
@@ -96,28 +86,9 @@ func (cpu *CPU) readEA(mode, reg, size int) uint32 {
 			addr := cpu.readImmediate32()
 			return cpu.readMem(addr, size)
 
-		case 2: // (d16,PC) - PC with displacement
-			oldPC := cpu.pc
-			disp := signExtend16(uint32(cpu.readImmediate16()))
-			addr := oldPC + disp
-			return cpu.readMem(addr, size)
-
-		case 3: // (d8,PC,Xn) - PC with index
-			oldPC := cpu.pc
-			ext := uint32(cpu.readImmediate16())
-			disp := signExtend8(ext & 0xFF)
-			xn := int((ext >> 12) & 0x0F)
-			var index uint32
-			if ext&0x8000 != 0 { // Address register
-				index = cpu.a[xn&7]
-			} else { // Data register
-				index = cpu.d[xn&7]
-			}
-			if ext&0x800 == 0 { // Word index
-				index = signExtend16(index)
-			}
-			addr := oldPC + disp + index
-			return cpu.readMem(addr, size)
+		case 2, 3: // (d16,PC), (d8,PC,Xn) - PC relative
+			addr := cpu.calcEA(mode, reg, size)
+			return cpu.readMemFC(addr, size, cpu.programFC())
 
 		case 4: // #<data> - Immediate
 			switch size {
@@ -158,18 +129,10 @@ func (cpu *CPU) writeEA(mode, reg, size int, value uint32) {
 	case 3: // (An)+ - Address register indirect with postincrement
 		addr := cpu.a[reg]
 		cpu.writeMem(addr, value, size)
-		inc := uint32(size / 8)
-		if size == 8 && reg == 7 {
-			inc = 2
-		}
-		cpu.a[reg] += inc
+		cpu.a[reg] += addressStep(reg, size)
 
 	case 4: // -(An) - Address register indirect with predecrement
-		dec := uint32(size / 8)
-		if size == 8 && reg == 7 {
-			dec = 2
-		}
-		cpu.a[reg] -= dec
+		cpu.a[reg] -= addressStep(reg, size)
 		cpu.writeMem(cpu.a[reg], value, size)
 
 	case 5: // (d16,An) - Address register indirect with displacement
@@ -178,19 +141,7 @@ func (cpu *CPU) writeEA(mode, reg, size int, value uint32) {
 		cpu.writeMem(addr, value, size)
 
 	case 6: // (d8,An,Xn) - Address register indirect with index
-		ext := uint32(cpu.readImmediate16())
-		disp := signExtend8(ext & 0xFF)
-		xn := int((ext >> 12) & 0x0F)
-		var index uint32
-		if ext&0x8000 != 0 {
-			index = cpu.a[xn&7]
-		} else {
-			index = cpu.d[xn&7]
-		}
-		if ext&0x800 == 0 {
-			index = signExtend16(index)
-		}
-		addr := cpu.a[reg] + disp + index
+		addr := cpu.indexedAddress(cpu.a[reg])
 		cpu.writeMem(addr, value, size)
 
 	case 7: // Special modes
@@ -206,27 +157,285 @@ func (cpu *CPU) writeEA(mode, reg, size int, value uint32) {
 	}
 }
 
-// readMem reads from memory with the specified size
+// readEAModify reads the operand of a read-modify-write instruction and
+// returns it along with its address. The effective address is resolved
+// only once, so extension words are consumed and (An)+/-(An) adjusted a
+// single time; pass the address back to writeEAModify to store the result.
+func (cpu *CPU) readEAModify(mode, reg, size int) (value, addr uint32) {
+	if mode <= 1 {
+		return cpu.readEA(mode, reg, size), 0
+	}
+	addr = cpu.calcEA(mode, reg, size)
+	return cpu.readMem(addr, size), addr
+}
+
+// writeEAModify writes the result of a read-modify-write instruction to the
+// operand previously read with readEAModify
+func (cpu *CPU) writeEAModify(mode, reg, size int, addr, value uint32) {
+	if mode <= 1 {
+		cpu.writeEA(mode, reg, size, value)
+		return
+	}
+	cpu.writeMem(addr, maskValue(value, size), size)
+}
+
+// controlMode reports whether an effective address is a control addressing
+// mode, the memory modes without side effects that JMP, JSR, LEA and PEA
+// accept: (An), (d16,An), (d8,An,Xn), absolute and PC-relative
+func controlMode(mode, reg int) bool {
+	switch mode {
+	case 2, 5, 6:
+		return true
+	case 7:
+		return reg <= 3
+	}
+	return false
+}
+
+// CalcEA computes the address of a memory operand for an instruction
+// being executed, e.g. to find the target of a jump in a tool or hook. It
+// has the side effects of the real calculation: extension words are read
+// from the instruction stream at PC, which advances past them, and the
+// (An)+ and -(An) modes update An. Register modes (0 and 1) and immediate
+// data have no address and return 0.
+func (cpu *CPU) CalcEA(mode, reg, size int) uint32 {
+	return cpu.calcEA(mode, reg, size)
+}
+
+// calcEA computes the address of a memory operand without accessing the
+// operand itself. Extension words are consumed from the instruction stream
+// and the (An)+ and -(An) modes update the address register by the operand
+// size (see addressStep).
+func (cpu *CPU) calcEA(mode, reg, size int) uint32 {
+	switch mode {
+	case 2: // (An)
+		return cpu.a[reg]
+	case 3: // (An)+
+		addr := cpu.a[reg]
+		cpu.a[reg] += addressStep(reg, size)
+		return addr
+	case 4: // -(An)
+		cpu.a[reg] -= addressStep(reg, size)
+		return cpu.a[reg]
+	case 5: // (d16,An)
+		disp := signExtend16(uint32(cpu.readImmediate16()))
+		return cpu.a[reg] + disp
+	case 6: // (d8,An,Xn)
+		return cpu.indexedAddress(cpu.a[reg])
+	case 7:
+		switch reg {
+		case 0: // (xxx).W
+			return signExtend16(uint32(cpu.readImmediate16()))
+		case 1: // (xxx).L
+			return cpu.readImmediate32()
+		case 2: // (d16,PC)
+			// The PC-relative modes are anchored at the address of the
+			// extension word, which is where the PC points before reading
+			// it, not at the opcode
+			extAddr := cpu.pc
+			disp := signExtend16(uint32(cpu.readImmediate16()))
+			return extAddr + disp
+		case 3: // (d8,PC,Xn)
+			return cpu.indexedAddress(cpu.pc)
+		}
+	}
+	return 0
+}
+
+// indexedAddress computes the effective address for the indexed modes
+// (d8,An,Xn) and (d8,PC,Xn), reading the extension word from the
+// instruction stream. On 68020+ the index may be scaled, and a full-format
+// extension word (bit 8 set) adds base/index suppression, base and outer
+// displacements, and memory indirection.
+func (cpu *CPU) indexedAddress(base uint32) uint32 {
+	ext := uint32(cpu.readImmediate16())
+	xn := int((ext >> 12) & 0x0F)
+	var index uint32
+	if ext&0x8000 != 0 { // Address register
+		index = cpu.a[xn&7]
+	} else { // Data register
+		index = cpu.d[xn&7]
+	}
+	if ext&0x800 == 0 { // Word index
+		index = signExtend16(index)
+	}
+
+	if !cpu.is020Plus() {
+		return base + signExtend8(ext&0xFF) + index
+	}
+
+	// Scale factor (x1, x2, x4, x8)
+	index <<= (ext >> 9) & 0x03
+
+	if ext&0x0100 == 0 { // Brief format
+		return base + signExtend8(ext&0xFF) + index
+	}
+
+	// Full format
+	if ext&0x0080 != 0 { // Base suppress
+		base = 0
+	}
+	if ext&0x0040 != 0 { // Index suppress
+		index = 0
+	}
+	base += cpu.readExtDisplacement((ext >> 4) & 0x03)
+
+	iis := ext & 0x07
+	if iis == 0 { // No memory indirection
+		return base + index
+	}
+
+	od := cpu.readExtDisplacement(iis & 0x03)
+	if iis&0x04 != 0 { // Postindexed
+		return cpu.readMem(base, 32) + index + od
+	}
+	// Preindexed
+	return cpu.readMem(base+index, 32) + od
+}
+
+// readExtDisplacement reads a base or outer displacement of a full-format
+// extension word. Size 0 (reserved) and 1 (null) yield zero.
+func (cpu *CPU) readExtDisplacement(size uint32) uint32 {
+	switch size {
+	case 2: // Word
+		return signExtend16(uint32(cpu.readImmediate16()))
+	case 3: // Long
+		return cpu.readImmediate32()
+	default:
+		return 0
+	}
+}
+
+// readMem reads data from memory with the specified size
 func (cpu *CPU) readMem(address uint32, size int) uint32 {
-	if cpu.memory == nil {
+	return cpu.readMemFC(address, size, cpu.dataFC())
+}
+
+// readMemFC reads from memory in the given function code address space
+func (cpu *CPU) readMemFC(address uint32, size int, fc uint8) uint32 {
+	if cpu.memory == nil || (size != 8 && size != 16 && size != 32) {
+		return 0
+	}
+
+	if cpu.misaligned(address, size, false) {
 		return 0
 	}
+	value := cpu.busRead(address, size, fc)
+	if cpu.watchpoints != nil {
+		cpu.checkWatchpoint(address, size, false, value)
+	}
+	return value
+}
+
+// writeMem writes data to memory with the specified size
+func (cpu *CPU) writeMem(address, value uint32, size int) {
+	cpu.writeMemFC(address, value, size, cpu.dataFC())
+}
+
+// writeMemFC writes to memory in the given function code address space
+func (cpu *CPU) writeMemFC(address, value uint32, size int, fc uint8) {
+	if cpu.memory == nil || (size != 8 && size != 16 && size != 32) {
+		return
+	}
+
+	if cpu.misaligned(address, size, true) {
+		return
+	}
+	cpu.busWrite(address, value, size, fc)
+	if cpu.watchpoints != nil {
+		cpu.checkWatchpoint(address, size, true, maskValue(value, size))
+	}
+}
+
+// misaligned reports whether a word or long data access is at an odd
+// address on a CPU that requires alignment, and if so takes an address error
+func (cpu *CPU) misaligned(address uint32, size int, write bool) bool {
+	if size == 8 || address&1 == 0 || cpu.is020Plus() {
+		return false
+	}
+	cpu.busFault(VectorAddressError, address, write)
+	return true
+}
+
+// scc68070LongPenalty is the extra cost of a 32-bit access on the SCC68070.
+// The instruction timings include 8 cycles for each long access; the
+// 68070's 16-bit external data bus doubles that.
+const scc68070LongPenalty = 8
+
+// busRead performs a read bus cycle, reporting the function code to the fc
+// callback and to the memory handler if it implements MemoryHandlerFC, and
+// charging any wait states. Addresses are translated by the MMU, if it is
+// enabled, and truncated to the address bus.
+func (cpu *CPU) busRead(address uint32, size int, fc uint8) uint32 {
+	cpu.busAddress, cpu.busWriting = address, false
+	if cpu.mmuEnabled() {
+		var ok bool
+		if address, ok = cpu.mmuTranslate(address, fc, false); !ok {
+			return 0
+		}
+	}
+	address &= cpu.addressMask
+	if cpu.fcCallback != nil {
+		cpu.fcCallback(fc)
+	}
+	if cpu.busTimingCallback != nil {
+		cpu.useCycles(cpu.busTimingCallback(address, size, false))
+	}
+	if size == 32 && cpu.cpuType == CPUSCC68070 {
+		cpu.useCycles(scc68070LongPenalty)
+	}
+	if cpu.memoryFC != nil {
+		switch size {
+		case 8:
+			return uint32(cpu.memoryFC.Read8FC(address, int(fc)))
+		case 16:
+			return uint32(cpu.memoryFC.Read16FC(address, int(fc)))
+		default:
+			return cpu.memoryFC.Read32FC(address, int(fc))
+		}
+	}
 
 	switch size {
 	case 8:
 		return uint32(cpu.memory.Read8(address))
 	case 16:
 		return uint32(cpu.memory.Read16(address))
-	case 32:
-		return cpu.memory.Read32(address)
 	default:
-		return 0
+		return cpu.memory.Read32(address)
 	}
 }
 
-// writeMem writes to memory with the specified size
-func (cpu *CPU) writeMem(address, value uint32, size int) {
-	if cpu.memory == nil {
+// busWrite performs a write bus cycle, reporting the function code to the fc
+// callback and to the memory handler if it implements MemoryHandlerFC, and
+// charging any wait states. Addresses are translated by the MMU, if it is
+// enabled, and truncated to the address bus.
+func (cpu *CPU) busWrite(address, value uint32, size int, fc uint8) {
+	cpu.busAddress, cpu.busWriting = address, true
+	if cpu.mmuEnabled() {
+		var ok bool
+		if address, ok = cpu.mmuTranslate(address, fc, true); !ok {
+			return
+		}
+	}
+	address &= cpu.addressMask
+	if cpu.fcCallback != nil {
+		cpu.fcCallback(fc)
+	}
+	if cpu.busTimingCallback != nil {
+		cpu.useCycles(cpu.busTimingCallback(address, size, true))
+	}
+	if size == 32 && cpu.cpuType == CPUSCC68070 {
+		cpu.useCycles(scc68070LongPenalty)
+	}
+	if cpu.memoryFC != nil {
+		switch size {
+		case 8:
+			cpu.memoryFC.Write8FC(address, uint8(value), int(fc))
+		case 16:
+			cpu.memoryFC.Write16FC(address, uint16(value), int(fc))
+		default:
+			cpu.memoryFC.Write32FC(address, value, int(fc))
+		}
 		return
 	}
 
@@ -235,19 +444,57 @@ func (cpu *CPU) writeMem(address, value uint32, size int) {
 		cpu.memory.Write8(address, uint8(value))
 	case 16:
 		cpu.memory.Write16(address, uint16(value))
-	case 32:
+	default:
 		cpu.memory.Write32(address, value)
 	}
 }
 
+// dataFC returns the function code for data accesses in the current mode
+func (cpu *CPU) dataFC() uint8 {
+	if cpu.sr&FlagS != 0 {
+		return FCSupervisorData
+	}
+	return FCUserData
+}
+
+// programFC returns the function code for program accesses in the current mode
+func (cpu *CPU) programFC() uint8 {
+	if cpu.sr&FlagS != 0 {
+		return FCSupervisorProg
+	}
+	return FCUserProgram
+}
+
+// fetchWord reads the next word of the instruction stream through the
+// prefetch queue. Like the 68000's IRC/IRD pair, the queue holds the two
+// words at the PC: each fetch takes the first of them and prefetches the
+// word after the second. After a change of flow the queue is refilled from
+// the new PC.
+func (cpu *CPU) fetchWord() uint16 {
+	if cpu.scratchActive {
+		return cpu.fetchScratch()
+	}
+	fc := cpu.programFC()
+	if !cpu.prefetchValid || cpu.prefetchAddr != cpu.pc {
+		cpu.prefetchAddr = cpu.pc
+		cpu.prefetchData = cpu.busRead(cpu.pc, 16, fc) << 16
+		cpu.prefetchData |= cpu.busRead(cpu.pc+2, 16, fc)
+		cpu.prefetchValid = true
+	}
+	value := uint16(cpu.prefetchData >> 16)
+	cpu.pc += 2
+
+	cpu.prefetchAddr = cpu.pc
+	cpu.prefetchData = cpu.prefetchData<<16 | cpu.busRead(cpu.pc+2, 16, fc)
+	return value
+}
+
 // readImmediate16 reads a 16-bit immediate value from the instruction stream
 func (cpu *CPU) readImmediate16() uint16 {
 	if cpu.memory == nil {
 		return 0
 	}
-	value := cpu.memory.Read16(cpu.pc)
-	cpu.pc += 2
-	return value
+	return cpu.fetchWord()
 }
 
 // readImmediate32 reads a 32-bit immediate value from the instruction stream
@@ -255,9 +502,8 @@ func (cpu *CPU) readImmediate32() uint32 {
 	if cpu.memory == nil {
 		return 0
 	}
-	value := cpu.memory.Read32(cpu.pc)
-	cpu.pc += 4
-	return value
+	hi := uint32(cpu.fetchWord())
+	return hi<<16 | uint32(cpu.fetchWord())
 }
 
 // getSize extracts size from opcode (bits 6-7)
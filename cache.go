@@ -0,0 +1,54 @@
+package musashi
+
+// cache.go - Cache control register semantics
+
+// CACR bits (68020/68030)
+const (
+	cacrEI  = 0x0001 // Enable instruction cache
+	cacrFI  = 0x0002 // Freeze instruction cache
+	cacrCEI = 0x0004 // Clear entry in instruction cache
+	cacrCI  = 0x0008 // Clear instruction cache
+	cacrED  = 0x0100 // Enable data cache (68030)
+	cacrCD  = 0x0800 // Clear data cache (68030)
+)
+
+// CACR bits (68040)
+const (
+	cacr040IE = 0x00008000 // Enable instruction cache
+	cacr040DE = 0x80000000 // Enable data cache
+)
+
+// cacrMask returns the CACR bits that hold state on this CPU type. The
+// clear bits act when written and always read as zero.
+func (cpu *CPU) cacrMask() uint32 {
+	switch cpu.cpuType {
+	case CPU68EC020, CPU68020:
+		return cacrEI | cacrFI
+	case CPU68EC030, CPU68030:
+		// EI, FI, IBE, ED, FD, DBE, WA
+		return 0x3313
+	case CPU68EC040, CPU68LC040, CPU68040:
+		return cacr040DE | cacr040IE
+	}
+	return 0
+}
+
+// setCACR writes the cache control register. The caches themselves are not
+// emulated, but clearing the instruction cache also discards the prefetch
+// queue so that self-modifying code which flushes correctly sees its writes.
+func (cpu *CPU) setCACR(value uint32) {
+	if cpu.cpuType <= CPU68030 && value&(cacrCI|cacrCEI) != 0 {
+		cpu.prefetchValid = false
+	}
+	cpu.cacr = value & cpu.cacrMask()
+}
+
+// CacheEnabled reports whether the instruction and data caches are enabled
+// by CACR. The 68020 has no data cache.
+func (cpu *CPU) CacheEnabled() (instr, data bool) {
+	switch cpu.cpuType {
+	case CPU68EC040, CPU68LC040, CPU68040:
+		return cpu.cacr&cacr040IE != 0, cpu.cacr&cacr040DE != 0
+	}
+	return cpu.cacr&cacrEI != 0, cpu.cacr&cacrED != 0
+}
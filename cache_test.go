@@ -0,0 +1,57 @@
+package musashi
+
+import "testing"
+
+// TestCacheControl tests that writing CACR toggles the reported cache state
+func TestCacheControl(t *testing.T) {
+	cpu := NewCPU(CPU68030)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// MOVEC D0,CACR = 0x4E7B 0x0002, three times
+	for pc := uint32(0x400); pc < 0x40C; pc += 4 {
+		memory.Write16(pc, 0x4E7B)
+		memory.Write16(pc+2, 0x0002)
+	}
+
+	cpu.Reset()
+	if instr, data := cpu.CacheEnabled(); instr || data {
+		t.Errorf("Expected caches disabled after reset, got %v, %v", instr, data)
+	}
+
+	// Enable both caches
+	cpu.d[0] = cacrEI | cacrED
+	cpu.Step()
+	if instr, data := cpu.CacheEnabled(); !instr || !data {
+		t.Errorf("Expected both caches enabled, got %v, %v", instr, data)
+	}
+
+	// Clear bits act once and read back as zero
+	cpu.d[0] = cacrEI | cacrFI | cacrCI | cacrED | cacrCD
+	cpu.Step()
+	if cpu.cacr != cacrEI|cacrFI|cacrED {
+		t.Errorf("Expected CACR = 0x%04X, got 0x%04X", cacrEI|cacrFI|cacrED, cpu.cacr)
+	}
+
+	// Disable the instruction cache only
+	cpu.d[0] = cacrED
+	cpu.Step()
+	if instr, data := cpu.CacheEnabled(); instr || !data {
+		t.Errorf("Expected only the data cache enabled, got %v, %v", instr, data)
+	}
+
+	// The 68020 has no data cache and the 68040 uses different bits
+	cpu.SetCPUType(CPU68020)
+	cpu.SetRegister(RegCACR, cacrEI|cacrED)
+	if instr, data := cpu.CacheEnabled(); !instr || data {
+		t.Errorf("Expected 68020 instruction cache only, got %v, %v", instr, data)
+	}
+	cpu.SetCPUType(CPU68040)
+	cpu.SetRegister(RegCACR, cacr040IE|cacr040DE)
+	if instr, data := cpu.CacheEnabled(); !instr || !data {
+		t.Errorf("Expected 68040 caches enabled, got %v, %v", instr, data)
+	}
+}
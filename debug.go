@@ -0,0 +1,316 @@
+package musashi
+
+// debug.go - Debugger support (breakpoints, watchpoints, tracing)
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// addrRange is an inclusive range of addresses
+type addrRange struct {
+	start, end uint32
+}
+
+// contains reports whether the address lies in the range
+func (r addrRange) contains(addr uint32) bool {
+	return addr >= r.start && addr <= r.end
+}
+
+// AddBreakpoint sets an execution breakpoint at the given address.
+// Execution stops before the instruction at that address is executed.
+func (cpu *CPU) AddBreakpoint(addr uint32) {
+	if cpu.breakpoints == nil {
+		cpu.breakpoints = make(map[uint32]struct{})
+	}
+	cpu.breakpoints[addr] = struct{}{}
+}
+
+// RemoveBreakpoint clears the execution breakpoint at the given address
+func (cpu *CPU) RemoveBreakpoint(addr uint32) {
+	delete(cpu.breakpoints, addr)
+}
+
+// AddBreakpointRange sets an execution breakpoint on every address from
+// start to end inclusive
+func (cpu *CPU) AddBreakpointRange(start, end uint32) {
+	if start > end {
+		start, end = end, start
+	}
+	cpu.breakRanges = append(cpu.breakRanges, addrRange{start, end})
+}
+
+// RemoveBreakpointRange clears a breakpoint range set with AddBreakpointRange
+func (cpu *CPU) RemoveBreakpointRange(start, end uint32) {
+	if start > end {
+		start, end = end, start
+	}
+	for i, r := range cpu.breakRanges {
+		if r.start == start && r.end == end {
+			cpu.breakRanges = append(cpu.breakRanges[:i], cpu.breakRanges[i+1:]...)
+			return
+		}
+	}
+}
+
+// ClearBreakpoints removes all execution breakpoints
+func (cpu *CPU) ClearBreakpoints() {
+	cpu.breakpoints = nil
+	cpu.breakRanges = nil
+}
+
+// SetBreakpointCallback sets a callback invoked with the PC when execution
+// stops at a breakpoint
+func (cpu *CPU) SetBreakpointCallback(callback func(pc uint32)) {
+	cpu.breakpointCallback = callback
+}
+
+// isBreakpoint reports whether an execution breakpoint covers the address
+func (cpu *CPU) isBreakpoint(addr uint32) bool {
+	if _, ok := cpu.breakpoints[addr]; ok {
+		return true
+	}
+	for _, r := range cpu.breakRanges {
+		if r.contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBreakpoint ends the timeslice if the next instruction is at a
+// breakpoint. The instruction the CPU last stopped at is let through once,
+// so that calling Execute again resumes past the breakpoint.
+func (cpu *CPU) checkBreakpoint() bool {
+	if cpu.breakpoints == nil && cpu.breakRanges == nil {
+		return false
+	}
+	if cpu.breakResume && cpu.pc == cpu.breakPC {
+		cpu.breakResume = false
+		return false
+	}
+	cpu.breakResume = false
+	if !cpu.isBreakpoint(cpu.pc) {
+		return false
+	}
+
+	cpu.breakPC = cpu.pc
+	cpu.breakResume = true
+	if cpu.breakpointCallback != nil {
+		cpu.breakpointCallback(cpu.pc)
+	}
+	cpu.endTimeslice(StopBreakpoint)
+	return true
+}
+
+// watchpoint is a watched address range
+type watchpoint struct {
+	addrRange
+	onRead  bool
+	onWrite bool
+}
+
+// AddWatchpoint watches reads and/or writes of the byte at the given address
+func (cpu *CPU) AddWatchpoint(addr uint32, onRead, onWrite bool) {
+	cpu.AddWatchpointRange(addr, addr, onRead, onWrite)
+}
+
+// AddWatchpointRange watches reads and/or writes of any byte from start to
+// end inclusive
+func (cpu *CPU) AddWatchpointRange(start, end uint32, onRead, onWrite bool) {
+	if start > end {
+		start, end = end, start
+	}
+	cpu.watchpoints = append(cpu.watchpoints, watchpoint{addrRange{start, end}, onRead, onWrite})
+	cpu.indexWatchpoints()
+}
+
+// RemoveWatchpoint clears a watchpoint set with AddWatchpoint
+func (cpu *CPU) RemoveWatchpoint(addr uint32) {
+	cpu.RemoveWatchpointRange(addr, addr)
+}
+
+// RemoveWatchpointRange clears a watchpoint set with AddWatchpointRange
+func (cpu *CPU) RemoveWatchpointRange(start, end uint32) {
+	if start > end {
+		start, end = end, start
+	}
+	for i, w := range cpu.watchpoints {
+		if w.start == start && w.end == end {
+			cpu.watchpoints = append(cpu.watchpoints[:i], cpu.watchpoints[i+1:]...)
+			cpu.indexWatchpoints()
+			return
+		}
+	}
+}
+
+// ClearWatchpoints removes all watchpoints
+func (cpu *CPU) ClearWatchpoints() {
+	cpu.watchpoints = nil
+	cpu.watchMaxEnd = nil
+}
+
+// SetWatchpointCallback sets a callback invoked on each access that touches
+// a watched address. value is the value read or written.
+func (cpu *CPU) SetWatchpointCallback(callback func(addr uint32, size int, isWrite bool, value uint32)) {
+	cpu.watchpointCallback = callback
+}
+
+// SetWatchpointBreak sets whether a watchpoint hit also ends the timeslice
+// once the accessing instruction completes
+func (cpu *CPU) SetWatchpointBreak(enable bool) {
+	cpu.watchBreak = enable
+}
+
+// indexWatchpoints sorts the watchpoints by start address and records the
+// running maximum end address, so that lookups can binary search and stop
+// scanning as soon as no earlier range can reach the address
+func (cpu *CPU) indexWatchpoints() {
+	sort.Slice(cpu.watchpoints, func(i, j int) bool {
+		return cpu.watchpoints[i].start < cpu.watchpoints[j].start
+	})
+	cpu.watchMaxEnd = cpu.watchMaxEnd[:0]
+	var maxEnd uint32
+	for i, w := range cpu.watchpoints {
+		if i == 0 || w.end > maxEnd {
+			maxEnd = w.end
+		}
+		cpu.watchMaxEnd = append(cpu.watchMaxEnd, maxEnd)
+	}
+}
+
+// checkWatchpoint fires the watchpoint callback if a data access of the
+// given size (in bits) touches a watched range
+func (cpu *CPU) checkWatchpoint(addr uint32, size int, isWrite bool, value uint32) {
+	last := addr + uint32(size/8) - 1
+	if last < addr {
+		last = 0xFFFFFFFF
+	}
+
+	// Ranges starting after the last byte accessed cannot match
+	i := sort.Search(len(cpu.watchpoints), func(i int) bool {
+		return cpu.watchpoints[i].start > last
+	}) - 1
+
+	for ; i >= 0 && cpu.watchMaxEnd[i] >= addr; i-- {
+		w := cpu.watchpoints[i]
+		if w.end < addr || (isWrite && !w.onWrite) || (!isWrite && !w.onRead) {
+			continue
+		}
+		if cpu.watchpointCallback != nil {
+			cpu.watchpointCallback(addr, size, isWrite, value)
+		}
+		if cpu.watchBreak {
+			cpu.endTimeslice(StopBreakpoint)
+		}
+		return
+	}
+}
+
+// PeekInstruction disassembles the instruction at the current PC without
+// executing it, returning its text and its size in bytes
+func (cpu *CPU) PeekInstruction() (text string, size int) {
+	return cpu.Disassemble(cpu.pc)
+}
+
+// Peek8, Peek16 and Peek32 read memory through the current handler as a
+// debug access: the address is masked like an emulated access, but no
+// watchpoints, function code or bus timing callbacks fire and no cycles are
+// charged. Handlers implementing DebugReader are read through it. Without a
+// memory handler they return 0.
+func (cpu *CPU) Peek8(addr uint32) uint8 {
+	if cpu.debugMem != nil {
+		return cpu.debugMem.DebugRead8(addr & cpu.addressMask)
+	}
+	if cpu.memory == nil {
+		return 0
+	}
+	return cpu.memory.Read8(addr & cpu.addressMask)
+}
+
+// Peek16 reads a word as a debug access (see Peek8)
+func (cpu *CPU) Peek16(addr uint32) uint16 {
+	if cpu.debugMem != nil {
+		return cpu.debugMem.DebugRead16(addr & cpu.addressMask)
+	}
+	if cpu.memory == nil {
+		return 0
+	}
+	return cpu.memory.Read16(addr & cpu.addressMask)
+}
+
+// Peek32 reads a long word as a debug access (see Peek8)
+func (cpu *CPU) Peek32(addr uint32) uint32 {
+	if cpu.debugMem != nil {
+		return cpu.debugMem.DebugRead32(addr & cpu.addressMask)
+	}
+	if cpu.memory == nil {
+		return 0
+	}
+	return cpu.memory.Read32(addr & cpu.addressMask)
+}
+
+// Poke8, Poke16 and Poke32 write memory through the current handler as a
+// debug access, e.g. for test setup or a debugger's memory editor. Like
+// Peek8 they bypass watchpoints and callbacks. A poke into the words held
+// in the prefetch queue discards it, so that patched code is seen. Without
+// a memory handler they do nothing.
+func (cpu *CPU) Poke8(addr uint32, value uint8) {
+	if cpu.memory != nil {
+		cpu.memory.Write8(addr&cpu.addressMask, value)
+	}
+	cpu.pokePrefetch(addr, 1)
+}
+
+// Poke16 writes a word as a debug access (see Poke8)
+func (cpu *CPU) Poke16(addr uint32, value uint16) {
+	if cpu.memory != nil {
+		cpu.memory.Write16(addr&cpu.addressMask, value)
+	}
+	cpu.pokePrefetch(addr, 2)
+}
+
+// Poke32 writes a long word as a debug access (see Poke8)
+func (cpu *CPU) Poke32(addr uint32, value uint32) {
+	if cpu.memory != nil {
+		cpu.memory.Write32(addr&cpu.addressMask, value)
+	}
+	cpu.pokePrefetch(addr, 4)
+}
+
+// pokePrefetch discards the prefetch queue if a debug write of size bytes at
+// addr overlaps the words it holds
+func (cpu *CPU) pokePrefetch(addr uint32, size uint32) {
+	offset := (addr - cpu.prefetchAddr) & cpu.addressMask
+	if offset < 4 || offset > cpu.addressMask-size+1 {
+		cpu.prefetchValid = false
+	}
+}
+
+// SetTraceWriter sets a writer that receives one line per executed
+// instruction: the PC, the disassembly, and the register state after the
+// instruction. Pass nil to disable tracing.
+//
+// Each line has the form:
+//
+//	00000400  MOVEQ #$42,D0            D0=00000042 ... A7=00001000 SR=2700
+func (cpu *CPU) SetTraceWriter(w io.Writer) {
+	cpu.traceWriter = w
+}
+
+// traceInstruction writes the trace line for the instruction at pc, which
+// has just been executed
+func (cpu *CPU) traceInstruction(pc uint32, text string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%08X  %-24s", pc, strings.ReplaceAll(text, "\t", " "))
+	for i, v := range cpu.d {
+		fmt.Fprintf(&b, " D%d=%08X", i, v)
+	}
+	for i, v := range cpu.a {
+		fmt.Fprintf(&b, " A%d=%08X", i, v)
+	}
+	fmt.Fprintf(&b, " SR=%04X\n", cpu.sr)
+	io.WriteString(cpu.traceWriter, b.String())
+}
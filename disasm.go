@@ -4,6 +4,66 @@ import (
 	"fmt"
 )
 
+// SetSymbolResolver sets a function that maps addresses to symbol names.
+// The disassembler uses it for absolute addresses and branch targets, and
+// falls back to the hex form when it reports no symbol.
+func (cpu *CPU) SetSymbolResolver(resolver func(addr uint32) (string, bool)) {
+	cpu.symbolResolver = resolver
+}
+
+// codeMemory is a read-only view of a byte slice loaded at a base address,
+// used to disassemble code that is not mapped into a CPU. Reads outside the
+// slice return 0.
+type codeMemory struct {
+	base uint32
+	code []byte
+}
+
+func (m *codeMemory) Read8(address uint32) uint8 {
+	if off := address - m.base; off < uint32(len(m.code)) {
+		return m.code[off]
+	}
+	return 0
+}
+
+func (m *codeMemory) Read16(address uint32) uint16 {
+	return uint16(m.Read8(address))<<8 | uint16(m.Read8(address+1))
+}
+
+func (m *codeMemory) Read32(address uint32) uint32 {
+	return uint32(m.Read16(address))<<16 | uint32(m.Read16(address+2))
+}
+
+func (m *codeMemory) Write8(address uint32, value uint8)   {}
+func (m *codeMemory) Write16(address uint32, value uint16) {}
+func (m *codeMemory) Write32(address uint32, value uint32) {}
+
+// Disassemble disassembles the instruction at the start of code, which is
+// taken to be located at address pc, for the given CPU type. It needs no
+// CPU or memory handler, which suits tools working from a ROM dump.
+// Returns the disassembled string and the size of the instruction in bytes.
+func Disassemble(cpuType CPUType, code []byte, pc uint32) (string, int) {
+	cpu := NewCPU(cpuType)
+	cpu.memory = &codeMemory{base: pc, code: code}
+	cpu.addressMask = 0xFFFFFFFF
+	return cpu.Disassemble(pc)
+}
+
+// DisassembleVerbose disassembles the instruction at the specified address
+// like Disassemble, and also returns the bytes it occupies, for listings
+// that show the instruction words beside the text
+func (cpu *CPU) DisassembleVerbose(address uint32) (text string, rawBytes []byte, size int) {
+	text, size = cpu.Disassemble(address)
+	if cpu.memory == nil {
+		return text, nil, size
+	}
+	rawBytes = make([]byte, size)
+	for i := range rawBytes {
+		rawBytes[i] = cpu.Peek8(address + uint32(i))
+	}
+	return text, rawBytes, size
+}
+
 // Disassemble disassembles a single instruction at the specified address.
 // Returns the disassembled string and the size of the instruction in bytes.
 func (cpu *CPU) Disassemble(address uint32) (string, int) {
@@ -12,7 +72,7 @@ func (cpu *CPU) Disassemble(address uint32) (string, int) {
 	}
 
 	// Read opcode
-	opcode := cpu.memory.Read16(address)
+	opcode := cpu.Peek16(address)
 	pc := address + 2
 
 	// Decode based on opcode
@@ -48,32 +108,35 @@ func (cpu *CPU) Disassemble(address uint32) (string, int) {
 }
 
 func (cpu *CPU) disasm0(opcode uint16, address, pc uint32) (string, int) {
+	if opcode&0x0138 == 0x0108 {
+		// MOVEP shares its encoding space with the dynamic bit operations
+		size := 16 << ((opcode >> 6) & 1)
+		mem, n := cpu.disasmEA(5, opcode&7, size, pc)
+		reg := fmt.Sprintf("D%d", (opcode>>9)&7)
+		if opcode&0x0080 != 0 {
+			return fmt.Sprintf("MOVEP%s\t%s,%s", sizeSuffix(size), reg, mem), 2 + int(n)
+		}
+		return fmt.Sprintf("MOVEP%s\t%s,%s", sizeSuffix(size), mem, reg), 2 + int(n)
+	}
 	if opcode&0x0100 == 0 {
-		switch (opcode >> 9) & 0x07 {
-		case 0:
-			if opcode&0x003F == 0x003C {
-				imm := cpu.memory.Read16(pc)
-				return fmt.Sprintf("ORI\t#$%02X,CCR", imm&0xFF), 4
-			}
-			return fmt.Sprintf("ORI\t<ea>"), 2
-		case 1:
-			if opcode&0x003F == 0x003C {
-				imm := cpu.memory.Read16(pc)
-				return fmt.Sprintf("ANDI\t#$%02X,CCR", imm&0xFF), 4
-			}
-			return fmt.Sprintf("ANDI\t<ea>"), 2
-		case 2:
-			return fmt.Sprintf("SUBI\t<ea>"), 2
-		case 3:
-			return fmt.Sprintf("ADDI\t<ea>"), 2
-		case 5:
-			if opcode&0x003F == 0x003C {
-				imm := cpu.memory.Read16(pc)
-				return fmt.Sprintf("EORI\t#$%02X,CCR", imm&0xFF), 4
-			}
-			return fmt.Sprintf("EORI\t<ea>"), 2
-		case 6:
-			return fmt.Sprintf("CMPI\t<ea>"), 2
+		names := [8]string{"ORI", "ANDI", "SUBI", "ADDI", "", "EORI", "CMPI", ""}
+		op := (opcode >> 9) & 0x07
+		name := names[op]
+		logical := op == 0 || op == 1 || op == 5 // ORI, ANDI, EORI also to CCR and SR
+		switch {
+		case logical && opcode&0x00FF == 0x003C:
+			imm := cpu.Peek16(pc)
+			return fmt.Sprintf("%s\t#$%02X,CCR", name, imm&0xFF), 4
+		case logical && opcode&0x00FF == 0x007C:
+			imm := cpu.Peek16(pc)
+			return fmt.Sprintf("%s\t#$%04X,SR", name, imm), 4
+		case name != "" && opcode&0x00C0 != 0x00C0:
+			size := 8 << ((opcode >> 6) & 3)
+			src, n := cpu.disasmEA(7, 4, size, pc)
+			dst, m := cpu.disasmEA((opcode>>3)&7, opcode&7, size, pc+n)
+			return fmt.Sprintf("%s%s\t%s,%s", name, sizeSuffix(size), src, dst), int(2 + n + m)
+		case op == 7 && opcode&0x00C0 != 0x00C0 && cpu.cpuType >= CPU68010:
+			return fmt.Sprintf("MOVES\t<ea>"), 4
 		}
 	}
 	return fmt.Sprintf("DC.W\t$%04X", opcode), 2
@@ -89,21 +152,87 @@ func (cpu *CPU) disasmMOVE(opcode uint16, address, pc uint32) (string, int) {
 
 func (cpu *CPU) disasm4(opcode uint16, address, pc uint32) (string, int) {
 	switch opcode {
+	case 0x4AFC:
+		return "ILLEGAL", 2
 	case 0x4E70:
 		return "RESET", 2
 	case 0x4E71:
 		return "NOP", 2
 	case 0x4E72:
-		imm := cpu.memory.Read16(pc)
+		imm := cpu.Peek16(pc)
 		return fmt.Sprintf("STOP\t#$%04X", imm), 4
 	case 0x4E73:
 		return "RTE", 2
+	case 0x4E74:
+		imm := cpu.Peek16(pc)
+		return fmt.Sprintf("RTD\t#$%04X", imm), 4
 	case 0x4E75:
 		return "RTS", 2
 	case 0x4E76:
 		return "TRAPV", 2
 	case 0x4E77:
 		return "RTR", 2
+	case 0x4E7A, 0x4E7B:
+		ext := cpu.Peek16(pc)
+		reg := fmt.Sprintf("D%d", (ext>>12)&7)
+		if ext&0x8000 != 0 {
+			reg = fmt.Sprintf("A%d", (ext>>12)&7)
+		}
+		ctrl := controlRegisterName(ext & 0x0FFF)
+		if opcode&1 == 0 {
+			return fmt.Sprintf("MOVEC\t%s,%s", ctrl, reg), 4
+		}
+		return fmt.Sprintf("MOVEC\t%s,%s", reg, ctrl), 4
+	}
+
+	switch {
+	case opcode&0xFFF8 == 0x4840:
+		return fmt.Sprintf("SWAP\tD%d", opcode&7), 2
+	case opcode&0xFFF0 == 0x4E40:
+		return fmt.Sprintf("TRAP\t#%d", opcode&0x0F), 2
+	case opcode&0xFFF8 == 0x4848 && cpu.cpuType >= CPU68010:
+		return fmt.Sprintf("BKPT\t#%d", opcode&7), 2
+	case opcode&0xFFF8 == 0x4E50:
+		disp := int32(int16(cpu.Peek16(pc)))
+		return fmt.Sprintf("LINK.W\tA%d,#%s", opcode&7, signedHex(disp)), 4
+	case opcode&0xFFF8 == 0x4808 && cpu.is020Plus():
+		disp := int32(cpu.Peek32(pc))
+		return fmt.Sprintf("LINK.L\tA%d,#%s", opcode&7, signedHex(disp)), 6
+	case opcode&0xFFF8 == 0x4E58:
+		return fmt.Sprintf("UNLK\tA%d", opcode&7), 2
+	case opcode&0xFFF8 == 0x4E60:
+		return fmt.Sprintf("MOVE\tA%d,USP", opcode&7), 2
+	case opcode&0xFFF8 == 0x4E68:
+		return fmt.Sprintf("MOVE\tUSP,A%d", opcode&7), 2
+	case opcode&0xFFF8 == 0x4880:
+		return fmt.Sprintf("EXT.W\tD%d", opcode&7), 2
+	case opcode&0xFFF8 == 0x48C0:
+		return fmt.Sprintf("EXT.L\tD%d", opcode&7), 2
+	case opcode&0xFFF8 == 0x49C0 && cpu.is020Plus():
+		return fmt.Sprintf("EXTB.L\tD%d", opcode&7), 2
+	case opcode&0xFFC0 == 0x40C0:
+		ea, n := cpu.disasmEA((opcode>>3)&7, opcode&7, 16, pc)
+		return "MOVE\tSR," + ea, 2 + int(n)
+	case opcode&0xFFC0 == 0x42C0 && cpu.cpuType >= CPU68010:
+		ea, n := cpu.disasmEA((opcode>>3)&7, opcode&7, 16, pc)
+		return "MOVE\tCCR," + ea, 2 + int(n)
+	case opcode&0xFFC0 == 0x4AC0:
+		if opcode&0x0038 == 0 {
+			return fmt.Sprintf("TAS\tD%d", opcode&7), 2
+		}
+		return fmt.Sprintf("TAS\t<ea>"), 2
+	case opcode&0xF1C0 == 0x41C0 && controlMode(int(opcode>>3)&7, int(opcode&7)):
+		ea, n := cpu.disasmEA((opcode>>3)&7, opcode&7, 32, pc)
+		return fmt.Sprintf("LEA\t%s,A%d", ea, (opcode>>9)&7), 2 + int(n)
+	case opcode&0xFFC0 == 0x4840 && controlMode(int(opcode>>3)&7, int(opcode&7)):
+		ea, n := cpu.disasmEA((opcode>>3)&7, opcode&7, 32, pc)
+		return "PEA\t" + ea, 2 + int(n)
+	case opcode&0xFFC0 == 0x4E80:
+		target, size := cpu.disasmJumpTarget(opcode, pc)
+		return "JSR\t" + target, size
+	case opcode&0xFFC0 == 0x4EC0:
+		target, size := cpu.disasmJumpTarget(opcode, pc)
+		return "JMP\t" + target, size
 	}
 
 	switch (opcode >> 6) & 0x07 {
@@ -118,14 +247,6 @@ func (cpu *CPU) disasm4(opcode uint16, address, pc uint32) (string, int) {
 		case 3:
 			return fmt.Sprintf("NOT\t<ea>"), 2
 		}
-	case 1:
-		if opcode&0x0008 != 0 {
-			return fmt.Sprintf("SWAP\tD%d", opcode&7), 2
-		}
-		if opcode&0x0040 == 0 {
-			return fmt.Sprintf("EXT.W\tD%d", opcode&7), 2
-		}
-		return fmt.Sprintf("EXT.L\tD%d", opcode&7), 2
 	case 3:
 		return fmt.Sprintf("TST\t<ea>"), 2
 	case 4, 6:
@@ -135,24 +256,26 @@ func (cpu *CPU) disasm4(opcode uint16, address, pc uint32) (string, int) {
 		return fmt.Sprintf("CHK\t<ea>"), 2
 	}
 
-	if opcode&0x01C0 == 0x01C0 {
-		switch (opcode >> 9) & 0x07 {
-		case 4:
-			return fmt.Sprintf("JSR\t<ea>"), 2
-		case 6:
-			return fmt.Sprintf("JMP\t<ea>"), 2
-		}
-	}
-
 	return fmt.Sprintf("DC.W\t$%04X", opcode), 2
 }
 
 func (cpu *CPU) disasm5(opcode uint16, address, pc uint32) (string, int) {
 	if opcode&0x00C0 == 0x00C0 {
+		if cpu.is020Plus() && opcode&0x00FF >= 0x00FA && opcode&0x00FF <= 0x00FC {
+			cond := int((opcode >> 8) & 0x0F)
+			switch opcode & 7 {
+			case 2:
+				return fmt.Sprintf("TRAP%s.W\t#$%04X", condName(cond), cpu.Peek16(pc)), 4
+			case 3:
+				return fmt.Sprintf("TRAP%s.L\t#$%08X", condName(cond), cpu.Peek32(pc)), 6
+			}
+			return fmt.Sprintf("TRAP%s", condName(cond)), 2
+		}
 		if opcode&0x0038 == 0x0008 {
-			disp := int16(cpu.memory.Read16(pc))
+			disp := int32(int16(cpu.Peek16(pc)))
 			cond := int((opcode >> 8) & 0x0F)
-			return fmt.Sprintf("DB%s\tD%d,$%04X", condName(cond), opcode&7, disp), 4
+			target := uint32(int32(address+2) + disp)
+			return fmt.Sprintf("DB%s\tD%d,%s", condName(cond), opcode&7, cpu.addressName(target)), 4
 		}
 		cond := int((opcode >> 8) & 0x0F)
 		return fmt.Sprintf("S%s\t<ea>", condName(cond)), 2
@@ -174,19 +297,22 @@ func (cpu *CPU) disasm6(opcode uint16, address, pc uint32) (string, int) {
 	size := 2
 
 	if disp == 0 {
-		disp = int32(int16(cpu.memory.Read16(pc)))
+		disp = int32(int16(cpu.Peek16(pc)))
 		size = 4
+	} else if disp == -1 && cpu.is020Plus() {
+		disp = int32(cpu.Peek32(pc))
+		size = 6
 	}
 
 	target := uint32(int32(address+2) + disp)
 
 	switch cond {
 	case 0:
-		return fmt.Sprintf("BRA\t$%08X", target), size
+		return "BRA\t" + cpu.addressName(target), size
 	case 1:
-		return fmt.Sprintf("BSR\t$%08X", target), size
+		return "BSR\t" + cpu.addressName(target), size
 	default:
-		return fmt.Sprintf("B%s\t$%08X", condName(cond), target), size
+		return fmt.Sprintf("B%s\t%s", condName(cond), cpu.addressName(target)), size
 	}
 }
 
@@ -215,7 +341,10 @@ func (cpu *CPU) disasm9D(opcode uint16, address, pc uint32) (string, int) {
 
 func (cpu *CPU) disasmB(opcode uint16, address, pc uint32) (string, int) {
 	if opcode&0x00C0 == 0x00C0 {
-		return fmt.Sprintf("CMPA\t<ea>"), 2
+		if opcode&0x0100 != 0 {
+			return fmt.Sprintf("CMPA.L\t<ea>,A%d", (opcode>>9)&7), 2
+		}
+		return fmt.Sprintf("CMPA.W\t<ea>,A%d", (opcode>>9)&7), 2
 	}
 	if opcode&0x0100 == 0x0100 {
 		return fmt.Sprintf("EOR\t<ea>"), 2
@@ -239,6 +368,164 @@ func (cpu *CPU) disasmE(opcode uint16, address, pc uint32) (string, int) {
 	return fmt.Sprintf("SHIFT\t<ea>"), 2
 }
 
+// disasmJumpTarget formats the target of a JMP or JSR, resolving absolute
+// and PC-relative addresses. Returns the operand and the instruction size.
+func (cpu *CPU) disasmJumpTarget(opcode uint16, pc uint32) (string, int) {
+	mode := (opcode >> 3) & 7
+	reg := opcode & 7
+
+	switch {
+	case mode == 2:
+		return fmt.Sprintf("(A%d)", reg), 2
+	case mode == 7 && reg == 0:
+		return cpu.addressName(signExtend16(uint32(cpu.Peek16(pc)))), 4
+	case mode == 7 && reg == 1:
+		return cpu.addressName(cpu.Peek32(pc)), 6
+	case mode == 7 && reg == 2:
+		return cpu.addressName(pc + signExtend16(uint32(cpu.Peek16(pc)))), 4
+	}
+	return "<ea>", 2
+}
+
+// sizeSuffix returns the assembler size suffix for an operand size in bits
+func sizeSuffix(size int) string {
+	switch size {
+	case 8:
+		return ".B"
+	case 16:
+		return ".W"
+	}
+	return ".L"
+}
+
+// signedHex formats a signed displacement as hex, e.g. "-$10"
+func signedHex(v int32) string {
+	if v < 0 {
+		return fmt.Sprintf("-$%X", -int64(v))
+	}
+	return fmt.Sprintf("$%X", v)
+}
+
+// disasmEA formats an effective address operand of the given size in bits
+// whose extension words start at pc. Returns the operand and the number of
+// extension bytes it occupies.
+func (cpu *CPU) disasmEA(mode, reg uint16, size int, pc uint32) (string, uint32) {
+	switch mode {
+	case 0:
+		return fmt.Sprintf("D%d", reg), 0
+	case 1:
+		return fmt.Sprintf("A%d", reg), 0
+	case 2:
+		return fmt.Sprintf("(A%d)", reg), 0
+	case 3:
+		return fmt.Sprintf("(A%d)+", reg), 0
+	case 4:
+		return fmt.Sprintf("-(A%d)", reg), 0
+	case 5:
+		disp := int32(int16(cpu.Peek16(pc)))
+		return fmt.Sprintf("%s(A%d)", signedHex(disp), reg), 2
+	case 6:
+		return cpu.disasmIndex(fmt.Sprintf("A%d", reg), pc)
+	}
+
+	switch reg {
+	case 0:
+		return cpu.addressName(signExtend16(uint32(cpu.Peek16(pc)))) + ".W", 2
+	case 1:
+		return cpu.addressName(cpu.Peek32(pc)), 4
+	case 2:
+		return cpu.addressName(pc+signExtend16(uint32(cpu.Peek16(pc)))) + "(PC)", 2
+	case 3:
+		return cpu.disasmIndex("PC", pc)
+	case 4:
+		switch size {
+		case 8:
+			return fmt.Sprintf("#$%02X", cpu.Peek16(pc)&0xFF), 2
+		case 16:
+			return fmt.Sprintf("#$%04X", cpu.Peek16(pc)), 2
+		}
+		return fmt.Sprintf("#$%08X", cpu.Peek32(pc)), 4
+	}
+	return "<ea>", 0
+}
+
+// disasmIndex formats an indexed operand with base register base (An or
+// PC) from the extension word at pc. Returns the operand and the number of
+// extension bytes, including any base and outer displacements of the
+// 68020 full extension format.
+func (cpu *CPU) disasmIndex(base string, pc uint32) (string, uint32) {
+	ext := cpu.Peek16(pc)
+	index := fmt.Sprintf("D%d", (ext>>12)&7)
+	if ext&0x8000 != 0 {
+		index = fmt.Sprintf("A%d", (ext>>12)&7)
+	}
+	if ext&0x0800 != 0 {
+		index += ".L"
+	} else {
+		index += ".W"
+	}
+	if scale := (ext >> 9) & 3; scale != 0 && cpu.is020Plus() {
+		index += fmt.Sprintf("*%d", 1<<scale)
+	}
+
+	if ext&0x0100 == 0 || !cpu.is020Plus() {
+		return fmt.Sprintf("%s(%s,%s)", signedHex(int32(int8(ext))), base, index), 2
+	}
+
+	// Full extension format: optional base and outer displacements
+	n := uint32(2)
+	var bd, od int32
+	switch (ext >> 4) & 3 {
+	case 2:
+		bd = int32(int16(cpu.Peek16(pc + n)))
+		n += 2
+	case 3:
+		bd = int32(cpu.Peek32(pc + n))
+		n += 4
+	}
+	switch ext & 3 {
+	case 2:
+		od = int32(int16(cpu.Peek16(pc + n)))
+		n += 2
+	case 3:
+		od = int32(cpu.Peek32(pc + n))
+		n += 4
+	}
+	if ext&0x0080 != 0 {
+		base = "Z" + base
+	}
+	if ext&0x0040 != 0 {
+		index = ""
+	}
+
+	inner := signedHex(bd) + "," + base
+	switch {
+	case ext&7 == 0:
+		// No memory indirection
+		if index != "" {
+			inner += "," + index
+		}
+		return "(" + inner + ")", n
+	case ext&4 != 0 && index != "":
+		// Postindexed
+		return fmt.Sprintf("([%s],%s,%s)", inner, index, signedHex(od)), n
+	case index != "":
+		inner += "," + index
+	}
+	return fmt.Sprintf("([%s],%s)", inner, signedHex(od)), n
+}
+
+// addressName formats an absolute address, using the symbol resolver when
+// one is set and knows the address
+func (cpu *CPU) addressName(addr uint32) string {
+	if cpu.symbolResolver != nil {
+		if name, ok := cpu.symbolResolver(addr); ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("$%08X", addr)
+}
+
 func condName(cond int) string {
 	names := []string{
 		"T", "F", "HI", "LS", "CC", "CS", "NE", "EQ",
@@ -249,3 +536,25 @@ func condName(cond int) string {
 	}
 	return "??"
 }
+
+func controlRegisterName(ctrl uint16) string {
+	switch ctrl {
+	case ctrlSFC:
+		return "SFC"
+	case ctrlDFC:
+		return "DFC"
+	case ctrlCACR:
+		return "CACR"
+	case ctrlUSP:
+		return "USP"
+	case ctrlVBR:
+		return "VBR"
+	case ctrlCAAR:
+		return "CAAR"
+	case ctrlMSP:
+		return "MSP"
+	case ctrlISP:
+		return "ISP"
+	}
+	return fmt.Sprintf("$%03X", ctrl)
+}
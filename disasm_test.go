@@ -27,6 +27,9 @@ func TestDisassembler(t *testing.T) {
 		{"EXT.W", 0x1000, 0x4880, "EXT.W"},
 		{"EXT.L", 0x1000, 0x48C0, "EXT.L"},
 		{"EXG", 0x1000, 0xC141, "EXG"},
+		{"CMPA.W", 0x1000, 0xB0C9, "CMPA.W"},
+		{"CMPA.L", 0x1000, 0xB3C8, "CMPA.L"},
+		{"MOVE from SR", 0x1000, 0x40C3, "MOVE\tSR,D3"},
 	}
 
 	for _, tt := range tests {
@@ -45,6 +48,81 @@ func TestDisassembler(t *testing.T) {
 	}
 }
 
+func TestDisassembleImmediate(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	tests := []struct {
+		words []uint16
+		want  string
+	}{
+		{[]uint16{0x0000, 0x0012}, "ORI.B\t#$12,D0"},
+		{[]uint16{0x0641, 0x1234}, "ADDI.W\t#$1234,D1"},
+		{[]uint16{0x0CB9, 0x0000, 0x0001, 0x00FF, 0x0000}, "CMPI.L\t#$00000001,$00FF0000"},
+		{[]uint16{0x0468, 0x0010, 0xFFFC}, "SUBI.W\t#$0010,-$4(A0)"},
+		{[]uint16{0x0A30, 0x00FF, 0x2402}, "EORI.B\t#$FF,$2(A0,D2.W*4)"},
+		{[]uint16{0x027C, 0xF8FF}, "ANDI\t#$F8FF,SR"},
+	}
+
+	for _, tt := range tests {
+		for i, w := range tt.words {
+			memory.Write16(0x1000+uint32(i)*2, w)
+		}
+		got, size := cpu.Disassemble(0x1000)
+		if got != tt.want || size != len(tt.words)*2 {
+			t.Errorf("Expected %q of %d bytes, got %q of %d", tt.want, len(tt.words)*2, got, size)
+		}
+	}
+}
+
+func TestDisassembleMOVEP(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	tests := []struct {
+		opcode uint16
+		disp   uint16
+		want   string
+	}{
+		{0x0108, 0x0010, "MOVEP.W\t$10(A0),D0"},
+		{0x0349, 0xFFFE, "MOVEP.L\t-$2(A1),D1"},
+		{0x0188, 0x0020, "MOVEP.W\tD0,$20(A0)"},
+		{0x0FCF, 0x7FFE, "MOVEP.L\tD7,$7FFE(A7)"},
+	}
+
+	for _, tt := range tests {
+		memory.Write16(0x1000, tt.opcode)
+		memory.Write16(0x1002, tt.disp)
+		got, size := cpu.Disassemble(0x1000)
+		if got != tt.want || size != 4 {
+			t.Errorf("0x%04X: expected %q of 4 bytes, got %q of %d", tt.opcode, tt.want, got, size)
+		}
+	}
+}
+
+func TestDisassembleVerbose(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write16(0x1000, 0x0641) // ADDI.W #$1234,D1
+	memory.Write16(0x1002, 0x1234)
+	memory.Write16(0x1004, 0x4E71)
+
+	text, raw, size := cpu.DisassembleVerbose(0x1000)
+	if text != "ADDI.W\t#$1234,D1" {
+		t.Errorf("Expected ADDI.W #$1234,D1, got %q", text)
+	}
+	if size != 4 || len(raw) != size {
+		t.Fatalf("Expected 4 raw bytes, got %d for size %d", len(raw), size)
+	}
+	if raw[0] != 0x06 || raw[1] != 0x41 || raw[2] != 0x12 || raw[3] != 0x34 {
+		t.Errorf("Expected bytes 06 41 12 34, got % X", raw)
+	}
+}
+
 func TestDisassembleBranches(t *testing.T) {
 	cpu := NewCPU(CPU68000)
 	memory := &SimpleMemory{}
@@ -107,3 +185,106 @@ func TestDisassembleConditions(t *testing.T) {
 		t.Errorf("Expected size 4, got %d", size)
 	}
 }
+
+// TestDisassembleDBccTarget tests that DBcc shows its absolute target
+func TestDisassembleDBccTarget(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	// DBF D0 back to $1000
+	memory.Write16(0x1004, 0x51C8)
+	memory.Write16(0x1006, 0xFFFA)
+	result, _ := cpu.Disassemble(0x1004)
+
+	if result != "DBF\tD0,$00001000" {
+		t.Errorf("Expected DBF D0,$00001000, got %q", result)
+	}
+}
+
+func TestDisassembleLongBranch(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	// BRA.L with 32-bit displacement
+	memory.Write16(0x1000, 0x60FF)
+	memory.Write32(0x1002, 0x00010000)
+	result, size := cpu.Disassemble(0x1000)
+
+	if !strings.Contains(result, "BRA") || !strings.Contains(result, "$00011002") {
+		t.Errorf("Expected BRA $00011002, got %s", result)
+	}
+	if size != 6 {
+		t.Errorf("Expected size 6, got %d", size)
+	}
+
+	// On a 68000 the same word is an 8-bit displacement of -1
+	cpu.SetCPUType(CPU68000)
+	_, size = cpu.Disassemble(0x1000)
+	if size != 2 {
+		t.Errorf("Expected size 2 on 68000, got %d", size)
+	}
+}
+
+func TestDisassembleSymbols(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	symbols := map[uint32]string{0x1100: "Init"}
+	cpu.SetSymbolResolver(func(addr uint32) (string, bool) {
+		name, ok := symbols[addr]
+		return name, ok
+	})
+
+	tests := []struct {
+		name     string
+		words    []uint16
+		expected string
+		size     int
+	}{
+		{"BSR to symbol", []uint16{0x6100, 0x00FE}, "BSR\tInit", 4},
+		{"BRA without symbol", []uint16{0x6010}, "BRA\t$00001012", 2},
+		{"JSR absolute long", []uint16{0x4EB9, 0x0000, 0x1100}, "JSR\tInit", 6},
+		{"JMP absolute short", []uint16{0x4EF8, 0x1234}, "JMP\t$00001234", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, w := range tt.words {
+				memory.Write16(0x1000+uint32(i*2), w)
+			}
+			result, size := cpu.Disassemble(0x1000)
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+			if size != tt.size {
+				t.Errorf("Expected size %d, got %d", tt.size, size)
+			}
+		})
+	}
+}
+
+func TestDisassembleBytes(t *testing.T) {
+	code := []byte{
+		0x4E, 0x71, // NOP
+		0x4E, 0x75, // RTS
+	}
+
+	text, size := Disassemble(CPU68000, code, 0x10000)
+	if text != "NOP" || size != 2 {
+		t.Errorf("Expected NOP (2 bytes), got %q (%d bytes)", text, size)
+	}
+
+	text, size = Disassemble(CPU68000, code[size:], 0x10000+uint32(size))
+	if text != "RTS" || size != 2 {
+		t.Errorf("Expected RTS (2 bytes), got %q (%d bytes)", text, size)
+	}
+
+	// Branch targets are computed from pc
+	text, _ = Disassemble(CPU68000, []byte{0x60, 0x04}, 0x1000)
+	if !strings.Contains(text, "1006") {
+		t.Errorf("Expected BRA target $1006, got %q", text)
+	}
+}
@@ -16,14 +16,11 @@ func (m *SimpleMemory) Read8(address uint32) uint8 {
 }
 
 func (m *SimpleMemory) Read16(address uint32) uint16 {
-	addr := address & 0xFFFFF
-	return uint16(m.ram[addr])<<8 | uint16(m.ram[addr+1])
+	return musashi.Read16BE(m.ram[:], address&0xFFFFF)
 }
 
 func (m *SimpleMemory) Read32(address uint32) uint32 {
-	addr := address & 0xFFFFF
-	return uint32(m.ram[addr])<<24 | uint32(m.ram[addr+1])<<16 |
-		uint32(m.ram[addr+2])<<8 | uint32(m.ram[addr+3])
+	return musashi.Read32BE(m.ram[:], address&0xFFFFF)
 }
 
 func (m *SimpleMemory) Write8(address uint32, value uint8) {
@@ -31,17 +28,11 @@ func (m *SimpleMemory) Write8(address uint32, value uint8) {
 }
 
 func (m *SimpleMemory) Write16(address uint32, value uint16) {
-	addr := address & 0xFFFFF
-	m.ram[addr] = uint8(value >> 8)
-	m.ram[addr+1] = uint8(value)
+	musashi.Write16BE(m.ram[:], address&0xFFFFF, value)
 }
 
 func (m *SimpleMemory) Write32(address uint32, value uint32) {
-	addr := address & 0xFFFFF
-	m.ram[addr] = uint8(value >> 24)
-	m.ram[addr+1] = uint8(value >> 16)
-	m.ram[addr+2] = uint8(value >> 8)
-	m.ram[addr+3] = uint8(value)
+	musashi.Write32BE(m.ram[:], address&0xFFFFF, value)
 }
 
 func main() {
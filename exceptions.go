@@ -0,0 +1,355 @@
+package musashi
+
+// exceptions.go - Exception processing
+
+import "fmt"
+
+// Exception vector numbers
+const (
+	VectorResetSSP      = 0  // Reset initial supervisor stack pointer
+	VectorResetPC       = 1  // Reset initial program counter
+	VectorBusError      = 2  // Bus error
+	VectorAddressError  = 3  // Address error
+	VectorIllegal       = 4  // Illegal instruction
+	VectorZeroDivide    = 5  // Integer divide by zero
+	VectorCHK           = 6  // CHK, CHK2 instruction
+	VectorTRAPV         = 7  // TRAPV, TRAPcc instruction
+	VectorPrivilege     = 8  // Privilege violation
+	VectorTrace         = 9  // Trace
+	VectorLineA         = 10 // Line 1010 emulator
+	VectorLineF         = 11 // Line 1111 emulator
+	VectorFormatError   = 14 // Stack frame format error (68010+)
+	VectorUninitialized = 15 // Uninitialized interrupt
+	VectorSpurious      = 24 // Spurious interrupt
+	VectorAutovector    = 24 // Autovector base (level n uses VectorAutovector+n)
+	VectorTrap          = 32 // TRAP #0 (TRAP #n uses VectorTrap+n)
+)
+
+// exception performs exception processing with a normal (format $0) stack
+// frame. The CPU enters supervisor mode with tracing disabled, stacks the
+// old SR and the given return PC (plus the format/vector word on 68010+)
+// and jumps through the vector table.
+func (cpu *CPU) exception(vector, pc uint32) {
+	cpu.exceptionFrame(vector, pc, 0)
+}
+
+// trapException takes an instruction trap (TRAPV, TRAPcc, CHK, CHK2, divide
+// by zero) that returns to the next instruction. The 68020+ stacks a format
+// $2 frame that also records the address of the trapping instruction.
+func (cpu *CPU) trapException(vector uint32) {
+	if cpu.is020Plus() {
+		cpu.exceptionFrame(vector, cpu.pc, 2)
+	} else {
+		cpu.exceptionFrame(vector, cpu.pc, 0)
+	}
+}
+
+// FaultMode selects where bus and address errors are handled
+type FaultMode int
+
+// Fault modes
+const (
+	FaultModeGuest FaultMode = iota // Take the exception through the guest's vector (default)
+	FaultModeGo                     // Stop execution and return a *MemoryFault from ExecuteChecked
+)
+
+// SetFaultMode selects whether bus and address errors are dispatched to the
+// guest's exception vectors or returned to the host, e.g. during early
+// bring-up before the vector table is set up
+func (cpu *CPU) SetFaultMode(mode FaultMode) {
+	cpu.faultMode = mode
+}
+
+// MemoryFault describes a bus or address error returned by ExecuteChecked
+type MemoryFault struct {
+	Vector  uint32 // VectorBusError or VectorAddressError
+	Address uint32 // Address of the faulting access
+	Write   bool   // The access was a write
+	PC      uint32 // Address of the faulting instruction
+}
+
+// Error implements the error interface
+func (f *MemoryFault) Error() string {
+	kind, access := "bus error", "read"
+	if f.Vector == VectorAddressError {
+		kind = "address error"
+	}
+	if f.Write {
+		access = "write"
+	}
+	return fmt.Sprintf("%s on %s of $%08X at PC $%08X", kind, access, f.Address, f.PC)
+}
+
+// busFault takes a bus error or address error (group 0) exception for an
+// access to the given address and aborts the current instruction. A further
+// bus or address error while the fault is being processed is a double
+// fault: the CPU halts and only a reset restarts it.
+func (cpu *CPU) busFault(vector, address uint32, write bool) {
+	defer cpu.abortInstruction()
+	if cpu.faultMode == FaultModeGo {
+		if cpu.fault == nil {
+			cpu.fault = &MemoryFault{Vector: vector, Address: address, Write: write, PC: cpu.ppc}
+		}
+		cpu.endTimeslice(StopFault)
+		return
+	}
+	if cpu.inFault {
+		cpu.halted = true
+		return
+	}
+	cpu.inFault = true
+	defer func() { cpu.inFault = false }()
+	cpu.recordException(vector)
+
+	if cpu.cpuType != CPU68000 {
+		cpu.faultFrame(vector, address, write)
+		cpu.useCycles(50)
+		return
+	}
+
+	// 68000 group 0 frame: status word, access address, IR, SR, PC
+	oldSR := cpu.sr
+	cpu.setSR((cpu.sr | FlagS) &^ (FlagT | FlagT0))
+	if cpu.a[7]&1 != 0 {
+		// The frame cannot be stacked at an odd address
+		cpu.halted = true
+		return
+	}
+
+	status := uint16(cpu.dataFC())
+	if !write {
+		status |= 0x10
+	}
+	cpu.pushLong(cpu.pc)
+	cpu.pushWord(oldSR)
+	cpu.pushWord(cpu.ir)
+	cpu.pushLong(address)
+	cpu.pushWord(status)
+	if cpu.halted {
+		// Double fault while stacking the frame
+		return
+	}
+
+	cpu.setPC(cpu.readMem(cpu.vectorAddress(vector), 32))
+	cpu.useCycles(50)
+}
+
+// faultFrame stacks the bus or address error frame of a 68010 or later:
+// format $8 on the 68010, format $A (short bus cycle fault) on the 68020
+// and 68030, and format $7 (access error) or $2 (address error) on the
+// 68040. The SCC68070 is given the 68010 frame; its own long frame is not
+// modeled. The internal state the hardware saves to continue the
+// instruction is stacked as zeros, so the stacked PC is that of the
+// aborted instruction and RTE restarts it.
+func (cpu *CPU) faultFrame(vector, address uint32, write bool) {
+	pc := cpu.pc
+	if cpu.inInstruction {
+		pc = cpu.ppc
+	}
+	fc := uint16(cpu.dataFC())
+	hi, lo := uint16(address>>16), uint16(address)
+
+	// Words following the format/vector word, from the lowest address;
+	// words[i] is at frame offset 8+2i
+	var format uint16
+	var words []uint16
+	switch {
+	case cpu.is040() && vector == VectorAddressError:
+		format = 0x2
+		words = []uint16{hi, lo}
+	case cpu.is040():
+		// SSW: RW, TM = function code
+		ssw := fc
+		if !write {
+			ssw |= 0x0100
+		}
+		format = 0x7
+		words = make([]uint16, 26)
+		words[2] = ssw              // $0C
+		words[6], words[7] = hi, lo // $14
+	case cpu.is020Plus():
+		// SSW: DF, RW, function code
+		ssw := 0x0100 | fc
+		if !write {
+			ssw |= 0x0040
+		}
+		format = 0xA
+		words = make([]uint16, 12)
+		words[1] = ssw              // $0A
+		words[4], words[5] = hi, lo // $10
+	default:
+		// SSW: DF, RW, function code
+		ssw := 0x1000 | fc
+		if !write {
+			ssw |= 0x0100
+		}
+		format = 0x8
+		words = make([]uint16, 25)
+		words[0] = ssw              // $08
+		words[1], words[2] = hi, lo // $0A
+	}
+
+	oldSR := cpu.sr
+	cpu.loopMode = false
+	cpu.setSR((cpu.sr | FlagS) &^ (FlagT | FlagT0))
+	for i := len(words) - 1; i >= 0; i-- {
+		cpu.pushWord(words[i])
+	}
+	cpu.pushWord(format<<12 | uint16(vector<<2))
+	cpu.pushLong(pc)
+	cpu.pushWord(oldSR)
+	if cpu.halted {
+		// Double fault while stacking the frame
+		return
+	}
+
+	cpu.setPC(cpu.readMem(cpu.vectorAddress(vector), 32))
+}
+
+// exceptionFrame builds an exception stack frame of the given format and
+// loads the handler address from the vector table
+func (cpu *CPU) exceptionFrame(vector, pc uint32, format uint16) {
+	cpu.recordException(vector)
+	cpu.loopMode = false
+	oldSR := cpu.sr
+	cpu.setSR((cpu.sr | FlagS) &^ (FlagT | FlagT0))
+
+	if cpu.cpuType >= CPU68010 {
+		if format == 2 {
+			cpu.pushLong(cpu.ppc)
+		}
+		cpu.pushWord(format<<12 | uint16(vector<<2))
+	}
+	cpu.pushLong(pc)
+	cpu.pushWord(oldSR)
+	if cpu.halted {
+		// Double fault while stacking the frame
+		return
+	}
+
+	cpu.setPC(cpu.readMem(cpu.vectorAddress(vector), 32))
+}
+
+// frameSize returns the size in bytes of an exception stack frame of the
+// given format, and whether RTE accepts that format on this CPU
+func (cpu *CPU) frameSize(format uint16) (int, bool) {
+	switch cpu.cpuType {
+	case CPU68000:
+		return 6, format == 0
+	case CPU68010, CPUSCC68070:
+		switch format {
+		case 0x0:
+			return 8, true
+		case 0x8: // Bus or address error
+			return 58, true
+		}
+	case CPU68EC040, CPU68LC040, CPU68040:
+		switch format {
+		case 0x0, 0x1:
+			return 8, true
+		case 0x2, 0x3:
+			return 12, true
+		case 0x4: // Floating point unimplemented
+			return 16, true
+		case 0x7: // Access error
+			return 60, true
+		}
+	default:
+		switch format {
+		case 0x0, 0x1:
+			return 8, true
+		case 0x2:
+			return 12, true
+		case 0x9: // Coprocessor mid-instruction
+			return 20, true
+		case 0xA: // Short bus cycle fault
+			return 32, true
+		case 0xB: // Long bus cycle fault
+			return 92, true
+		}
+	}
+	return 0, false
+}
+
+// recordException remembers the vector and the instruction being executed
+// when an exception is taken, for LastException
+func (cpu *CPU) recordException(vector uint32) {
+	cpu.lastVector = vector
+	cpu.lastFaultPC = cpu.ppc
+	cpu.lastFaultIR = cpu.ir
+	cpu.lastException = true
+	if !isTrapVector(vector) {
+		// An instruction aborted by an exception is not traced
+		cpu.tracePending = false
+	}
+	if cpu.exceptionCallback != nil {
+		cpu.exceptionCallback(vector, true)
+	}
+	if cpu.exceptionBreak {
+		cpu.endTimeslice(StopException)
+	}
+}
+
+// isTrapVector reports whether an exception is raised by an instruction
+// that completes (TRAP, TRAPV, TRAPcc, CHK, divide by zero), which is still
+// traced, rather than one that aborts it
+func isTrapVector(vector uint32) bool {
+	switch {
+	case vector == VectorZeroDivide, vector == VectorCHK, vector == VectorTRAPV:
+		return true
+	case vector >= VectorTrap && vector < VectorTrap+16:
+		return true
+	}
+	return false
+}
+
+// LastException reports the most recent exception taken since reset: its
+// vector number and the address and opcode of the instruction that was
+// executing (for interrupts, the last instruction completed before it).
+// ok is false if no exception has been taken.
+func (cpu *CPU) LastException() (vector uint32, faultPC uint32, faultIR uint16, ok bool) {
+	return cpu.lastVector, cpu.lastFaultPC, cpu.lastFaultIR, cpu.lastException
+}
+
+// vectorAddress returns the address of an exception vector, relative to
+// the VBR on 68010+
+func (cpu *CPU) vectorAddress(vector uint32) uint32 {
+	if cpu.cpuType >= CPU68010 {
+		return cpu.vbr + vector*4
+	}
+	return vector * 4
+}
+
+// srMask returns the status register bits that exist on the CPU type:
+// T, S, the interrupt mask and the condition codes, plus T0 and M on the
+// 68020 and later
+func (cpu *CPU) srMask() uint16 {
+	if cpu.is020Plus() {
+		return 0xF71F
+	}
+	return 0xA71F
+}
+
+// setSR sets the status register, swapping the active stack pointer (A7)
+// with the saved one when the supervisor bit changes. Bits that do not
+// exist on the CPU type read back as zero.
+func (cpu *CPU) setSR(value uint16) {
+	value &= cpu.srMask()
+	if (cpu.sr^value)&FlagS != 0 {
+		if value&FlagS != 0 {
+			cpu.usp = cpu.a[7]
+			cpu.a[7] = cpu.isp
+		} else {
+			cpu.isp = cpu.a[7]
+			cpu.a[7] = cpu.usp
+		}
+	}
+	cpu.sr = value
+}
+
+// privilegeViolation takes a privilege violation exception for a supervisor
+// instruction executed in user mode
+func (cpu *CPU) privilegeViolation() {
+	cpu.exception(VectorPrivilege, cpu.ppc)
+	cpu.useCycles(34)
+}
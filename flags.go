@@ -9,6 +9,14 @@ const (
 	FlagX = 0x10 // Extend
 )
 
+// Status register system byte flags (in SR upper byte)
+const (
+	FlagT  = 0x8000 // Trace (T1 on 68020+)
+	FlagT0 = 0x4000 // Trace on change of flow (68020+)
+	FlagS  = 0x2000 // Supervisor
+	FlagM  = 0x1000 // Master/interrupt state (68020+)
+)
+
 // Condition codes for conditional instructions
 const (
 	CondT  = 0  // True
@@ -29,12 +37,51 @@ const (
 	CondLE = 15 // Less or Equal
 )
 
+// FlagsString renders the status register in a compact human-readable form,
+// e.g. "[--S7---XNzvc]". The system byte shows T, T0, S, the interrupt mask
+// and M; each condition code is upper case when set and lower case when clear.
+func (cpu *CPU) FlagsString() string {
+	b := []byte("[------------]")
+	if cpu.sr&FlagT != 0 {
+		b[1] = 'T'
+	}
+	if cpu.sr&FlagT0 != 0 {
+		b[2] = 't'
+	}
+	if cpu.sr&FlagS != 0 {
+		b[3] = 'S'
+	}
+	b[4] = '0' + byte((cpu.sr>>8)&0x07)
+	if cpu.sr&FlagM != 0 {
+		b[5] = 'M'
+	}
+
+	ccr := []struct {
+		flag uint16
+		name byte
+	}{
+		{FlagX, 'X'}, {FlagN, 'N'}, {FlagZ, 'Z'}, {FlagV, 'V'}, {FlagC, 'C'},
+	}
+	for i, f := range ccr {
+		if cpu.sr&f.flag != 0 {
+			b[8+i] = f.name
+		} else {
+			b[8+i] = f.name + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
 // setFlagsLogical sets condition codes for logical operations
 func (cpu *CPU) setFlagsLogical(result uint32, size int) {
 	// Clear V and C
 	cpu.sr &^= (FlagV | FlagC)
 
-	// Set N and Z based on result
+	cpu.setFlagsNZ(result, size)
+}
+
+// setFlagsNZ sets N and Z based on result, leaving the other flags alone
+func (cpu *CPU) setFlagsNZ(result uint32, size int) {
 	switch size {
 	case 8:
 		if result&0x80 != 0 {
@@ -72,44 +119,20 @@ func (cpu *CPU) setFlagsLogical(result uint32, size int) {
 	}
 }
 
-// setFlagsAdd sets condition codes for addition
+// setFlagsAdd sets condition codes for addition. Carry and overflow are
+// both derived from the sign bits of the operands and of the result, so
+// they agree with the result however it wrapped.
 func (cpu *CPU) setFlagsAdd(dest, src, result uint32, size int) {
-	var sm, dm, rm bool
+	msb := uint32(1) << uint(size-1)
+	sm := src&msb != 0
+	dm := dest&msb != 0
+	rm := result&msb != 0
 
-	switch size {
-	case 8:
-		sm = (src & 0x80) != 0
-		dm = (dest & 0x80) != 0
-		rm = (result & 0x80) != 0
-		// Carry
-		if result&0x100 != 0 {
-			cpu.sr |= (FlagC | FlagX)
-		} else {
-			cpu.sr &^= (FlagC | FlagX)
-		}
-	case 16:
-		sm = (src & 0x8000) != 0
-		dm = (dest & 0x8000) != 0
-		rm = (result & 0x8000) != 0
-		// Carry
-		if result&0x10000 != 0 {
-			cpu.sr |= (FlagC | FlagX)
-		} else {
-			cpu.sr &^= (FlagC | FlagX)
-		}
-	case 32:
-		sm = (src & 0x80000000) != 0
-		dm = (dest & 0x80000000) != 0
-		rm = (result & 0x80000000) != 0
-		// Carry (check for overflow in 64-bit space)
-		src64 := uint64(src)
-		dest64 := uint64(dest)
-		result64 := src64 + dest64
-		if result64 > 0xFFFFFFFF {
-			cpu.sr |= (FlagC | FlagX)
-		} else {
-			cpu.sr &^= (FlagC | FlagX)
-		}
+	// Carry out of the most significant bit: (Sm & Dm) | (!Rm & (Sm | Dm))
+	if (sm && dm) || (!rm && (sm || dm)) {
+		cpu.sr |= (FlagC | FlagX)
+	} else {
+		cpu.sr &^= (FlagC | FlagX)
 	}
 
 	// Overflow: (Sm & Dm & !Rm) | (!Sm & !Dm & Rm)
@@ -120,44 +143,23 @@ func (cpu *CPU) setFlagsAdd(dest, src, result uint32, size int) {
 	}
 
 	// Set N and Z
-	cpu.setFlagsLogical(result, size)
+	cpu.setFlagsNZ(result, size)
 }
 
-// setFlagsSub sets condition codes for subtraction
+// setFlagsSub sets condition codes for subtraction. Like setFlagsAdd, the
+// borrow is derived from the sign bits, so it also holds for SUBX, whose
+// result includes X.
 func (cpu *CPU) setFlagsSub(dest, src, result uint32, size int) {
-	var sm, dm, rm bool
+	msb := uint32(1) << uint(size-1)
+	sm := src&msb != 0
+	dm := dest&msb != 0
+	rm := result&msb != 0
 
-	switch size {
-	case 8:
-		sm = (src & 0x80) != 0
-		dm = (dest & 0x80) != 0
-		rm = (result & 0x80) != 0
-		// Carry (borrow)
-		if result&0x100 != 0 {
-			cpu.sr |= (FlagC | FlagX)
-		} else {
-			cpu.sr &^= (FlagC | FlagX)
-		}
-	case 16:
-		sm = (src & 0x8000) != 0
-		dm = (dest & 0x8000) != 0
-		rm = (result & 0x8000) != 0
-		// Carry (borrow)
-		if result&0x10000 != 0 {
-			cpu.sr |= (FlagC | FlagX)
-		} else {
-			cpu.sr &^= (FlagC | FlagX)
-		}
-	case 32:
-		sm = (src & 0x80000000) != 0
-		dm = (dest & 0x80000000) != 0
-		rm = (result & 0x80000000) != 0
-		// Carry (borrow)
-		if src > dest {
-			cpu.sr |= (FlagC | FlagX)
-		} else {
-			cpu.sr &^= (FlagC | FlagX)
-		}
+	// Borrow into the most significant bit: (Sm & !Dm) | (Rm & !Dm) | (Sm & Rm)
+	if (sm && !dm) || (rm && !dm) || (sm && rm) {
+		cpu.sr |= (FlagC | FlagX)
+	} else {
+		cpu.sr &^= (FlagC | FlagX)
 	}
 
 	// Overflow: (!Sm & Dm & !Rm) | (Sm & !Dm & Rm)
@@ -168,7 +170,15 @@ func (cpu *CPU) setFlagsSub(dest, src, result uint32, size int) {
 	}
 
 	// Set N and Z
-	cpu.setFlagsLogical(result, size)
+	cpu.setFlagsNZ(result, size)
+}
+
+// setFlagsCmp sets condition codes for comparisons.
+// Same as subtraction, except that X is not affected.
+func (cpu *CPU) setFlagsCmp(dest, src, result uint32, size int) {
+	x := cpu.sr & FlagX
+	cpu.setFlagsSub(dest, src, result, size)
+	cpu.sr = (cpu.sr &^ FlagX) | x
 }
 
 // testCondition tests a condition code
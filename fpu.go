@@ -0,0 +1,421 @@
+package musashi
+
+// fpu.go - Floating-point unit (68881/68882 and 68040 FPU)
+
+import "math"
+
+// FPU data formats (source/destination specifier of the command word)
+const (
+	fpFormatLong     = 0 // 32-bit integer
+	fpFormatSingle   = 1 // Single precision real
+	fpFormatExtended = 2 // Extended precision real
+	fpFormatPacked   = 3 // Packed decimal real (not supported)
+	fpFormatWord     = 4 // 16-bit integer
+	fpFormatDouble   = 5 // Double precision real
+	fpFormatByte     = 6 // 8-bit integer
+)
+
+// FPU arithmetic operations (opmode field of the command word)
+const (
+	fpOpMOVE = 0x00
+	fpOpINT  = 0x01
+	fpOpSQRT = 0x04
+	fpOpABS  = 0x18
+	fpOpNEG  = 0x1A
+	fpOpDIV  = 0x20
+	fpOpADD  = 0x22
+	fpOpMUL  = 0x23
+	fpOpSUB  = 0x28
+	fpOpCMP  = 0x38
+	fpOpTST  = 0x3A
+)
+
+// FPSR condition code bits
+const (
+	fpccNaN = 0x01000000 // Not a number
+	fpccI   = 0x02000000 // Infinity
+	fpccZ   = 0x04000000 // Zero
+	fpccN   = 0x08000000 // Negative
+	fpccAll = fpccNaN | fpccI | fpccZ | fpccN
+)
+
+// FPU control register select bits of FMOVE to/from control registers
+const (
+	fpCtrlFPIAR = 0x1
+	fpCtrlFPSR  = 0x2
+	fpCtrlFPCR  = 0x4
+)
+
+// fpOpCycles approximates the cost of each register-to-register operation
+var fpOpCycles = map[uint16]int{
+	fpOpMOVE: 4,
+	fpOpINT:  4,
+	fpOpSQRT: 109,
+	fpOpABS:  3,
+	fpOpNEG:  3,
+	fpOpDIV:  43,
+	fpOpADD:  9,
+	fpOpMUL:  11,
+	fpOpSUB:  9,
+	fpOpCMP:  7,
+	fpOpTST:  7,
+}
+
+// hasFPU reports whether the CPU has an on-chip FPU or an attached
+// 68881/68882 coprocessor
+func (cpu *CPU) hasFPU() bool {
+	switch cpu.cpuType {
+	case CPU68020, CPU68EC030, CPU68030, CPU68040:
+		return true
+	}
+	return false
+}
+
+// resetFPU puts the FPU in its reset state: FP0-FP7 hold NaN and the
+// control registers are cleared
+func (cpu *CPU) resetFPU() {
+	for i := range cpu.fp {
+		cpu.fp[i] = math.NaN()
+	}
+	cpu.fpcr = 0
+	cpu.fpsr = 0
+	cpu.fpiar = 0
+}
+
+// GetFPRegister returns floating-point register FPn (0-7)
+func (cpu *CPU) GetFPRegister(n int) float64 {
+	if n < 0 || n > 7 {
+		return 0
+	}
+	return cpu.fp[n]
+}
+
+// SetFPRegister sets floating-point register FPn (0-7)
+func (cpu *CPU) SetFPRegister(n int, value float64) {
+	if n < 0 || n > 7 {
+		return
+	}
+	cpu.fp[n] = value
+}
+
+// decodeF handles line F opcodes
+func decodeF(opcode uint16) opHandler {
+	switch opcode & 0x0FC0 {
+	case 0x0000: // Coprocessor ID 0 (MMU), general instruction type
+		return (*CPU).opPMMU
+	case 0x0200: // Coprocessor ID 1 (FPU), general instruction type
+		return (*CPU).opFPUGeneral
+	case 0x0600: // Coprocessor ID 3, used by the 68040 for MOVE16
+		if opcode&0xFFE0 == 0xF600 || opcode&0xFFF8 == 0xF620 {
+			return (*CPU).opMOVE16
+		}
+	}
+	return (*CPU).opIllegal
+}
+
+// FPU general instruction (cp-id 1)
+func (cpu *CPU) opFPUGeneral(opcode uint16) {
+	// Format: 1111 0010 00EE Emmm + command word ccc sss ddd ooooooo
+	// ccc = opclass, sss = source specifier, ddd = destination register
+	if !cpu.hasFPU() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	cmd := cpu.readImmediate16()
+	src := int((cmd >> 10) & 7)
+	dst := int((cmd >> 7) & 7)
+
+	switch cmd >> 13 {
+	case 0: // FPm to FPn
+		cpu.fpArithmetic(cmd&0x7F, cpu.fp[src], dst)
+	case 2: // <ea> to FPn
+		value, ok := cpu.fpReadOperand(eaMode, eaReg, src)
+		if !ok {
+			cpu.fpUnimplemented(opcode)
+			return
+		}
+		cpu.fpArithmetic(cmd&0x7F, value, dst)
+	case 3: // FMOVE FPn to <ea>
+		if !cpu.fpWriteOperand(eaMode, eaReg, src, cpu.fp[dst]) {
+			cpu.fpUnimplemented(opcode)
+			return
+		}
+		cpu.useCycles(4)
+	case 4: // FMOVE(M) <ea> to control registers
+		cpu.fpMoveControl(eaMode, eaReg, src, false)
+	case 5: // FMOVE(M) control registers to <ea>
+		cpu.fpMoveControl(eaMode, eaReg, src, true)
+	default: // FMOVEM of data registers is not supported
+		cpu.fpUnimplemented(opcode)
+	}
+}
+
+// fpUnimplemented takes a line F exception for an FPU operation that is
+// not emulated. PC is rewound to just past the opcode, as the illegal
+// instruction callback expects.
+func (cpu *CPU) fpUnimplemented(opcode uint16) {
+	cpu.pc = cpu.ppc + 2
+	cpu.opIllegal(opcode)
+}
+
+// fpArithmetic performs a monadic or dyadic operation with the given
+// source operand on FPn and sets the FPSR condition codes
+func (cpu *CPU) fpArithmetic(op uint16, src float64, dst int) {
+	cycles, ok := fpOpCycles[op]
+	if !ok {
+		cpu.fpUnimplemented(cpu.ir)
+		return
+	}
+	cpu.fpiar = cpu.ppc
+
+	result := src
+	switch op {
+	case fpOpINT:
+		result = cpu.fpRound(src)
+	case fpOpSQRT:
+		result = math.Sqrt(src)
+	case fpOpABS:
+		result = math.Abs(src)
+	case fpOpNEG:
+		result = -src
+	case fpOpDIV:
+		result = cpu.fp[dst] / src
+	case fpOpADD:
+		result = cpu.fp[dst] + src
+	case fpOpMUL:
+		result = cpu.fp[dst] * src
+	case fpOpSUB:
+		result = cpu.fp[dst] - src
+	case fpOpCMP:
+		result = cpu.fp[dst] - src
+	}
+
+	cpu.setFPCC(result)
+	if op != fpOpCMP && op != fpOpTST {
+		cpu.fp[dst] = result
+	}
+	cpu.useCycles(cycles)
+}
+
+// setFPCC sets the FPSR condition code byte from a result
+func (cpu *CPU) setFPCC(value float64) {
+	cpu.fpsr &^= fpccAll
+	switch {
+	case math.IsNaN(value):
+		cpu.fpsr |= fpccNaN
+	case math.IsInf(value, 0):
+		cpu.fpsr |= fpccI
+	case value == 0:
+		cpu.fpsr |= fpccZ
+	}
+	if math.Signbit(value) {
+		cpu.fpsr |= fpccN
+	}
+}
+
+// fpRound rounds to an integer using the FPCR rounding mode
+func (cpu *CPU) fpRound(value float64) float64 {
+	switch (cpu.fpcr >> 4) & 3 {
+	case 1: // Toward zero
+		return math.Trunc(value)
+	case 2: // Toward minus infinity
+		return math.Floor(value)
+	case 3: // Toward plus infinity
+		return math.Ceil(value)
+	default: // To nearest
+		return math.RoundToEven(value)
+	}
+}
+
+// fpFormatSize returns the size in bits of a memory operand of the given
+// format, or 0 if the format is not supported
+func fpFormatSize(format int) int {
+	switch format {
+	case fpFormatLong, fpFormatSingle:
+		return 32
+	case fpFormatWord:
+		return 16
+	case fpFormatByte:
+		return 8
+	case fpFormatDouble:
+		return 64
+	case fpFormatExtended:
+		return 96
+	}
+	return 0
+}
+
+// fpReadOperand reads a source operand of the given format and converts
+// it to a float. ok is false if the format or addressing mode is invalid.
+func (cpu *CPU) fpReadOperand(mode, reg, format int) (value float64, ok bool) {
+	size := fpFormatSize(format)
+	if size == 0 || mode == 1 || (mode == 0 && size > 32) {
+		return 0, false
+	}
+
+	switch format {
+	case fpFormatLong:
+		return float64(int32(cpu.readEA(mode, reg, 32))), true
+	case fpFormatWord:
+		return float64(int16(cpu.readEA(mode, reg, 16))), true
+	case fpFormatByte:
+		return float64(int8(cpu.readEA(mode, reg, 8))), true
+	case fpFormatSingle:
+		return float64(math.Float32frombits(cpu.readEA(mode, reg, 32))), true
+	}
+
+	// Double and extended operands are read as a sequence of longs, from
+	// the instruction stream for immediates
+	var words [3]uint32
+	n := size / 32
+	if mode == 7 && reg == 4 {
+		for i := 0; i < n; i++ {
+			words[i] = cpu.readImmediate32()
+		}
+	} else {
+		addr := cpu.calcEA(mode, reg, size)
+		for i := 0; i < n; i++ {
+			words[i] = cpu.readMem(addr+uint32(i*4), 32)
+		}
+	}
+
+	if format == fpFormatDouble {
+		return math.Float64frombits(uint64(words[0])<<32 | uint64(words[1])), true
+	}
+	return extendedToFloat(uint16(words[0]>>16), uint64(words[1])<<32|uint64(words[2])), true
+}
+
+// fpWriteOperand converts a float to the given format and writes it to a
+// destination operand. Returns false if the format or mode is invalid.
+func (cpu *CPU) fpWriteOperand(mode, reg, format int, value float64) bool {
+	size := fpFormatSize(format)
+	if size == 0 || mode == 1 || (mode == 0 && size > 32) || (mode == 7 && reg >= 2) {
+		return false
+	}
+
+	switch format {
+	case fpFormatLong:
+		cpu.writeEA(mode, reg, 32, uint32(cpu.fpToInt(value, math.MinInt32, math.MaxInt32)))
+		return true
+	case fpFormatWord:
+		cpu.writeEA(mode, reg, 16, uint32(cpu.fpToInt(value, math.MinInt16, math.MaxInt16)))
+		return true
+	case fpFormatByte:
+		cpu.writeEA(mode, reg, 8, uint32(cpu.fpToInt(value, math.MinInt8, math.MaxInt8)))
+		return true
+	case fpFormatSingle:
+		cpu.writeEA(mode, reg, 32, math.Float32bits(float32(value)))
+		return true
+	}
+
+	var words [3]uint32
+	if format == fpFormatDouble {
+		bits := math.Float64bits(value)
+		words[0], words[1] = uint32(bits>>32), uint32(bits)
+	} else {
+		exp, mant := floatToExtended(value)
+		words[0], words[1], words[2] = uint32(exp)<<16, uint32(mant>>32), uint32(mant)
+	}
+	addr := cpu.calcEA(mode, reg, size)
+	for i := 0; i < size/32; i++ {
+		cpu.writeMem(addr+uint32(i*4), words[i], 32)
+	}
+	return true
+}
+
+// fpToInt rounds a float to an integer with the FPCR rounding mode,
+// saturating at the limits of the destination format
+func (cpu *CPU) fpToInt(value float64, min, max int64) int64 {
+	switch {
+	case math.IsNaN(value):
+		return max
+	case value <= float64(min):
+		return min
+	case value >= float64(max):
+		return max
+	}
+	return int64(cpu.fpRound(value))
+}
+
+// extendedToFloat converts an extended precision real (sign and exponent
+// word, explicit-integer-bit mantissa) to the nearest float64
+func extendedToFloat(se uint16, mant uint64) float64 {
+	exp := int(se & 0x7FFF)
+	var value float64
+	if exp == 0x7FFF {
+		if mant<<1 != 0 {
+			value = math.NaN()
+		} else {
+			value = math.Inf(1)
+		}
+	} else {
+		value = math.Ldexp(float64(mant), exp-16383-63)
+	}
+	if se&0x8000 != 0 {
+		value = -value
+	}
+	return value
+}
+
+// floatToExtended converts a float64 to an extended precision real
+func floatToExtended(value float64) (se uint16, mant uint64) {
+	if math.Signbit(value) {
+		se = 0x8000
+	}
+	switch {
+	case math.IsNaN(value):
+		return se | 0x7FFF, 0xFFFFFFFFFFFFFFFF
+	case math.IsInf(value, 0):
+		return se | 0x7FFF, 0
+	case value == 0:
+		return se, 0
+	}
+	frac, exp := math.Frexp(math.Abs(value))
+	return se | uint16(exp-1+16383), uint64(math.Ldexp(frac, 64))
+}
+
+// fpMoveControl moves the FPCR, FPSR and FPIAR registers selected by list
+// to or from an operand. A single register may be in a data register (or,
+// for FPIAR, an address register); several are stored in consecutive longs.
+func (cpu *CPU) fpMoveControl(mode, reg, list int, toEA bool) {
+	var regs []*uint32
+	if list&fpCtrlFPCR != 0 {
+		regs = append(regs, &cpu.fpcr)
+	}
+	if list&fpCtrlFPSR != 0 {
+		regs = append(regs, &cpu.fpsr)
+	}
+	if list&fpCtrlFPIAR != 0 {
+		regs = append(regs, &cpu.fpiar)
+	}
+
+	switch {
+	case len(regs) == 0:
+		// An empty list moves FPIAR
+		regs = append(regs, &cpu.fpiar)
+		fallthrough
+	case len(regs) == 1:
+		if toEA {
+			cpu.writeEA(mode, reg, 32, *regs[0])
+		} else {
+			*regs[0] = cpu.readEA(mode, reg, 32)
+		}
+	case mode <= 1:
+		cpu.fpUnimplemented(cpu.ir)
+		return
+	default:
+		addr := cpu.calcEA(mode, reg, 32*len(regs))
+		for i, r := range regs {
+			if toEA {
+				cpu.writeMem(addr+uint32(i*4), *r, 32)
+			} else {
+				*r = cpu.readMem(addr+uint32(i*4), 32)
+			}
+		}
+	}
+
+	cpu.useCycles(4 * len(regs))
+}
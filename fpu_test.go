@@ -0,0 +1,165 @@
+package musashi
+
+import (
+	"math"
+	"testing"
+)
+
+// TestFMOVEDouble tests FMOVE.D between memory and an FP register
+func TestFMOVEDouble(t *testing.T) {
+	cpu := NewCPU(CPU68040)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// FMOVE.D (A0),FP0 = 0xF210 0x5400
+	memory.Write16(0x400, 0xF210)
+	memory.Write16(0x402, 0x5400)
+	// FMOVE.D FP0,(A1) = 0xF211 0x7400
+	memory.Write16(0x404, 0xF211)
+	memory.Write16(0x406, 0x7400)
+
+	memory.Write32(0x2000, 0xC00921FB) // -3.141592653589793
+	memory.Write32(0x2004, 0x54442D18)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+	cpu.a[1] = 0x3000
+
+	cpu.Step()
+	if got := cpu.GetFPRegister(0); got != -math.Pi {
+		t.Errorf("Expected FP0 = %v, got %v", -math.Pi, got)
+	}
+	if cpu.fpsr&fpccN == 0 {
+		t.Error("FPSR N should be set for a negative operand")
+	}
+
+	cpu.Step()
+	if hi, lo := memory.Read32(0x3000), memory.Read32(0x3004); hi != 0xC00921FB || lo != 0x54442D18 {
+		t.Errorf("Expected $C00921FB54442D18 stored, got $%08X%08X", hi, lo)
+	}
+	if cpu.pc != 0x408 {
+		t.Errorf("Expected PC = 0x408, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestFADD tests FADD from memory and between FP registers
+func TestFADD(t *testing.T) {
+	cpu := NewCPU(CPU68040)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// FMOVE.D (A0),FP0 = 0xF210 0x5400
+	memory.Write16(0x400, 0xF210)
+	memory.Write16(0x402, 0x5400)
+	// FADD.D (A1),FP0 = 0xF211 0x5422
+	memory.Write16(0x404, 0xF211)
+	memory.Write16(0x406, 0x5422)
+	// FADD.X FP0,FP1 = 0xF200 0x00A2
+	memory.Write16(0x408, 0xF200)
+	memory.Write16(0x40A, 0x00A2)
+
+	memory.Write32(0x2000, 0x3FB99999) // 0.1
+	memory.Write32(0x2004, 0x9999999A)
+	memory.Write32(0x2008, 0x3FC99999) // 0.2
+	memory.Write32(0x200C, 0x9999999A)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+	cpu.a[1] = 0x2008
+	cpu.SetFPRegister(1, -0.30000000000000004)
+
+	cpu.Step()
+	cpu.Step()
+	if bits := math.Float64bits(cpu.GetFPRegister(0)); bits != 0x3FD3333333333334 {
+		t.Errorf("Expected 0.1 + 0.2 = $3FD3333333333334, got $%016X", bits)
+	}
+
+	cpu.Step()
+	if got := cpu.GetFPRegister(1); got != 0 {
+		t.Errorf("Expected FP1 = 0, got %v", got)
+	}
+	if cpu.fpsr&fpccZ == 0 {
+		t.Error("FPSR Z should be set for a zero result")
+	}
+}
+
+// TestFPUAbsent tests that FPU opcodes trap on CPUs without an FPU
+func TestFPUAbsent(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorLineF*4, 0x00000800)
+
+	// FADD.X FP0,FP1
+	memory.Write16(0x400, 0xF200)
+	memory.Write16(0x402, 0x00A2)
+
+	cpu.Reset()
+	cpu.Step()
+
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected line F exception handler at 0x800, got PC 0x%08X", cpu.pc)
+	}
+}
+
+// TestFMOVEControl tests FMOVE to and from FPCR and integer conversion
+func TestFMOVEControl(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// FMOVE.L D0,FPCR = 0xF200 0x9000
+	memory.Write16(0x400, 0xF200)
+	memory.Write16(0x402, 0x9000)
+	// FMOVE.L D1,FP2 = 0xF201 0x4100
+	memory.Write16(0x404, 0xF201)
+	memory.Write16(0x406, 0x4100)
+	// FMOVE.L FP2,D2 = 0xF202 0x6100
+	memory.Write16(0x408, 0xF202)
+	memory.Write16(0x40A, 0x6100)
+
+	cpu.Reset()
+	cpu.d[0] = 0x00000010 // Round toward zero
+	cpu.d[1] = 0xFFFFFFF9 // -7
+
+	cpu.Step()
+	if cpu.fpcr != 0x10 {
+		t.Errorf("Expected FPCR = 0x10, got 0x%08X", cpu.fpcr)
+	}
+
+	cpu.Step()
+	if got := cpu.GetFPRegister(2); got != -7 {
+		t.Errorf("Expected FP2 = -7, got %v", got)
+	}
+
+	cpu.SetFPRegister(2, -7.9)
+	cpu.Step()
+	if cpu.d[2] != 0xFFFFFFF9 {
+		t.Errorf("Expected D2 = -7 (rounded toward zero), got 0x%08X", cpu.d[2])
+	}
+}
+
+// TestExtendedConversion tests the extended precision format round trip
+func TestExtendedConversion(t *testing.T) {
+	for _, v := range []float64{1, -2.5, math.Pi, 1e300, -1e-300} {
+		se, mant := floatToExtended(v)
+		if got := extendedToFloat(se, mant); got != v {
+			t.Errorf("Extended round trip of %v gave %v", v, got)
+		}
+	}
+	if se, mant := floatToExtended(1); se != 0x3FFF || mant != 0x8000000000000000 {
+		t.Errorf("Expected 1.0 = $3FFF 8000000000000000, got $%04X %016X", se, mant)
+	}
+}
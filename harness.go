@@ -0,0 +1,75 @@
+package musashi
+
+// harness.go - Convenience helpers for running small programs and opcodes
+
+// runProgramStack is the minimum space left above the program for the
+// supervisor stack
+const runProgramStack = 0x1000
+
+// RunProgram runs a program on a fresh CPU with its own RAM, for tests and
+// experiments. The code is loaded at loadAddr, the reset vectors point the
+// PC at entry and the SSP at the top of the RAM, and the CPU is reset and
+// run for maxCycles. The RAM is at least 64KB and large enough for the code
+// and a 4KB stack; the vectors occupy addresses 0-7, so loadAddr should be
+// above them. The returned CPU can be inspected or run further, and its RAM
+// is available from GetMemoryHandler.
+func RunProgram(cpuType CPUType, code []byte, loadAddr, entry uint32, maxCycles int) *CPU {
+	size := loadAddr + uint32(len(code)) + runProgramStack
+	if size < 0x10000 {
+		size = 0x10000
+	}
+	ram := NewRAM(size)
+	ram.Load(loadAddr, code)
+	ram.Write32(0, ram.Size())
+	ram.Write32(4, entry)
+
+	cpu := NewCPU(cpuType)
+	cpu.SetMemoryHandler(ram)
+	cpu.Reset()
+	cpu.Execute(maxCycles)
+	return cpu
+}
+
+// ExecuteOpcode executes a single instruction from the current state, for
+// comparing opcodes against a reference implementation. The opcode and its
+// extension words are read from a scratch stream instead of memory, as if
+// located at the current PC; operands are still accessed through the
+// memory handler. Interrupts, breakpoints and hooks are skipped. Returns
+// the cycles the instruction took.
+func (cpu *CPU) ExecuteOpcode(opcode uint16, extWords []uint16) int {
+	if cpu.memory == nil {
+		return 0
+	}
+
+	cpu.cyclesRun = 0
+	cpu.cyclesRemain = 0
+	cpu.stopReason = StopBudget
+
+	cpu.ppc = cpu.pc
+	cpu.ir = opcode
+	cpu.pc += 2
+	cpu.scratch = extWords
+	cpu.scratchActive = true
+	func() {
+		cpu.beginInstruction()
+		defer cpu.endInstruction()
+		cpu.decodeAndExecute(opcode)
+	}()
+	cpu.scratch = nil
+	cpu.scratchActive = false
+	cpu.prefetchValid = false
+
+	return cpu.cyclesRun
+}
+
+// fetchScratch reads the next word of the ExecuteOpcode stream. Reading
+// past its end returns 0.
+func (cpu *CPU) fetchScratch() uint16 {
+	var value uint16
+	if len(cpu.scratch) > 0 {
+		value = cpu.scratch[0]
+		cpu.scratch = cpu.scratch[1:]
+	}
+	cpu.pc += 2
+	return value
+}
@@ -3,7 +3,7 @@ package musashi
 // instructions.go - Core M68000 instruction implementations
 
 // NOP - No Operation (0x4E71)
-func (cpu *CPU) opNOP() {
+func (cpu *CPU) opNOP(opcode uint16) {
 	cpu.useCycles(4)
 }
 
@@ -73,6 +73,12 @@ func (cpu *CPU) opADD(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
+	// Address registers have no byte form
+	if eaMode == 1 && size == 8 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
 	if direction == 0 {
 		// EA + Dn -> Dn
 		src := cpu.readEA(eaMode, eaReg, size)
@@ -83,10 +89,10 @@ func (cpu *CPU) opADD(opcode uint16) {
 	} else {
 		// Dn + EA -> EA
 		src := maskValue(cpu.d[dataReg], size)
-		dest := cpu.readEA(eaMode, eaReg, size)
+		dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 		result := dest + src
 		cpu.setFlagsAdd(dest, src, result, size)
-		cpu.writeEA(eaMode, eaReg, size, result)
+		cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 	}
 
 	cpu.useCycles(4)
@@ -103,6 +109,8 @@ func (cpu *CPU) opADDA(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
+	// Only word and long sizes exist; a word source is sign-extended and
+	// the whole register is updated, without affecting the flags
 	src := cpu.readEA(eaMode, eaReg, size)
 	if size == 16 {
 		src = signExtend16(src)
@@ -121,11 +129,11 @@ func (cpu *CPU) opADDI(opcode uint16) {
 	eaReg := int(opcode & 7)
 
 	src := cpu.readEA(7, 4, size) // Mode 7, reg 4 = immediate
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := dest + src
 
 	cpu.setFlagsAdd(dest, src, result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(8)
 }
@@ -141,16 +149,32 @@ func (cpu *CPU) opADDQ(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
-	if eaMode == 1 { // Address register - no flags
+	if eaMode == 1 {
+		// Address register: always the full 32 bits, no flags, no byte size
+		if size == 8 {
+			cpu.opIllegal(opcode)
+			return
+		}
 		cpu.a[eaReg] += data
-	} else {
-		dest := cpu.readEA(eaMode, eaReg, size)
-		result := dest + data
-		cpu.setFlagsAdd(dest, data, result, size)
-		cpu.writeEA(eaMode, eaReg, size, result)
+		cpu.useCycles(8)
+		return
 	}
 
-	cpu.useCycles(4)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
+	result := dest + data
+	cpu.setFlagsAdd(dest, data, result, size)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
+
+	switch {
+	case eaMode == 0 && size == 32:
+		cpu.useCycles(8)
+	case eaMode == 0:
+		cpu.useCycles(4)
+	case size == 32:
+		cpu.useCycles(12)
+	default:
+		cpu.useCycles(8)
+	}
 }
 
 // SUB - Subtract
@@ -161,6 +185,12 @@ func (cpu *CPU) opSUB(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
+	// Address registers have no byte form
+	if eaMode == 1 && size == 8 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
 	if direction == 0 {
 		// Dn - EA -> Dn
 		dest := maskValue(cpu.d[dataReg], size)
@@ -170,11 +200,11 @@ func (cpu *CPU) opSUB(opcode uint16) {
 		cpu.writeEA(0, dataReg, size, result)
 	} else {
 		// EA - Dn -> EA
-		dest := cpu.readEA(eaMode, eaReg, size)
+		dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 		src := maskValue(cpu.d[dataReg], size)
 		result := dest - src
 		cpu.setFlagsSub(dest, src, result, size)
-		cpu.writeEA(eaMode, eaReg, size, result)
+		cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 	}
 
 	cpu.useCycles(4)
@@ -190,6 +220,8 @@ func (cpu *CPU) opSUBA(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
+	// Only word and long sizes exist; a word source is sign-extended and
+	// the whole register is updated, without affecting the flags
 	src := cpu.readEA(eaMode, eaReg, size)
 	if size == 16 {
 		src = signExtend16(src)
@@ -207,11 +239,11 @@ func (cpu *CPU) opSUBI(opcode uint16) {
 	eaReg := int(opcode & 7)
 
 	src := cpu.readEA(7, 4, size)
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := dest - src
 
 	cpu.setFlagsSub(dest, src, result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(8)
 }
@@ -226,16 +258,32 @@ func (cpu *CPU) opSUBQ(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
-	if eaMode == 1 { // Address register - no flags
+	if eaMode == 1 {
+		// Address register: always the full 32 bits, no flags, no byte size
+		if size == 8 {
+			cpu.opIllegal(opcode)
+			return
+		}
 		cpu.a[eaReg] -= data
-	} else {
-		dest := cpu.readEA(eaMode, eaReg, size)
-		result := dest - data
-		cpu.setFlagsSub(dest, data, result, size)
-		cpu.writeEA(eaMode, eaReg, size, result)
+		cpu.useCycles(8)
+		return
 	}
 
-	cpu.useCycles(4)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
+	result := dest - data
+	cpu.setFlagsSub(dest, data, result, size)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
+
+	switch {
+	case eaMode == 0 && size == 32:
+		cpu.useCycles(8)
+	case eaMode == 0:
+		cpu.useCycles(4)
+	case size == 32:
+		cpu.useCycles(12)
+	default:
+		cpu.useCycles(8)
+	}
 }
 
 // AND - Logical AND
@@ -256,10 +304,10 @@ func (cpu *CPU) opAND(opcode uint16) {
 	} else {
 		// Dn & EA -> EA
 		src := maskValue(cpu.d[dataReg], size)
-		dest := cpu.readEA(eaMode, eaReg, size)
+		dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 		result := dest & src
 		cpu.setFlagsLogical(result, size)
-		cpu.writeEA(eaMode, eaReg, size, result)
+		cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 	}
 
 	cpu.useCycles(4)
@@ -272,11 +320,11 @@ func (cpu *CPU) opANDI(opcode uint16) {
 	eaReg := int(opcode & 7)
 
 	src := cpu.readEA(7, 4, size)
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := dest & src
 
 	cpu.setFlagsLogical(result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(8)
 }
@@ -299,10 +347,10 @@ func (cpu *CPU) opOR(opcode uint16) {
 	} else {
 		// Dn | EA -> EA
 		src := maskValue(cpu.d[dataReg], size)
-		dest := cpu.readEA(eaMode, eaReg, size)
+		dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 		result := dest | src
 		cpu.setFlagsLogical(result, size)
-		cpu.writeEA(eaMode, eaReg, size, result)
+		cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 	}
 
 	cpu.useCycles(4)
@@ -315,11 +363,11 @@ func (cpu *CPU) opORI(opcode uint16) {
 	eaReg := int(opcode & 7)
 
 	src := cpu.readEA(7, 4, size)
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := dest | src
 
 	cpu.setFlagsLogical(result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(8)
 }
@@ -332,13 +380,22 @@ func (cpu *CPU) opEOR(opcode uint16) {
 	eaReg := int(opcode & 7)
 
 	src := maskValue(cpu.d[dataReg], size)
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := dest ^ src
 
 	cpu.setFlagsLogical(result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
-	cpu.useCycles(4)
+	switch {
+	case eaMode == 0 && size == 32:
+		cpu.useCycles(8)
+	case eaMode == 0:
+		cpu.useCycles(4)
+	case size == 32:
+		cpu.useCycles(12)
+	default:
+		cpu.useCycles(8)
+	}
 }
 
 // EORI - EOR immediate
@@ -348,11 +405,11 @@ func (cpu *CPU) opEORI(opcode uint16) {
 	eaReg := int(opcode & 7)
 
 	src := cpu.readEA(7, 4, size)
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := dest ^ src
 
 	cpu.setFlagsLogical(result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(8)
 }
@@ -363,11 +420,11 @@ func (cpu *CPU) opNOT(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := ^dest
 
 	cpu.setFlagsLogical(result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(4)
 }
@@ -393,11 +450,11 @@ func (cpu *CPU) opNEG(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
-	dest := cpu.readEA(eaMode, eaReg, size)
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
 	result := uint32(0) - dest
 
 	cpu.setFlagsSub(0, dest, result, size)
-	cpu.writeEA(eaMode, eaReg, size, result)
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 
 	cpu.useCycles(4)
 }
@@ -409,6 +466,12 @@ func (cpu *CPU) opCMP(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
+	// Address registers have no byte form
+	if eaMode == 1 && size == 8 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
 	dest := maskValue(cpu.d[dataReg], size)
 	src := cpu.readEA(eaMode, eaReg, size)
 	result := dest - src
@@ -428,6 +491,7 @@ func (cpu *CPU) opCMPA(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
 
+	// The word form sign-extends the source; both forms compare all 32 bits
 	dest := cpu.a[addrReg]
 	src := cpu.readEA(eaMode, eaReg, size)
 	if size == 16 {
@@ -435,7 +499,7 @@ func (cpu *CPU) opCMPA(opcode uint16) {
 	}
 	result := dest - src
 
-	cpu.setFlagsSub(dest, src, result, 32)
+	cpu.setFlagsCmp(dest, src, result, 32)
 
 	cpu.useCycles(6)
 }
@@ -471,59 +535,12 @@ func (cpu *CPU) opTST(opcode uint16) {
 func (cpu *CPU) opJMP(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
-
-	// Calculate EA (for control addressing modes)
-	var addr uint32
-
-	switch eaMode {
-	case 2: // (An)
-		addr = cpu.a[eaReg]
-	case 5: // (d16,An)
-		disp := signExtend16(uint32(cpu.readImmediate16()))
-		addr = cpu.a[eaReg] + disp
-	case 6: // (d8,An,Xn)
-		ext := uint32(cpu.readImmediate16())
-		disp := signExtend8(ext & 0xFF)
-		xn := int((ext >> 12) & 0x0F)
-		var index uint32
-		if ext&0x8000 != 0 {
-			index = cpu.a[xn&7]
-		} else {
-			index = cpu.d[xn&7]
-		}
-		if ext&0x800 == 0 {
-			index = signExtend16(index)
-		}
-		addr = cpu.a[eaReg] + disp + index
-	case 7:
-		switch eaReg {
-		case 0: // (xxx).W
-			addr = signExtend16(uint32(cpu.readImmediate16()))
-		case 1: // (xxx).L
-			addr = cpu.readImmediate32()
-		case 2: // (d16,PC)
-			oldPC := cpu.pc
-			disp := signExtend16(uint32(cpu.readImmediate16()))
-			addr = oldPC + disp
-		case 3: // (d8,PC,Xn)
-			oldPC := cpu.pc
-			ext := uint32(cpu.readImmediate16())
-			disp := signExtend8(ext & 0xFF)
-			xn := int((ext >> 12) & 0x0F)
-			var index uint32
-			if ext&0x8000 != 0 {
-				index = cpu.a[xn&7]
-			} else {
-				index = cpu.d[xn&7]
-			}
-			if ext&0x800 == 0 {
-				index = signExtend16(index)
-			}
-			addr = oldPC + disp + index
-		}
+	if !controlMode(eaMode, eaReg) {
+		cpu.opIllegal(opcode)
+		return
 	}
 
-	cpu.pc = addr
+	cpu.setPC(cpu.calcEA(eaMode, eaReg, 32))
 	cpu.useCycles(8)
 }
 
@@ -531,95 +548,63 @@ func (cpu *CPU) opJMP(opcode uint16) {
 func (cpu *CPU) opJSR(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
-
-	// Calculate EA (same as JMP)
-	var addr uint32
-
-	switch eaMode {
-	case 2: // (An)
-		addr = cpu.a[eaReg]
-	case 5: // (d16,An)
-		disp := signExtend16(uint32(cpu.readImmediate16()))
-		addr = cpu.a[eaReg] + disp
-	case 6: // (d8,An,Xn)
-		ext := uint32(cpu.readImmediate16())
-		disp := signExtend8(ext & 0xFF)
-		xn := int((ext >> 12) & 0x0F)
-		var index uint32
-		if ext&0x8000 != 0 {
-			index = cpu.a[xn&7]
-		} else {
-			index = cpu.d[xn&7]
-		}
-		if ext&0x800 == 0 {
-			index = signExtend16(index)
-		}
-		addr = cpu.a[eaReg] + disp + index
-	case 7:
-		switch eaReg {
-		case 0: // (xxx).W
-			addr = signExtend16(uint32(cpu.readImmediate16()))
-		case 1: // (xxx).L
-			addr = cpu.readImmediate32()
-		case 2: // (d16,PC)
-			oldPC := cpu.pc
-			disp := signExtend16(uint32(cpu.readImmediate16()))
-			addr = oldPC + disp
-		case 3: // (d8,PC,Xn)
-			oldPC := cpu.pc
-			ext := uint32(cpu.readImmediate16())
-			disp := signExtend8(ext & 0xFF)
-			xn := int((ext >> 12) & 0x0F)
-			var index uint32
-			if ext&0x8000 != 0 {
-				index = cpu.a[xn&7]
-			} else {
-				index = cpu.d[xn&7]
-			}
-			if ext&0x800 == 0 {
-				index = signExtend16(index)
-			}
-			addr = oldPC + disp + index
-		}
+	if !controlMode(eaMode, eaReg) {
+		cpu.opIllegal(opcode)
+		return
 	}
+	addr := cpu.calcEA(eaMode, eaReg, 32)
 
 	// Push return address
 	cpu.pushLong(cpu.pc)
 
 	// Jump
-	cpu.pc = addr
+	cpu.setPC(addr)
 	cpu.useCycles(16)
 }
 
 // RTS - Return from subroutine
-func (cpu *CPU) opRTS() {
-	cpu.pc = cpu.popLong()
+func (cpu *CPU) opRTS(opcode uint16) {
+	cpu.setPC(cpu.popLong())
 	cpu.useCycles(16)
 }
 
-// BRA - Branch always
-func (cpu *CPU) opBRA(opcode uint16) {
+// branchDisplacement returns the displacement of a BRA/BSR/Bcc. An inline
+// byte of 0x00 selects a 16-bit extension word and, on 68020+, 0xFF selects
+// a 32-bit extension. The displacement is relative to the address of the
+// extension word (the PC after the opcode fetch).
+func (cpu *CPU) branchDisplacement(opcode uint16) int32 {
 	disp := int32(int8(opcode & 0xFF))
 	if disp == 0 {
 		disp = int32(int16(cpu.readImmediate16()))
+	} else if disp == -1 && cpu.is020Plus() {
+		disp = int32(cpu.readImmediate32())
 	}
+	return disp
+}
+
+// BRA - Branch always
+func (cpu *CPU) opBRA(opcode uint16) {
+	base := cpu.pc
+	disp := cpu.branchDisplacement(opcode)
 
-	cpu.pc = uint32(int32(cpu.pc) + disp)
+	cpu.setPC(uint32(int32(base) + disp))
 	cpu.useCycles(10)
 }
 
 // Bcc - Branch conditionally
 func (cpu *CPU) opBcc(opcode uint16) {
 	cond := int((opcode >> 8) & 0x0F)
-	disp := int32(int8(opcode & 0xFF))
-	if disp == 0 {
-		disp = int32(int16(cpu.readImmediate16()))
-	}
+	base := cpu.pc
+	disp := cpu.branchDisplacement(opcode)
 
-	if cpu.testCondition(cond) {
-		cpu.pc = uint32(int32(cpu.pc) + disp)
+	switch {
+	case cpu.testCondition(cond):
+		cpu.setPC(uint32(int32(base) + disp))
 		cpu.useCycles(10)
-	} else {
+	case opcode&0xFF == 0x00 || (opcode&0xFF == 0xFF && cpu.is020Plus()):
+		// Not taken, with a word (or long) displacement to skip
+		cpu.useCycles(12)
+	default:
 		cpu.useCycles(8)
 	}
 }
@@ -628,19 +613,40 @@ func (cpu *CPU) opBcc(opcode uint16) {
 func (cpu *CPU) opDBcc(opcode uint16) {
 	cond := int((opcode >> 8) & 0x0F)
 	reg := int(opcode & 7)
+
+	// The displacement is relative to the address of the extension word
+	base := cpu.pc
 	disp := int32(int16(cpu.readImmediate16()))
 
-	if !cpu.testCondition(cond) {
-		// Decrement and test
-		cpu.d[reg] = (cpu.d[reg] & 0xFFFF0000) | ((cpu.d[reg] - 1) & 0xFFFF)
-		if (cpu.d[reg] & 0xFFFF) != 0xFFFF {
-			cpu.pc = uint32(int32(cpu.pc) + disp - 2)
-			cpu.useCycles(10)
-			return
+	if cpu.testCondition(cond) {
+		// Condition true: fall through without touching the counter
+		cpu.loopMode = false
+		cpu.useCycles(12)
+		return
+	}
+
+	// Condition false: decrement the low word and loop until it reaches -1
+	cpu.d[reg] = (cpu.d[reg] & 0xFFFF0000) | ((cpu.d[reg] - 1) & 0xFFFF)
+	if (cpu.d[reg] & 0xFFFF) != 0xFFFF {
+		cpu.setPC(uint32(int32(base) + disp))
+
+		// The 68010 enters loop mode when a DBcc branches back to the
+		// one-word instruction just before it. From the second iteration
+		// on, neither instruction is refetched and the branch is cheaper.
+		if cpu.cpuType == CPU68010 && disp == -4 {
+			if cpu.loopMode && cpu.loopPC == cpu.ppc {
+				cpu.useCycles(6)
+				return
+			}
+			cpu.loopMode = true
+			cpu.loopPC = cpu.ppc
 		}
+		cpu.useCycles(10)
+		return
 	}
 
-	cpu.useCycles(12)
+	cpu.loopMode = false
+	cpu.useCycles(14)
 }
 
 // Scc - Set according to condition
@@ -656,68 +662,66 @@ func (cpu *CPU) opScc(opcode uint16) {
 		value = 0x00
 	}
 
-	cpu.writeEA(eaMode, eaReg, 8, value)
-	cpu.useCycles(4)
-}
-
-// LEA - Load effective address
-func (cpu *CPU) opLEA(opcode uint16) {
-	addrReg := int((opcode >> 9) & 7)
-	eaMode := int((opcode >> 3) & 7)
-	eaReg := int(opcode & 7)
+	if eaMode == 0 {
+		cpu.writeEA(eaMode, eaReg, 8, value)
+		// Setting a data register takes longer than clearing it
+		if value != 0 {
+			cpu.useCycles(6)
+		} else {
+			cpu.useCycles(4)
+		}
+		return
+	}
 
-	// Calculate EA
-	var addr uint32
+	// The 68000 reads the operand before writing it, so a memory
+	// destination sees a read and a write bus cycle whatever the condition
+	if cpu.cpuType == CPU68000 {
+		_, addr := cpu.readEAModify(eaMode, eaReg, 8)
+		cpu.writeEAModify(eaMode, eaReg, 8, addr, value)
+	} else {
+		cpu.writeEA(eaMode, eaReg, 8, value)
+	}
+	cpu.useCycles(8 + eaTime(eaMode, eaReg))
+}
 
-	switch eaMode {
-	case 2: // (An)
-		addr = cpu.a[eaReg]
+// eaTime returns the 68000 effective address calculation time for a byte
+// or word memory operand
+func eaTime(mode, reg int) int {
+	switch mode {
+	case 2, 3: // (An), (An)+
+		return 4
+	case 4: // -(An)
+		return 6
 	case 5: // (d16,An)
-		disp := signExtend16(uint32(cpu.readImmediate16()))
-		addr = cpu.a[eaReg] + disp
+		return 8
 	case 6: // (d8,An,Xn)
-		ext := uint32(cpu.readImmediate16())
-		disp := signExtend8(ext & 0xFF)
-		xn := int((ext >> 12) & 0x0F)
-		var index uint32
-		if ext&0x8000 != 0 {
-			index = cpu.a[xn&7]
-		} else {
-			index = cpu.d[xn&7]
-		}
-		if ext&0x800 == 0 {
-			index = signExtend16(index)
-		}
-		addr = cpu.a[eaReg] + disp + index
+		return 10
 	case 7:
-		switch eaReg {
-		case 0: // (xxx).W
-			addr = signExtend16(uint32(cpu.readImmediate16()))
+		switch reg {
+		case 0, 2: // (xxx).W, (d16,PC)
+			return 8
 		case 1: // (xxx).L
-			addr = cpu.readImmediate32()
-		case 2: // (d16,PC)
-			oldPC := cpu.pc
-			disp := signExtend16(uint32(cpu.readImmediate16()))
-			addr = oldPC + disp
+			return 12
 		case 3: // (d8,PC,Xn)
-			oldPC := cpu.pc
-			ext := uint32(cpu.readImmediate16())
-			disp := signExtend8(ext & 0xFF)
-			xn := int((ext >> 12) & 0x0F)
-			var index uint32
-			if ext&0x8000 != 0 {
-				index = cpu.a[xn&7]
-			} else {
-				index = cpu.d[xn&7]
-			}
-			if ext&0x800 == 0 {
-				index = signExtend16(index)
-			}
-			addr = oldPC + disp + index
+			return 10
+		case 4: // #<data>
+			return 4
 		}
 	}
+	return 0
+}
+
+// LEA - Load effective address
+func (cpu *CPU) opLEA(opcode uint16) {
+	addrReg := int((opcode >> 9) & 7)
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	if !controlMode(eaMode, eaReg) {
+		cpu.opIllegal(opcode)
+		return
+	}
 
-	cpu.a[addrReg] = addr
+	cpu.a[addrReg] = cpu.calcEA(eaMode, eaReg, 32)
 	cpu.useCycles(4)
 }
 
@@ -725,59 +729,12 @@ func (cpu *CPU) opLEA(opcode uint16) {
 func (cpu *CPU) opPEA(opcode uint16) {
 	eaMode := int((opcode >> 3) & 7)
 	eaReg := int(opcode & 7)
-
-	// Calculate EA (same as LEA)
-	var addr uint32
-
-	switch eaMode {
-	case 2: // (An)
-		addr = cpu.a[eaReg]
-	case 5: // (d16,An)
-		disp := signExtend16(uint32(cpu.readImmediate16()))
-		addr = cpu.a[eaReg] + disp
-	case 6: // (d8,An,Xn)
-		ext := uint32(cpu.readImmediate16())
-		disp := signExtend8(ext & 0xFF)
-		xn := int((ext >> 12) & 0x0F)
-		var index uint32
-		if ext&0x8000 != 0 {
-			index = cpu.a[xn&7]
-		} else {
-			index = cpu.d[xn&7]
-		}
-		if ext&0x800 == 0 {
-			index = signExtend16(index)
-		}
-		addr = cpu.a[eaReg] + disp + index
-	case 7:
-		switch eaReg {
-		case 0: // (xxx).W
-			addr = signExtend16(uint32(cpu.readImmediate16()))
-		case 1: // (xxx).L
-			addr = cpu.readImmediate32()
-		case 2: // (d16,PC)
-			oldPC := cpu.pc
-			disp := signExtend16(uint32(cpu.readImmediate16()))
-			addr = oldPC + disp
-		case 3: // (d8,PC,Xn)
-			oldPC := cpu.pc
-			ext := uint32(cpu.readImmediate16())
-			disp := signExtend8(ext & 0xFF)
-			xn := int((ext >> 12) & 0x0F)
-			var index uint32
-			if ext&0x8000 != 0 {
-				index = cpu.a[xn&7]
-			} else {
-				index = cpu.d[xn&7]
-			}
-			if ext&0x800 == 0 {
-				index = signExtend16(index)
-			}
-			addr = oldPC + disp + index
-		}
+	if !controlMode(eaMode, eaReg) {
+		cpu.opIllegal(opcode)
+		return
 	}
 
-	cpu.pushLong(addr)
+	cpu.pushLong(cpu.calcEA(eaMode, eaReg, 32))
 	cpu.useCycles(12)
 }
 
@@ -814,13 +771,17 @@ func (cpu *CPU) opSWAP(opcode uint16) {
 func (cpu *CPU) opEXT(opcode uint16) {
 	reg := int(opcode & 7)
 
-	if opcode&0x0040 == 0 {
-		// Byte to word
-		if cpu.d[reg]&0x80 != 0 {
-			cpu.d[reg] = (cpu.d[reg] & 0xFFFF0000) | 0x0000FF00 | (cpu.d[reg] & 0xFF)
-		} else {
-			cpu.d[reg] = (cpu.d[reg] & 0xFFFF0000) | (cpu.d[reg] & 0xFF)
+	if opcode&0x01C0 == 0x01C0 {
+		// Byte to long (EXTB.L, 68020+)
+		if !cpu.is020Plus() {
+			cpu.opIllegal(opcode)
+			return
 		}
+		cpu.d[reg] = uint32(int32(int8(cpu.d[reg])))
+		cpu.setFlagsLogical(cpu.d[reg], 32)
+	} else if opcode&0x0040 == 0 {
+		// Byte to word; bits 8-15 are replaced by the sign of bit 7
+		cpu.d[reg] = (cpu.d[reg] & 0xFFFF0000) | uint32(uint16(int16(int8(cpu.d[reg]))))
 		cpu.setFlagsLogical(cpu.d[reg], 16)
 	} else {
 		// Word to long
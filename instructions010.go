@@ -0,0 +1,198 @@
+package musashi
+
+// instructions010.go - 68010+ instruction implementations
+
+// RTD - Return and deallocate (68010+)
+func (cpu *CPU) opRTD(opcode uint16) {
+	if cpu.cpuType < CPU68010 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	disp := signExtend16(uint32(cpu.readImmediate16()))
+	cpu.setPC(cpu.popLong())
+	cpu.a[7] += disp
+	cpu.useCycles(16)
+}
+
+// BKPT - Breakpoint (68010+). The breakpoint acknowledge cycle lets the
+// host respond; the processor then takes an illegal instruction trap
+// unless the illegal instruction callback emulates the opcode.
+func (cpu *CPU) opBKPT(opcode uint16) {
+	if cpu.cpuType < CPU68010 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	if cpu.bkptAckCallback != nil {
+		cpu.bkptAckCallback(uint32(opcode & 7))
+	}
+	cpu.opIllegal(opcode)
+}
+
+// MOVE from CCR (68010+)
+func (cpu *CPU) opMOVEfromCCR(opcode uint16) {
+	if cpu.cpuType < CPU68010 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+
+	cpu.writeEA(eaMode, eaReg, 16, uint32(cpu.sr&0x1F))
+	if eaMode == 0 {
+		cpu.useCycles(4)
+	} else {
+		cpu.useCycles(8)
+	}
+}
+
+// MOVEC control register codes (bits 0-11 of the extension word)
+const (
+	ctrlSFC  = 0x000
+	ctrlDFC  = 0x001
+	ctrlCACR = 0x002
+	ctrlUSP  = 0x800
+	ctrlVBR  = 0x801
+	ctrlCAAR = 0x802
+	ctrlMSP  = 0x803
+	ctrlISP  = 0x804
+)
+
+// validControlRegister reports whether MOVEC may access the given control
+// register on this CPU type
+func (cpu *CPU) validControlRegister(ctrl uint16) bool {
+	switch ctrl {
+	case ctrlSFC, ctrlDFC, ctrlUSP, ctrlVBR:
+		return cpu.cpuType >= CPU68010
+	case ctrlCACR, ctrlMSP, ctrlISP:
+		return cpu.is020Plus()
+	case ctrlCAAR:
+		// The 68040 has no cache address register
+		return cpu.cpuType >= CPU68EC020 && cpu.cpuType <= CPU68030
+	}
+	return false
+}
+
+// MOVEC - Move control register (68010+)
+func (cpu *CPU) opMOVEC(opcode uint16) {
+	// MOVEC format: 0100 1110 0111 101d + extension word
+	// Extension: Arrr cccc cccc cccc (A = address register, rrr = Rn, c = control register)
+	// d = 0: Rc to Rn, d = 1: Rn to Rc
+	if cpu.cpuType < CPU68010 {
+		cpu.opIllegal(opcode)
+		return
+	}
+	if cpu.sr&FlagS == 0 {
+		cpu.privilegeViolation()
+		return
+	}
+
+	ext := cpu.readImmediate16()
+	ctrl := ext & 0x0FFF
+	if !cpu.validControlRegister(ctrl) {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	reg := &cpu.d[(ext>>12)&7]
+	if ext&0x8000 != 0 {
+		reg = &cpu.a[(ext>>12)&7]
+	}
+
+	if opcode&1 == 0 {
+		// Control register to general register
+		switch ctrl {
+		case ctrlSFC:
+			*reg = uint32(cpu.sfc)
+		case ctrlDFC:
+			*reg = uint32(cpu.dfc)
+		case ctrlCACR:
+			*reg = cpu.cacr
+		case ctrlUSP:
+			*reg = cpu.usp
+		case ctrlVBR:
+			*reg = cpu.vbr
+		case ctrlCAAR:
+			*reg = cpu.caar
+		case ctrlMSP:
+			*reg = cpu.msp
+		case ctrlISP:
+			// Supervisor mode, so A7 is the interrupt stack pointer
+			*reg = cpu.a[7]
+		}
+	} else {
+		// General register to control register
+		value := *reg
+		switch ctrl {
+		case ctrlSFC:
+			cpu.sfc = uint8(value & 7)
+		case ctrlDFC:
+			cpu.dfc = uint8(value & 7)
+		case ctrlCACR:
+			cpu.setCACR(value)
+		case ctrlUSP:
+			cpu.usp = value
+		case ctrlVBR:
+			cpu.vbr = value
+		case ctrlCAAR:
+			cpu.caar = value
+		case ctrlMSP:
+			cpu.msp = value
+		case ctrlISP:
+			cpu.a[7] = value
+		}
+	}
+
+	cpu.useCycles(12)
+}
+
+// MOVES - Move address space (68010+)
+func (cpu *CPU) opMOVES(opcode uint16) {
+	// MOVES format: 0000 1110 ssEE Emmm + extension word
+	// Extension: Arrr d000 0000 0000 (A = address register, d = 1: Rn to <ea>)
+	if cpu.cpuType < CPU68010 {
+		cpu.opIllegal(opcode)
+		return
+	}
+	if cpu.sr&FlagS == 0 {
+		cpu.privilegeViolation()
+		return
+	}
+
+	size := getSize(opcode, 6)
+	ext := cpu.readImmediate16()
+	reg := int((ext >> 12) & 7)
+	addr := cpu.calcEA(int((opcode>>3)&7), int(opcode&7), size)
+
+	if ext&0x0800 != 0 {
+		// Register to memory, in the DFC address space
+		value := cpu.d[reg]
+		if ext&0x8000 != 0 {
+			value = cpu.a[reg]
+		}
+		cpu.writeMemFC(addr, value, size, cpu.dfc)
+	} else {
+		// Memory to register, in the SFC address space
+		value := cpu.readMemFC(addr, size, cpu.sfc)
+		if ext&0x8000 != 0 {
+			// Address registers are always sign-extended to 32 bits
+			switch size {
+			case 8:
+				value = signExtend8(value)
+			case 16:
+				value = signExtend16(value)
+			}
+			cpu.a[reg] = value
+		} else {
+			cpu.writeEA(0, reg, size, value)
+		}
+	}
+
+	if size == 32 {
+		cpu.useCycles(22)
+	} else {
+		cpu.useCycles(18)
+	}
+}
@@ -0,0 +1,398 @@
+package musashi
+
+import "math/bits"
+
+// instructions020.go - 68020+ instruction implementations
+
+// Bit field operations (bits 8-10 of the opcode)
+const (
+	bfTST  = 0
+	bfEXTU = 1
+	bfCHG  = 2
+	bfEXTS = 3
+	bfCLR  = 4
+	bfFFO  = 5
+	bfSET  = 6
+	bfINS  = 7
+)
+
+// BFxxx - Bit field operations (68020+)
+func (cpu *CPU) opBitField(opcode uint16) {
+	// BFxxx format: 1110 1ooo 11EE Emmm + extension word
+	// Extension: 0DDD Oooo ooWw wwww
+	// DDD = data register, O = offset in Dn, W = width in Dn
+	if !cpu.is020Plus() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	op := int((opcode >> 8) & 0x07)
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	ext := cpu.readImmediate16()
+	dataReg := int((ext >> 12) & 7)
+
+	offset := int32((ext >> 6) & 0x1F)
+	if ext&0x0800 != 0 {
+		offset = int32(cpu.d[offset&7])
+	}
+	width := uint32(ext & 0x1F)
+	if ext&0x0020 != 0 {
+		width = cpu.d[width&7] & 0x1F
+	}
+	if width == 0 {
+		width = 32
+	}
+	mask := uint32(0xFFFFFFFF) >> (32 - width)
+
+	// Fetch the field, right-justified
+	var field, addr, bitOff, nbytes uint32
+	var data uint64
+	if eaMode == 0 {
+		// Data register: offset is taken modulo 32 and the field wraps
+		bitOff = uint32(offset) & 31
+		data = uint64(bits.RotateLeft32(cpu.d[eaReg], int(bitOff)))
+		field = uint32(data>>(32-width)) & mask
+	} else {
+		// Memory: a register offset is signed and may address bytes
+		// below the operand; the field may span up to five bytes
+		addr = cpu.calcEA(eaMode, eaReg, 8) + uint32(offset>>3)
+		bitOff = uint32(offset & 7)
+		nbytes = (bitOff + width + 7) / 8
+		for i := uint32(0); i < nbytes; i++ {
+			data = data<<8 | uint64(cpu.readMem(addr+i, 8))
+		}
+		field = uint32(data>>(nbytes*8-bitOff-width)) & mask
+	}
+
+	// N and Z reflect the field before modification
+	cpu.setFlagsLogical(field<<(32-width), 32)
+
+	var result uint32
+	write := true
+	switch op {
+	case bfTST:
+		write = false
+	case bfEXTU:
+		cpu.d[dataReg] = field
+		write = false
+	case bfEXTS:
+		cpu.d[dataReg] = uint32(int32(field<<(32-width)) >> (32 - width))
+		write = false
+	case bfFFO:
+		lz := uint32(bits.LeadingZeros32(field << (32 - width)))
+		if lz > width {
+			lz = width
+		}
+		cpu.d[dataReg] = uint32(offset) + lz
+		write = false
+	case bfCHG:
+		result = ^field & mask
+	case bfCLR:
+		result = 0
+	case bfSET:
+		result = mask
+	case bfINS:
+		result = cpu.d[dataReg] & mask
+		cpu.setFlagsLogical(result<<(32-width), 32)
+	}
+
+	if write {
+		if eaMode == 0 {
+			shift := 32 - width
+			data = (data &^ (uint64(mask) << shift)) | (uint64(result) << shift)
+			cpu.d[eaReg] = bits.RotateLeft32(uint32(data), -int(bitOff))
+		} else {
+			shift := nbytes*8 - bitOff - width
+			data = (data &^ (uint64(mask) << shift)) | (uint64(result) << shift)
+			for i := nbytes; i > 0; i-- {
+				cpu.writeMem(addr+i-1, uint32(data), 8)
+				data >>= 8
+			}
+		}
+	}
+
+	if eaMode == 0 {
+		cpu.useCycles(bitFieldRegCycles[op])
+	} else {
+		cpu.useCycles(bitFieldMemCycles[op])
+	}
+}
+
+// Bit field cycle counts (68020), indexed by operation
+var (
+	bitFieldRegCycles = [8]int{6, 8, 12, 8, 12, 18, 12, 10}
+	bitFieldMemCycles = [8]int{13, 15, 20, 15, 20, 28, 20, 17}
+)
+
+// casSize returns the operand size encoded in bits 9-10 of a CAS/CAS2 opcode
+func casSize(opcode uint16) int {
+	switch (opcode >> 9) & 0x03 {
+	case 1:
+		return 8
+	case 2:
+		return 16
+	default:
+		return 32
+	}
+}
+
+// CAS - Compare and swap with operand (68020+)
+func (cpu *CPU) opCAS(opcode uint16) {
+	// CAS format: 0000 1ss0 11EE Emmm + extension word 0000 000u uu00 0ccc
+	if !cpu.is020Plus() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	size := casSize(opcode)
+	ext := cpu.readImmediate16()
+	dc := int(ext & 7)
+	du := int((ext >> 6) & 7)
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+
+	// The read-modify-write cycle is indivisible on the bus
+	addr := cpu.calcEA(eaMode, eaReg, size)
+	dest := cpu.readMem(addr, size)
+	compare := maskValue(cpu.d[dc], size)
+	cpu.setFlagsCmp(dest, compare, dest-compare, size)
+
+	if cpu.sr&FlagZ != 0 {
+		cpu.writeMem(addr, cpu.d[du], size)
+	} else {
+		cpu.writeEA(0, dc, size, dest)
+	}
+
+	cpu.useCycles(16)
+}
+
+// CAS2 - Compare and swap with two operands (68020+)
+func (cpu *CPU) opCAS2(opcode uint16) {
+	// CAS2 format: 0000 1ss0 1111 1100 + two extension words
+	// Extension: Rrrr 000u uu00 0ccc (R = address register, rrr = Rn)
+	size := casSize(opcode)
+	if !cpu.is020Plus() || size == 8 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	ext1 := cpu.readImmediate16()
+	ext2 := cpu.readImmediate16()
+
+	addr1 := cpu.casAddress(ext1)
+	addr2 := cpu.casAddress(ext2)
+	dc1, du1 := int(ext1&7), int((ext1>>6)&7)
+	dc2, du2 := int(ext2&7), int((ext2>>6)&7)
+
+	dest1 := cpu.readMem(addr1, size)
+	dest2 := cpu.readMem(addr2, size)
+
+	compare1 := maskValue(cpu.d[dc1], size)
+	cpu.setFlagsCmp(dest1, compare1, dest1-compare1, size)
+	if cpu.sr&FlagZ != 0 {
+		compare2 := maskValue(cpu.d[dc2], size)
+		cpu.setFlagsCmp(dest2, compare2, dest2-compare2, size)
+	}
+
+	if cpu.sr&FlagZ != 0 {
+		cpu.writeMem(addr1, cpu.d[du1], size)
+		cpu.writeMem(addr2, cpu.d[du2], size)
+	} else {
+		cpu.writeEA(0, dc1, size, dest1)
+		cpu.writeEA(0, dc2, size, dest2)
+	}
+
+	cpu.useCycles(24)
+}
+
+// casAddress returns the memory address held in the Rn field of a CAS2
+// extension word
+func (cpu *CPU) casAddress(ext uint16) uint32 {
+	reg := int((ext >> 12) & 7)
+	if ext&0x8000 != 0 {
+		return cpu.a[reg]
+	}
+	return cpu.d[reg]
+}
+
+// PACK - Pack BCD (68020+)
+func (cpu *CPU) opPACK(opcode uint16) {
+	// PACK format: 1000 yyy1 0100 Rxxx + adjustment word
+	// R = 0: Dx,Dy; R = 1: -(Ax),-(Ay)
+	if !cpu.is020Plus() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	ry := int((opcode >> 9) & 7)
+	rx := int(opcode & 7)
+	adj := uint32(cpu.readImmediate16())
+
+	if opcode&0x0008 == 0 {
+		src := (cpu.d[rx] + adj) & 0xFFFF
+		cpu.writeEA(0, ry, 8, ((src>>4)&0xF0)|(src&0x0F))
+		cpu.useCycles(6)
+		return
+	}
+
+	lo := cpu.readEA(4, rx, 8)
+	hi := cpu.readEA(4, rx, 8)
+	src := ((hi << 8) | lo) + adj
+	cpu.writeEA(4, ry, 8, ((src>>4)&0xF0)|(src&0x0F))
+	cpu.useCycles(13)
+}
+
+// UNPK - Unpack BCD (68020+)
+func (cpu *CPU) opUNPK(opcode uint16) {
+	// UNPK format: 1000 yyy1 1000 Rxxx + adjustment word
+	// R = 0: Dx,Dy; R = 1: -(Ax),-(Ay)
+	if !cpu.is020Plus() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	ry := int((opcode >> 9) & 7)
+	rx := int(opcode & 7)
+	adj := uint32(cpu.readImmediate16())
+
+	if opcode&0x0008 == 0 {
+		src := cpu.d[rx] & 0xFF
+		result := (((src << 4) & 0x0F00) | (src & 0x0F)) + adj
+		cpu.writeEA(0, ry, 16, result)
+		cpu.useCycles(8)
+		return
+	}
+
+	src := cpu.readEA(4, rx, 8)
+	result := (((src << 4) & 0x0F00) | (src & 0x0F)) + adj
+	cpu.writeEA(4, ry, 8, result)
+	cpu.writeEA(4, ry, 8, result>>8)
+	cpu.useCycles(13)
+}
+
+// TRAPcc - Trap on condition (68020+)
+func (cpu *CPU) opTRAPcc(opcode uint16) {
+	// TRAPcc format: 0101 cccc 1111 1mmm
+	// mmm = 010: word operand, 011: long operand, 100: no operand
+	if !cpu.is020Plus() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	// The optional operand is for use by the trap handler only
+	switch opcode & 7 {
+	case 2:
+		cpu.pc += 2
+	case 3:
+		cpu.pc += 4
+	}
+
+	if cpu.testCondition(int((opcode >> 8) & 0x0F)) {
+		cpu.trapException(VectorTRAPV)
+		cpu.useCycles(20)
+		return
+	}
+	cpu.useCycles(4)
+}
+
+// LINK.L - Link with a 32-bit displacement (68020+)
+func (cpu *CPU) opLINKL(opcode uint16) {
+	// LINK.L format: 0100 1000 0000 1rrr + 32-bit displacement
+	if !cpu.is020Plus() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	reg := int(opcode & 7)
+	disp := cpu.readImmediate32()
+
+	cpu.pushLong(cpu.a[reg])
+	cpu.a[reg] = cpu.a[7]
+	cpu.a[7] += disp
+
+	cpu.useCycles(6)
+}
+
+// Module stack frame layout, from the stack pointer after CALLM
+const (
+	moduleFrameCCR    = 0x02 // Opt/type, saved access level, condition codes
+	moduleFrameArgs   = 0x06 // Argument count
+	moduleFrameDesc   = 0x0C // Module descriptor pointer
+	moduleFramePC     = 0x10 // Saved program counter
+	moduleFrameData   = 0x14 // Saved module data area pointer
+	moduleFrameSize   = 0x18
+	moduleDescEntry   = 0x04 // Offset of the entry word pointer in a descriptor
+	moduleDescData    = 0x08 // Offset of the data area pointer in a descriptor
+	moduleTypeNoLevel = 0x00 // Descriptor type without an access level change
+)
+
+// CALLM - Call module (68020)
+func (cpu *CPU) opCALLM(opcode uint16) {
+	// CALLM format: 0000 0110 11EE Emmm + extension word 0000 0000 aaaa aaaa
+	// a = argument count in bytes
+	if cpu.cpuType != CPU68020 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	argCount := cpu.readImmediate16() & 0xFF
+	desc := cpu.calcEA(int((opcode>>3)&7), int(opcode&7), 32)
+
+	// Only type 0 descriptors are supported; the others change the access
+	// level, which needs an MC68851
+	header := cpu.readMem(desc, 32)
+	if (header>>24)&0x1F != moduleTypeNoLevel {
+		cpu.exception(VectorFormatError, cpu.ppc)
+		cpu.useCycles(34)
+		return
+	}
+
+	// The entry word names the register that receives the module data
+	// area pointer; the module code follows it
+	entry := cpu.readMem(desc+moduleDescEntry, 32)
+	entryWord := cpu.readMemFC(entry, 16, cpu.programFC())
+	reg := &cpu.d[(entryWord>>12)&7]
+	if entryWord&0x8000 != 0 {
+		reg = &cpu.a[(entryWord>>12)&7]
+	}
+
+	cpu.pushLong(*reg)
+	cpu.pushLong(cpu.pc)
+	cpu.pushLong(desc)
+	cpu.pushLong(0)
+	cpu.pushLong(uint32(argCount))
+	cpu.pushLong(header&0xFF000000 | uint32(cpu.sr&0xFF))
+
+	*reg = cpu.readMem(desc+moduleDescData, 32)
+	cpu.setPC(entry + 2)
+	cpu.useCycles(64)
+}
+
+// RTM - Return from module (68020)
+func (cpu *CPU) opRTM(opcode uint16) {
+	// RTM format: 0000 0110 1100 Drrr (D = 1: address register)
+	if cpu.cpuType != CPU68020 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	reg := &cpu.d[opcode&7]
+	if opcode&0x0008 != 0 {
+		reg = &cpu.a[opcode&7]
+	}
+
+	sp := cpu.a[7]
+	ccr := cpu.readMem(sp+moduleFrameCCR, 16)
+	argCount := cpu.readMem(sp+moduleFrameArgs, 16)
+	pc := cpu.readMem(sp+moduleFramePC, 32)
+	data := cpu.readMem(sp+moduleFrameData, 32)
+
+	// Deallocate the frame and the arguments pushed before the call. Rn
+	// may be A7 itself, so it is restored last.
+	cpu.a[7] = sp + moduleFrameSize + argCount
+	*reg = data
+	cpu.SetCCR(uint8(ccr))
+	cpu.setPC(pc)
+	cpu.useCycles(36)
+}
@@ -0,0 +1,56 @@
+package musashi
+
+// instructions040.go - 68040 instruction implementations
+
+// is040 reports whether the CPU is a member of the 68040 family
+func (cpu *CPU) is040() bool {
+	return cpu.cpuType >= CPU68EC040 && cpu.cpuType <= CPU68040
+}
+
+// MOVE16 - Move a 16-byte block (68040)
+func (cpu *CPU) opMOVE16(opcode uint16) {
+	// Formats: 1111 0110 0010 0xxx + 1yyy 0000 0000 0000  (Ax)+,(Ay)+
+	//          1111 0110 000o oyyy + absolute long address
+	if !cpu.is040() {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	ay := int(opcode & 7)
+	var src, dst uint32
+	if opcode&0x0020 != 0 {
+		ext := cpu.readImmediate16()
+		if ext&0x8FFF != 0x8000 {
+			cpu.pc = cpu.ppc + 2
+			cpu.opIllegal(opcode)
+			return
+		}
+		ax := ay
+		ay = int((ext >> 12) & 7)
+		src, dst = cpu.a[ax], cpu.a[ay]
+		cpu.a[ax] += 16
+		if ay != ax {
+			cpu.a[ay] += 16
+		}
+	} else {
+		abs := cpu.readImmediate32()
+		src, dst = cpu.a[ay], abs
+		if opcode&0x0008 != 0 {
+			// (xxx).L to (Ay)
+			src, dst = abs, cpu.a[ay]
+		}
+		if opcode&0x0010 == 0 {
+			// Ay is post-incremented
+			cpu.a[ay] += 16
+		}
+	}
+
+	// The block is aligned to its 16-byte line; the low address bits are
+	// ignored
+	src &^= 0x0F
+	dst &^= 0x0F
+	for i := uint32(0); i < 16; i += 4 {
+		cpu.writeMem(dst+i, cpu.readMem(src+i, 32), 32)
+	}
+	cpu.useCycles(18)
+}
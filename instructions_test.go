@@ -1,6 +1,7 @@
 package musashi
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -60,6 +61,91 @@ func TestADDQInstruction(t *testing.T) {
 	}
 }
 
+// TestADDFlags tests the carry and overflow flags of ADD at each size
+func TestADDFlags(t *testing.T) {
+	tests := []struct {
+		opcode uint16
+		d0, d1 uint32
+		result uint32
+		wantV  bool
+		wantC  bool
+		wantZ  bool
+	}{
+		{0xD081, 0x7FFFFFFF, 1, 0x80000000, true, false, false}, // ADD.L D1,D0
+		{0xD081, 0xFFFFFFFF, 1, 0x00000000, false, true, true},
+		{0xD081, 0x80000000, 0x80000000, 0x00000000, true, true, true},
+		{0xD041, 0x00007FFF, 1, 0x00008000, true, false, false}, // ADD.W D1,D0
+		{0xD041, 0x1234FFFF, 1, 0x12340000, false, true, true},
+		{0xD001, 0x0000007F, 1, 0x00000080, true, false, false}, // ADD.B D1,D0
+		{0xD001, 0x000000FF, 1, 0x00000000, false, true, true},
+	}
+
+	for _, tt := range tests {
+		cpu := NewCPU(CPU68000)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write16(0x400, tt.opcode)
+
+		cpu.Reset()
+		cpu.d[0] = tt.d0
+		cpu.d[1] = tt.d1
+		cpu.Step()
+
+		name := fmt.Sprintf("0x%04X with D0 = 0x%08X, D1 = 0x%08X", tt.opcode, tt.d0, tt.d1)
+		if cpu.d[0] != tt.result {
+			t.Errorf("%s: expected D0 = 0x%08X, got 0x%08X", name, tt.result, cpu.d[0])
+		}
+		if got := cpu.sr&FlagV != 0; got != tt.wantV {
+			t.Errorf("%s: expected V = %v, got %v", name, tt.wantV, got)
+		}
+		if got := cpu.sr&FlagC != 0; got != tt.wantC {
+			t.Errorf("%s: expected C = %v, got %v", name, tt.wantC, got)
+		}
+		if got := cpu.sr&FlagX != 0; got != tt.wantC {
+			t.Errorf("%s: expected X = %v, got %v", name, tt.wantC, got)
+		}
+		if got := cpu.sr&FlagZ != 0; got != tt.wantZ {
+			t.Errorf("%s: expected Z = %v, got %v", name, tt.wantZ, got)
+		}
+	}
+}
+
+// TestAddressArithmetic tests that SUBA.W sign-extends its source and
+// leaves the flags alone, and that byte operations on An are illegal
+func TestAddressArithmetic(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorIllegal*4, 0x00000800)
+
+	memory.Write16(0x400, 0x90FC) // SUBA.W #$8000,A0
+	memory.Write16(0x402, 0x8000)
+	memory.Write16(0x404, 0xD008) // ADD.B A0,D0 (illegal)
+
+	cpu.Reset()
+	cpu.a[0] = 0x00010000
+	cpu.SetCCR(FlagZ | FlagC)
+
+	cpu.Step()
+	if cpu.a[0] != 0x00018000 {
+		t.Errorf("Expected A0 = 0x00010000 - 0xFFFF8000 = 0x00018000, got 0x%08X", cpu.a[0])
+	}
+	if cpu.sr&0x1F != FlagZ|FlagC {
+		t.Errorf("Expected flags untouched, got CCR 0x%02X", cpu.sr&0x1F)
+	}
+
+	cpu.Step()
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected ADD.B A0,D0 to be illegal, got PC 0x%08X", cpu.pc)
+	}
+}
+
 // TestSUBQInstruction tests the SUBQ instruction
 func TestSUBQInstruction(t *testing.T) {
 	cpu := NewCPU(CPU68000)
@@ -152,8 +238,8 @@ func TestEORInstruction(t *testing.T) {
 	cpu.d[0] = 0xFF
 	cpu.d[1] = 0x0F
 
-	// EOR.B D1, D0 = 0xB100 (reg=1 << 9 | size=0 << 6 | mode=0 << 3 | reg=0)
-	memory.Write16(0x400, 0xB100)
+	// EOR.B D1, D0 = 0xB300 (reg=1 << 9 | dir=1 << 8 | size=0 << 6 | mode=0 << 3 | reg=0)
+	memory.Write16(0x400, 0xB300)
 
 	cpu.Execute(10)
 
@@ -434,6 +520,40 @@ func TestEXTInstruction(t *testing.T) {
 	}
 }
 
+// TestEXTWordDirtyHighByte tests that EXT.W replaces bits 8-15 of the word
+func TestEXTWordDirtyHighByte(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// EXT.W D0 = 0x4880, EXT.W D1 = 0x4881
+	memory.Write16(0x400, 0x4880)
+	memory.Write16(0x402, 0x4881)
+
+	cpu.Reset()
+	cpu.d[0] = 0x1234AB7F
+	cpu.d[1] = 0x12340080
+
+	cpu.Step()
+	if cpu.d[0] != 0x1234007F {
+		t.Errorf("Expected D0 = 0x1234007F, got 0x%08X", cpu.d[0])
+	}
+	if cpu.sr&(FlagN|FlagZ) != 0 {
+		t.Errorf("Expected N and Z clear, got SR 0x%04X", cpu.sr)
+	}
+
+	cpu.Step()
+	if cpu.d[1] != 0x1234FF80 {
+		t.Errorf("Expected D1 = 0x1234FF80, got 0x%08X", cpu.d[1])
+	}
+	if cpu.sr&FlagN == 0 {
+		t.Error("Expected N set for a negative byte")
+	}
+}
+
 // TestLEAInstruction tests the LEA instruction
 func TestLEAInstruction(t *testing.T) {
 	cpu := NewCPU(CPU68000)
@@ -460,6 +580,74 @@ func TestLEAInstruction(t *testing.T) {
 	}
 }
 
+// TestCalcEA tests effective address calculation for (d16,An) and PEA,
+// which shares it
+func TestCalcEA(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+
+	// (d16,A0) with d16 = -2: the sign-extended displacement plus A0
+	memory.Write16(0x400, 0xFFFE)
+	if addr := cpu.CalcEA(ModeAddrDisplace, 0, 16); addr != 0x1FFE {
+		t.Errorf("Expected (-2,A0) = 0x1FFE, got 0x%08X", addr)
+	}
+	if cpu.pc != 0x402 {
+		t.Errorf("Expected PC past the extension word at 0x402, got 0x%08X", cpu.pc)
+	}
+	if cpu.a[0] != 0x2000 {
+		t.Errorf("Expected A0 unchanged, got 0x%08X", cpu.a[0])
+	}
+
+	// PEA (16,A0) = 0x4868 0x0010
+	cpu.Poke16(0x402, 0x4868)
+	cpu.Poke16(0x404, 0x0010)
+	cpu.Step()
+	if cpu.a[7] != 0x1000-4 || memory.Read32(0x1000-4) != 0x2010 {
+		t.Errorf("Expected 0x2010 pushed, got 0x%08X at SP 0x%08X", memory.Read32(cpu.a[7]), cpu.a[7])
+	}
+}
+
+// TestPCRelativeAnchor tests that PC-relative displacements are taken from
+// the address of the extension word
+func TestPCRelativeAnchor(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// LEA label(PC),A0 with label at 0x420: disp = 0x420 - 0x402
+	memory.Write16(0x400, 0x41FA)
+	memory.Write16(0x402, 0x001E)
+	// LEA label(PC,D0.W),A1 with D0 = 0x10: disp = 0x420 - 0x406 - 0x10
+	memory.Write16(0x404, 0x43FB)
+	memory.Write16(0x406, 0x000A)
+
+	cpu.Reset()
+	cpu.d[0] = 0x10
+
+	if text, _ := cpu.Disassemble(0x400); text != "LEA\t$00000420(PC),A0" {
+		t.Errorf("Expected LEA\\t$00000420(PC),A0, got %q", text)
+	}
+
+	cpu.Step()
+	if cpu.a[0] != 0x420 {
+		t.Errorf("Expected A0 = 0x420, got 0x%08X", cpu.a[0])
+	}
+	cpu.Step()
+	if cpu.a[1] != 0x420 {
+		t.Errorf("Expected A1 = 0x420, got 0x%08X", cpu.a[1])
+	}
+}
+
 // TestRTSInstruction tests the RTS instruction
 func TestRTSInstruction(t *testing.T) {
 	cpu := NewCPU(CPU68000)
@@ -484,3 +672,2011 @@ func TestRTSInstruction(t *testing.T) {
 		t.Errorf("Expected PC = 0x1000, got 0x%08X", cpu.pc)
 	}
 }
+
+// TestScaledIndexAddressing tests the 68020 scaled index brief format
+func TestScaledIndexAddressing(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.a[0] = 0x2000
+	cpu.d[1] = 3
+	memory.Write32(0x2010, 0x12345678)
+
+	// MOVE.L (4,A0,D1.L*4),D0 = 0x2030 0x1C04
+	memory.Write16(0x400, 0x2030)
+	memory.Write16(0x402, 0x1C04)
+
+	cpu.Step()
+
+	// EA = 0x2000 + 4 + 3*4 = 0x2010
+	if cpu.d[0] != 0x12345678 {
+		t.Errorf("Expected D0 = 0x12345678, got 0x%08X", cpu.d[0])
+	}
+	if cpu.pc != 0x404 {
+		t.Errorf("Expected PC = 0x404, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestMemoryIndirectPostIndexed tests the 68020 ([bd,An],Xn.L*4,od) mode
+func TestMemoryIndirectPostIndexed(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.a[0] = 0x2000
+	cpu.d[1] = 3
+	memory.Write32(0x2010, 0x00003000) // Pointer fetched from bd+A0
+	memory.Write32(0x3014, 0xCAFEBABE) // 0x3000 + 3*4 + 8
+
+	// MOVE.L ([$10,A0],D1.L*4,$8),D0
+	// Full extension word: D1.L*4, word bd, postindexed with word od = 0x1D26
+	memory.Write16(0x400, 0x2030)
+	memory.Write16(0x402, 0x1D26)
+	memory.Write16(0x404, 0x0010) // bd
+	memory.Write16(0x406, 0x0008) // od
+
+	cpu.Step()
+
+	if cpu.d[0] != 0xCAFEBABE {
+		t.Errorf("Expected D0 = 0xCAFEBABE, got 0x%08X", cpu.d[0])
+	}
+	if cpu.pc != 0x408 {
+		t.Errorf("Expected PC = 0x408, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestBRALongInstruction tests the 68020 BRA.L with a 32-bit displacement
+func TestBRALongInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	// BRA.L +$10000 = 0x60FF 0x00010000
+	memory.Write16(0x400, 0x60FF)
+	memory.Write32(0x402, 0x00010000)
+
+	cpu.Step()
+
+	// Target is relative to the extension word at 0x402
+	if cpu.pc != 0x10402 {
+		t.Errorf("Expected PC = 0x10402, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestBSRLongInstruction tests the 68020 BSR.L with a 32-bit displacement
+func TestBSRLongInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00020000)
+
+	cpu.Reset()
+
+	// BSR.L -$18000 = 0x61FF 0xFFFE8000
+	memory.Write16(0x20000, 0x61FF)
+	memory.Write32(0x20002, 0xFFFE8000)
+
+	cpu.Step()
+
+	if cpu.pc != 0x08002 {
+		t.Errorf("Expected PC = 0x08002, got 0x%08X", cpu.pc)
+	}
+	if cpu.a[7] != 0xFFC {
+		t.Errorf("Expected SP = 0xFFC, got 0x%08X", cpu.a[7])
+	}
+	if ret := memory.Read32(0xFFC); ret != 0x20006 {
+		t.Errorf("Expected return address 0x20006, got 0x%08X", ret)
+	}
+}
+
+// TestBitFieldMemory tests BFEXTU/BFEXTS/BFINS/BFFFO on a field crossing a byte boundary
+func TestBitFieldMemory(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.a[0] = 0x2000
+	cpu.d[2] = 0x05
+	// Bits 6-10 of 0000_1111 1100_0000 form the field 11110
+	memory.Write8(0x2000, 0x0F)
+	memory.Write8(0x2001, 0xC0)
+
+	// BFEXTU (A0){6:5},D1
+	memory.Write16(0x400, 0xE9D0)
+	memory.Write16(0x402, 0x1185)
+	// BFEXTS (A0){6:5},D3
+	memory.Write16(0x404, 0xEBD0)
+	memory.Write16(0x406, 0x3185)
+	// BFINS D2,(A0){6:5}
+	memory.Write16(0x408, 0xEFD0)
+	memory.Write16(0x40A, 0x2185)
+	// BFFFO (A0){6:5},D4
+	memory.Write16(0x40C, 0xEDD0)
+	memory.Write16(0x40E, 0x4185)
+
+	cpu.Step()
+	if cpu.d[1] != 0x1E {
+		t.Errorf("BFEXTU: expected D1 = 0x1E, got 0x%08X", cpu.d[1])
+	}
+	if cpu.sr&FlagN == 0 {
+		t.Error("BFEXTU: N flag should be set")
+	}
+
+	cpu.Step()
+	if cpu.d[3] != 0xFFFFFFFE {
+		t.Errorf("BFEXTS: expected D3 = 0xFFFFFFFE, got 0x%08X", cpu.d[3])
+	}
+
+	cpu.Step()
+	if got := memory.Read16(0x2000); got != 0x0CA0 {
+		t.Errorf("BFINS: expected memory = 0x0CA0, got 0x%04X", got)
+	}
+	if cpu.sr&(FlagN|FlagZ) != 0 {
+		t.Error("BFINS: N and Z flags should be clear")
+	}
+
+	cpu.Step()
+	// Field is now 00101, first set bit at offset 6+2
+	if cpu.d[4] != 8 {
+		t.Errorf("BFFFO: expected D4 = 8, got %d", cpu.d[4])
+	}
+}
+
+// TestBitFieldDynamicMemory tests a 32-bit field at a negative register
+// offset, spanning five bytes of memory
+func TestBitFieldDynamicMemory(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.a[0] = 0x2010
+	cpu.d[0] = 0x12345678
+	cpu.d[1] = 0xFFFFFFF4 // Offset -12: byte $200E, bit 4
+	cpu.d[2] = 0          // Width 0 means 32
+	for addr := uint32(0x200C); addr < 0x2014; addr++ {
+		memory.Write8(addr, 0xFF)
+	}
+
+	// BFINS D0,(A0){D1:D2}
+	memory.Write16(0x400, 0xEFD0)
+	memory.Write16(0x402, 0x0862)
+	// BFEXTU (A0){D1:D2},D3
+	memory.Write16(0x404, 0xE9D0)
+	memory.Write16(0x406, 0x3862)
+
+	cpu.Step()
+	expected := []uint8{0xFF, 0xFF, 0xF1, 0x23, 0x45, 0x67, 0x8F, 0xFF}
+	for i, want := range expected {
+		if got := memory.Read8(0x200C + uint32(i)); got != want {
+			t.Errorf("BFINS: expected $%02X at 0x%04X, got $%02X", want, 0x200C+i, got)
+		}
+	}
+	if cpu.sr&(FlagN|FlagZ) != 0 {
+		t.Error("BFINS: N and Z flags should be clear")
+	}
+
+	cpu.Step()
+	if cpu.d[3] != 0x12345678 {
+		t.Errorf("BFEXTU: expected D3 = 0x12345678, got 0x%08X", cpu.d[3])
+	}
+}
+
+// TestBitFieldRegister tests a bit field wrapping around a data register
+func TestBitFieldRegister(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.d[0] = 0x80000001
+
+	// BFEXTU D0{31:2},D1 = 0xE9C0 0x17C2
+	memory.Write16(0x400, 0xE9C0)
+	memory.Write16(0x402, 0x17C2)
+
+	cpu.Step()
+
+	if cpu.d[1] != 0x3 {
+		t.Errorf("Expected D1 = 0x3, got 0x%08X", cpu.d[1])
+	}
+}
+
+// TestCASInstruction tests CAS on a match and on a mismatch
+func TestCASInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.a[0] = 0x2000
+	cpu.d[0] = 0x11111111 // Compare
+	cpu.d[1] = 0x22222222 // Update
+	memory.Write32(0x2000, 0x11111111)
+
+	// CAS.L D0,D1,(A0) = 0x0ED0 0x0040, twice
+	memory.Write16(0x400, 0x0ED0)
+	memory.Write16(0x402, 0x0040)
+	memory.Write16(0x404, 0x0ED0)
+	memory.Write16(0x406, 0x0040)
+
+	// Match: update register is written to memory
+	cpu.Step()
+	if got := memory.Read32(0x2000); got != 0x22222222 {
+		t.Errorf("Expected memory = 0x22222222, got 0x%08X", got)
+	}
+	if cpu.sr&FlagZ == 0 {
+		t.Error("Z flag should be set on match")
+	}
+
+	// Mismatch: memory operand is loaded into the compare register
+	cpu.Step()
+	if got := memory.Read32(0x2000); got != 0x22222222 {
+		t.Errorf("Expected memory unchanged, got 0x%08X", got)
+	}
+	if cpu.d[0] != 0x22222222 {
+		t.Errorf("Expected D0 = 0x22222222, got 0x%08X", cpu.d[0])
+	}
+	if cpu.sr&FlagZ != 0 {
+		t.Error("Z flag should be clear on mismatch")
+	}
+	// 0x22222222 - 0x11111111 is positive with no borrow
+	if cpu.sr&(FlagN|FlagC) != 0 {
+		t.Error("N and C flags should be clear")
+	}
+}
+
+// TestCAS2Instruction tests CAS2 updating two memory locations
+func TestCAS2Instruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.a[0] = 0x2000
+	cpu.a[1] = 0x3000
+	cpu.d[0], cpu.d[1] = 0x1111, 0x2222 // Compare
+	cpu.d[2], cpu.d[3] = 0xAAAA, 0xBBBB // Update
+	memory.Write16(0x2000, 0x1111)
+	memory.Write16(0x3000, 0x2222)
+
+	// CAS2.W D0:D1,D2:D3,(A0):(A1) = 0x0CFC 0x8080 0x90C1
+	memory.Write16(0x400, 0x0CFC)
+	memory.Write16(0x402, 0x8080)
+	memory.Write16(0x404, 0x90C1)
+
+	cpu.Step()
+
+	if got := memory.Read16(0x2000); got != 0xAAAA {
+		t.Errorf("Expected (A0) = 0xAAAA, got 0x%04X", got)
+	}
+	if got := memory.Read16(0x3000); got != 0xBBBB {
+		t.Errorf("Expected (A1) = 0xBBBB, got 0x%04X", got)
+	}
+}
+
+// TestPACKInstruction tests PACK between data registers
+func TestPACKInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.d[0] = 0x00000609
+	cpu.d[1] = 0xFFFFFFFF
+
+	// PACK D0,D1,#0 = 0x8340 0x0000
+	memory.Write16(0x400, 0x8340)
+	memory.Write16(0x402, 0x0000)
+
+	cpu.Step()
+
+	if cpu.d[1] != 0xFFFFFF69 {
+		t.Errorf("Expected D1 = 0xFFFFFF69, got 0x%08X", cpu.d[1])
+	}
+}
+
+// TestUNPKInstruction tests UNPK between data registers and memory
+func TestUNPKInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	cpu.d[0] = 0x00000069
+	cpu.d[1] = 0xFFFFFFFF
+	cpu.a[0] = 0x2001
+	cpu.a[1] = 0x3002
+	memory.Write8(0x2000, 0x69)
+
+	// UNPK D0,D1,#0 = 0x8380 0x0000
+	memory.Write16(0x400, 0x8380)
+	memory.Write16(0x402, 0x0000)
+	// UNPK -(A0),-(A1),#$3030 = 0x8388 0x3030 (unpack to ASCII)
+	memory.Write16(0x404, 0x8388)
+	memory.Write16(0x406, 0x3030)
+
+	cpu.Step()
+	if cpu.d[1] != 0xFFFF0609 {
+		t.Errorf("Expected D1 = 0xFFFF0609, got 0x%08X", cpu.d[1])
+	}
+
+	cpu.Step()
+	if got := memory.Read16(0x3000); got != 0x3639 {
+		t.Errorf("Expected memory = 0x3639, got 0x%04X", got)
+	}
+	if cpu.a[0] != 0x2000 || cpu.a[1] != 0x3000 {
+		t.Errorf("Expected A0 = 0x2000, A1 = 0x3000, got 0x%08X, 0x%08X", cpu.a[0], cpu.a[1])
+	}
+}
+
+// TestRTDInstruction tests the 68010 RTD instruction
+func TestRTDInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	// Caller pushed 8 bytes of arguments, then the return address
+	cpu.a[7] = 0x0FF8
+	cpu.pushLong(0x2000)
+
+	// RTD #8 = 0x4E74 0x0008
+	memory.Write16(0x400, 0x4E74)
+	memory.Write16(0x402, 0x0008)
+
+	cpu.Step()
+
+	if cpu.pc != 0x2000 {
+		t.Errorf("Expected PC = 0x2000, got 0x%08X", cpu.pc)
+	}
+	if cpu.a[7] != 0x1000 {
+		t.Errorf("Expected SP = 0x1000, got 0x%08X", cpu.a[7])
+	}
+}
+
+// TestLINKLong tests building a frame larger than 32K with LINK.L and
+// tearing it down with UNLK
+func TestLINKLong(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00080000)
+	memory.Write32(4, 0x00000400)
+
+	// LINK.L A6,#-$20000
+	memory.Write16(0x400, 0x480E)
+	memory.Write32(0x402, 0xFFFE0000)
+	// UNLK A6
+	memory.Write16(0x406, 0x4E5E)
+
+	cpu.Reset()
+	cpu.a[6] = 0xCAFEBABE
+
+	if text, size := cpu.Disassemble(0x400); text != "LINK.L\tA6,#-$20000" || size != 6 {
+		t.Errorf("Expected LINK.L\\tA6,#-$20000 (6 bytes), got %q (%d bytes)", text, size)
+	}
+
+	cpu.Step()
+	if cpu.a[6] != 0x7FFFC {
+		t.Errorf("Expected A6 = 0x0007FFFC, got 0x%08X", cpu.a[6])
+	}
+	if cpu.a[7] != 0x5FFFC {
+		t.Errorf("Expected SP = 0x0005FFFC, got 0x%08X", cpu.a[7])
+	}
+	if saved := memory.Read32(0x7FFFC); saved != 0xCAFEBABE {
+		t.Errorf("Expected old A6 saved on the stack, got 0x%08X", saved)
+	}
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected PC = 0x406, got 0x%08X", cpu.pc)
+	}
+
+	cpu.Step()
+	if cpu.a[6] != 0xCAFEBABE || cpu.a[7] != 0x80000 {
+		t.Errorf("Expected A6 restored and SP = 0x00080000, got A6 0x%08X SP 0x%08X", cpu.a[6], cpu.a[7])
+	}
+
+	// The 68000 has no long form
+	cpu.SetCPUType(CPU68000)
+	memory.Write32(VectorIllegal*4, 0x00000600)
+	cpu.SetPC(0x400)
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Errorf("Expected illegal instruction handler at 0x600 on the 68000, got PC 0x%08X", cpu.pc)
+	}
+}
+
+// TestTRAPccInstruction tests TRAPNE with the condition false and true
+func TestTRAPccInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorTRAPV*4, 0x00000600)
+
+	cpu.Reset()
+
+	// TRAPNE.W #$1234 = 0x56FA 0x1234
+	memory.Write16(0x400, 0x56FA)
+	memory.Write16(0x402, 0x1234)
+	memory.Write16(0x404, 0x56FA)
+	memory.Write16(0x406, 0x1234)
+
+	// Z set: condition false, no trap, operand skipped
+	cpu.sr |= FlagZ
+	cpu.Step()
+	if cpu.pc != 0x404 {
+		t.Errorf("Expected PC = 0x404, got 0x%08X", cpu.pc)
+	}
+	if cpu.a[7] != 0x1000 {
+		t.Errorf("Expected SP = 0x1000, got 0x%08X", cpu.a[7])
+	}
+
+	// Z clear: condition true, trap to vector 7
+	cpu.sr &^= FlagZ
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Errorf("Expected PC = 0x600, got 0x%08X", cpu.pc)
+	}
+	// Format $2 frame: SR, PC, format/vector, instruction address
+	if cpu.a[7] != 0x1000-12 {
+		t.Errorf("Expected SP = 0x%08X, got 0x%08X", 0x1000-12, cpu.a[7])
+	}
+	if ret := memory.Read32(cpu.a[7] + 2); ret != 0x408 {
+		t.Errorf("Expected stacked PC = 0x408, got 0x%08X", ret)
+	}
+	if fv := memory.Read16(cpu.a[7] + 6); fv != 0x2000|VectorTRAPV<<2 {
+		t.Errorf("Expected format/vector word 0x%04X, got 0x%04X", 0x2000|VectorTRAPV<<2, fv)
+	}
+}
+
+// TestEXTBInstruction tests EXTB.L on the 68020 and its absence on the 68000
+func TestEXTBInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorIllegal*4, 0x00000600)
+
+	cpu.Reset()
+
+	// EXTB.L D2 = 0x49C2
+	cpu.d[2] = 0x12345680
+	memory.Write16(0x400, 0x49C2)
+
+	cpu.Step()
+
+	if cpu.d[2] != 0xFFFFFF80 {
+		t.Errorf("Expected D2 = 0xFFFFFF80, got 0x%08X", cpu.d[2])
+	}
+	if cpu.sr&FlagN == 0 {
+		t.Error("N flag should be set")
+	}
+	if cpu.sr&FlagZ != 0 {
+		t.Error("Z flag should be clear")
+	}
+
+	// The 68000 has no EXTB.L
+	cpu.SetCPUType(CPU68000)
+	cpu.Reset()
+	cpu.d[2] = 0x00000080
+	cpu.Step()
+
+	if cpu.d[2] != 0x00000080 {
+		t.Errorf("Expected D2 unchanged on 68000, got 0x%08X", cpu.d[2])
+	}
+	if cpu.pc != 0x600 {
+		t.Errorf("Expected illegal instruction vector, got PC = 0x%08X", cpu.pc)
+	}
+}
+
+// TestMOVECInstruction tests moving a value into VBR and reading it back
+func TestMOVECInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	// MOVEC D1,VBR = 0x4E7B 0x1801
+	memory.Write16(0x400, 0x4E7B)
+	memory.Write16(0x402, 0x1801)
+	// MOVEC VBR,A2 = 0x4E7A 0xA801
+	memory.Write16(0x404, 0x4E7A)
+	memory.Write16(0x406, 0xA801)
+
+	cpu.d[1] = 0x00008000
+	cpu.Step()
+
+	if cpu.vbr != 0x00008000 {
+		t.Errorf("Expected VBR = 0x8000, got 0x%08X", cpu.vbr)
+	}
+
+	cpu.Step()
+
+	if cpu.a[2] != 0x00008000 {
+		t.Errorf("Expected A2 = 0x8000, got 0x%08X", cpu.a[2])
+	}
+
+	// CACR does not exist on the 68010: illegal instruction through the new VBR
+	memory.Write32(0x8000+VectorIllegal*4, 0x00000600)
+	// MOVEC D0,CACR = 0x4E7B 0x0002
+	cpu.Poke16(0x408, 0x4E7B)
+	cpu.Poke16(0x40A, 0x0002)
+
+	cpu.Step()
+
+	if cpu.pc != 0x600 {
+		t.Errorf("Expected illegal instruction vector, got PC = 0x%08X", cpu.pc)
+	}
+
+	// MOVEC is privileged
+	memory.Write32(0x8000+VectorPrivilege*4, 0x00000700)
+	memory.Write16(0x600, 0x4E7A)
+	memory.Write16(0x602, 0xA801)
+	cpu.SetSR(0x0000)
+
+	cpu.Step()
+
+	if cpu.pc != 0x700 {
+		t.Errorf("Expected privilege violation vector, got PC = 0x%08X", cpu.pc)
+	}
+}
+
+// TestMOVESInstruction tests that MOVES writes through the DFC address space
+func TestMOVESInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.Reset()
+
+	var fcs []uint8
+	cpu.SetFCCallback(func(fc uint8) {
+		fcs = append(fcs, fc)
+	})
+
+	// MOVES.L D3,(A0) = 0x0E90 0x3800
+	memory.Write16(0x400, 0x0E90)
+	memory.Write16(0x402, 0x3800)
+
+	cpu.dfc = 1 // User data space
+	cpu.a[0] = 0x2000
+	cpu.d[3] = 0xCAFEBABE
+
+	cpu.Step()
+
+	if v := memory.Read32(0x2000); v != 0xCAFEBABE {
+		t.Errorf("Expected 0xCAFEBABE at 0x2000, got 0x%08X", v)
+	}
+	// Filling the prefetch queue, a prefetch for each of the opcode and
+	// extension words, then the write
+	if want := []uint8{FCSupervisorProg, FCSupervisorProg, FCSupervisorProg, FCSupervisorProg, 1}; fmt.Sprint(fcs) != fmt.Sprint(want) {
+		t.Errorf("Expected function codes %v, got %v", want, fcs)
+	}
+	if cpu.pc != 0x404 {
+		t.Errorf("Expected PC = 0x404, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestSCC68070LongAccessCycles tests that long accesses cost more on the SCC68070
+func TestSCC68070LongAccessCycles(t *testing.T) {
+	run := func(cpuType CPUType, opcode uint16) int {
+		cpu := NewCPU(cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write16(0x400, opcode)
+
+		cpu.Reset()
+		cpu.a[0] = 0x2000
+		return cpu.Step()
+	}
+
+	// MOVE.L (A0),D0 = 0x2010: one long read
+	base := run(CPU68000, 0x2010)
+	scc := run(CPUSCC68070, 0x2010)
+	if scc != base+8 {
+		t.Errorf("Expected MOVE.L to take %d cycles on SCC68070, got %d (68000: %d)", base+8, scc, base)
+	}
+
+	// MOVE.W (A0),D0 = 0x3010: word accesses are unaffected
+	base = run(CPU68000, 0x3010)
+	scc = run(CPUSCC68070, 0x3010)
+	if scc != base {
+		t.Errorf("Expected MOVE.W to take %d cycles on SCC68070, got %d", base, scc)
+	}
+}
+
+// TestSCC68070InstructionSet tests that the SCC68070 is a 68010-class core
+func TestSCC68070InstructionSet(t *testing.T) {
+	cpu := NewCPU(CPUSCC68070)
+	if cpu.is020Plus() {
+		t.Error("SCC68070 should not have the 68020 instruction set")
+	}
+}
+
+// berrMemory signals a bus error for accesses at or above 0x100000
+type berrMemory struct {
+	SimpleMemory
+	cpu *CPU
+}
+
+func (m *berrMemory) Write16(address uint32, value uint16) {
+	if address >= 0x100000 {
+		m.cpu.PulseBusError()
+		return
+	}
+	m.SimpleMemory.Write16(address, value)
+}
+
+func (m *berrMemory) Write32(address uint32, value uint32) {
+	if address >= 0x100000 {
+		m.cpu.PulseBusError()
+		return
+	}
+	m.SimpleMemory.Write32(address, value)
+}
+
+// TestBusErrorException tests bus error processing and double bus faults
+func TestBusErrorException(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &berrMemory{cpu: cpu}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorBusError*4, 0x00000600)
+	memory.Write16(0x400, 0x4E71)
+
+	// A bus error with a valid stack stacks a 14-byte frame
+	cpu.Reset()
+	cpu.PulseBusError()
+	if cpu.halted || cpu.pc != 0x600 {
+		t.Errorf("Expected bus error handler at 0x600, got PC = 0x%08X, halted = %v", cpu.pc, cpu.halted)
+	}
+	if cpu.a[7] != 0x1000-14 {
+		t.Errorf("Expected SP = 0x%08X, got 0x%08X", 0x1000-14, cpu.a[7])
+	}
+	if ret := memory.Read32(cpu.a[7] + 10); ret != 0x400 {
+		t.Errorf("Expected stacked PC = 0x400, got 0x%08X", ret)
+	}
+
+	// A bus error stacking the frame is a double fault
+	cpu.Reset()
+	cpu.a[7] = 0x100010
+	cpu.PulseBusError()
+	if !cpu.halted {
+		t.Error("Expected CPU to halt on a bus error while stacking the frame")
+	}
+	if cycles := cpu.Execute(100); cycles != 0 {
+		t.Errorf("Expected a halted CPU to execute nothing, ran %d cycles", cycles)
+	}
+
+	// An odd supervisor stack pointer cannot hold the frame
+	cpu.Reset()
+	cpu.a[7] = 0x1001
+	cpu.PulseBusError()
+	if !cpu.halted {
+		t.Error("Expected CPU to halt with an odd stack pointer")
+	}
+
+	// Reset recovers
+	cpu.Reset()
+	if cpu.halted {
+		t.Error("Expected reset to clear the halted state")
+	}
+}
+
+// TestBusErrorFrameFormats tests the bus error frame of each later CPU and
+// that RTE restarts the faulted instruction
+func TestBusErrorFrameFormats(t *testing.T) {
+	tests := []struct {
+		cpuType CPUType
+		size    uint32
+		format  uint16
+		addr    uint32 // Offset of the fault address in the frame
+		sswAt   uint32 // Offset of the special status word
+		ssw     uint16 // Write to supervisor data space
+	}{
+		{CPU68010, 58, 0x8008, 10, 8, 0x1005},
+		{CPUSCC68070, 58, 0x8008, 10, 8, 0x1005},
+		{CPU68020, 32, 0xA008, 16, 10, 0x0105},
+		{CPU68030, 32, 0xA008, 16, 10, 0x0105},
+		{CPU68040, 60, 0x7008, 20, 12, 0x0005},
+		{CPU68EC040, 60, 0x7008, 20, 12, 0x0005},
+	}
+	for _, tt := range tests {
+		cpu := NewCPU(tt.cpuType)
+		memory := &berrMemory{cpu: cpu}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write32(VectorBusError*4, 0x00000600)
+		memory.Write16(0x400, 0x2080) // MOVE.L D0,(A0)
+		memory.Write16(0x600, 0x4E73) // RTE
+
+		cpu.Reset()
+		cpu.d[0] = 0x12345678
+		cpu.a[0] = 0x100000
+		cpu.Step()
+		if cpu.pc != 0x600 {
+			t.Errorf("CPU %d: expected bus error handler at 0x600, got PC = 0x%08X", tt.cpuType, cpu.pc)
+			continue
+		}
+		sp := cpu.a[7]
+		if sp != 0x1000-tt.size {
+			t.Errorf("CPU %d: expected a %d-byte frame, got SP = 0x%08X", tt.cpuType, tt.size, sp)
+		}
+		if got := memory.Read32(sp + 2); got != 0x400 {
+			t.Errorf("CPU %d: expected stacked PC = 0x400, got 0x%08X", tt.cpuType, got)
+		}
+		if got := memory.Read16(sp + 6); got != tt.format {
+			t.Errorf("CPU %d: expected format word 0x%04X, got 0x%04X", tt.cpuType, tt.format, got)
+		}
+		if got := memory.Read32(sp + tt.addr); got != 0x100000 {
+			t.Errorf("CPU %d: expected fault address 0x100000, got 0x%08X", tt.cpuType, got)
+		}
+		if got := memory.Read16(sp + tt.sswAt); got != tt.ssw {
+			t.Errorf("CPU %d: expected SSW 0x%04X at offset %d, got 0x%04X", tt.cpuType, tt.ssw, tt.sswAt, got)
+		}
+
+		// RTE unwinds the whole frame and restarts the MOVE
+		cpu.a[0] = 0x3000
+		cpu.Step()
+		if cpu.pc != 0x400 || cpu.a[7] != 0x1000 {
+			t.Errorf("CPU %d: expected RTE to PC 0x400, SP 0x1000, got PC = 0x%08X, SP = 0x%08X", tt.cpuType, cpu.pc, cpu.a[7])
+		}
+		cpu.Step()
+		if got := memory.Read32(0x3000); got != 0x12345678 {
+			t.Errorf("CPU %d: expected the restarted MOVE to store 0x12345678, got 0x%08X", tt.cpuType, got)
+		}
+	}
+}
+
+// TestMOVEByteStackAlignment tests that byte pushes and pops keep SP word-aligned
+func TestMOVEByteStackAlignment(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// MOVE.B D0,-(SP) = 0x1F00
+	memory.Write16(0x400, 0x1F00)
+	// MOVE.B (SP)+,D1 = 0x121F
+	memory.Write16(0x402, 0x121F)
+
+	cpu.Reset()
+	cpu.d[0] = 0xAB
+
+	cpu.Step()
+
+	if cpu.a[7] != 0x0FFE {
+		t.Errorf("Expected SP = 0x0FFE after byte push, got 0x%08X", cpu.a[7])
+	}
+	// The byte goes in the high (even) half of the stacked word
+	if v := memory.Read8(0x0FFE); v != 0xAB {
+		t.Errorf("Expected 0xAB at 0x0FFE, got 0x%02X", v)
+	}
+
+	cpu.Step()
+
+	if cpu.a[7] != 0x1000 {
+		t.Errorf("Expected SP = 0x1000 after byte pop, got 0x%08X", cpu.a[7])
+	}
+	if cpu.d[1]&0xFF != 0xAB {
+		t.Errorf("Expected D1 = 0xAB, got 0x%02X", cpu.d[1]&0xFF)
+	}
+}
+
+// TestTRAPOddStack tests TRAP #n, and that an odd supervisor stack pointer
+// during exception processing halts the 68000 with a double fault
+func TestTRAPOddStack(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32((VectorTrap+5)*4, 0x00000600)
+	memory.Write32(VectorAddressError*4, 0x00000700)
+
+	// TRAP #5 = 0x4E45
+	memory.Write16(0x400, 0x4E45)
+
+	cpu.Reset()
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Fatalf("Expected TRAP #5 handler at 0x600, got PC 0x%08X", cpu.pc)
+	}
+	if ret := memory.Read32(cpu.a[7] + 2); ret != 0x402 {
+		t.Errorf("Expected stacked PC = 0x402, got 0x%08X", ret)
+	}
+
+	cpu.Reset()
+	cpu.a[7] = 0x0FFF
+	memory.Write32(0x0FF0, 0x12345678)
+	memory.Write32(0x0FF4, 0x9ABCDEF0)
+	memory.Write32(0x0FF8, 0x0BADF00D)
+	memory.Write32(0x0FFC, 0xCAFEBABE)
+	cpu.Step()
+	if !cpu.IsHalted() {
+		t.Fatalf("Expected an odd SSP to halt the CPU, got PC 0x%08X", cpu.pc)
+	}
+	if memory.Read32(0x0FF0) != 0x12345678 || memory.Read32(0x0FF4) != 0x9ABCDEF0 ||
+		memory.Read32(0x0FF8) != 0x0BADF00D || memory.Read32(0x0FFC) != 0xCAFEBABE {
+		t.Error("Expected no stack writes at the odd stack pointer")
+	}
+}
+
+// TestDBRALoop tests a five-iteration DBRA countdown
+func TestDBRALoop(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x7004) // MOVEQ #4,D0
+	memory.Write16(0x402, 0x5281) // loop: ADDQ.L #1,D1
+	memory.Write16(0x404, 0x51C8) // DBRA D0,loop
+	memory.Write16(0x406, 0xFFFC)
+	memory.Write16(0x408, 0x4E71) // NOP
+
+	cpu.Reset()
+	cpu.d[0] = 0xABCD0000
+
+	// MOVEQ + 5 x (ADDQ + DBRA)
+	for i := 0; i < 11; i++ {
+		cpu.Step()
+	}
+
+	if cpu.d[1] != 5 {
+		t.Errorf("Expected 5 iterations, got %d", cpu.d[1])
+	}
+	if cpu.d[0]&0xFFFF != 0xFFFF {
+		t.Errorf("Expected D0.W = 0xFFFF, got 0x%04X", cpu.d[0]&0xFFFF)
+	}
+	if cpu.pc != 0x408 {
+		t.Errorf("Expected PC = 0x408, got 0x%08X", cpu.pc)
+	}
+
+	// A true condition falls through without decrementing: DBT D2,*
+	cpu.Poke16(0x408, 0x50CA)
+	cpu.Poke16(0x40A, 0xFFFE)
+	cpu.d[2] = 3
+	if cycles := cpu.Step(); cycles != 12 {
+		t.Errorf("Expected DBT to take 12 cycles, got %d", cycles)
+	}
+	if cpu.d[2] != 3 || cpu.pc != 0x40C {
+		t.Errorf("Expected D2 = 3 and PC = 0x40C, got %d and 0x%08X", cpu.d[2], cpu.pc)
+	}
+}
+
+// TestMOVEQAndEORFlagsCycles tests MOVEQ and EOR flags and cycle counts
+func TestMOVEQAndEORFlagsCycles(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x70FF) // MOVEQ #-1,D0
+	memory.Write16(0x402, 0xB181) // EOR.L D0,D1
+	memory.Write16(0x404, 0xB380) // EOR.L D1,D0
+
+	cpu.Reset()
+	cpu.d[1] = 0xFFFFFFFF
+	cpu.sr |= FlagV | FlagC | FlagX
+
+	if cycles := cpu.Step(); cycles != 4 {
+		t.Errorf("Expected MOVEQ to take 4 cycles, got %d", cycles)
+	}
+	if cpu.d[0] != 0xFFFFFFFF {
+		t.Errorf("Expected D0 = 0xFFFFFFFF, got 0x%08X", cpu.d[0])
+	}
+	if cpu.sr&(FlagN|FlagZ|FlagV|FlagC|FlagX) != FlagN|FlagX {
+		t.Errorf("Expected N and X only after MOVEQ, got %s", cpu.FlagsString())
+	}
+
+	if cycles := cpu.Step(); cycles != 8 {
+		t.Errorf("Expected EOR.L Dn,Dn to take 8 cycles, got %d", cycles)
+	}
+	if cpu.d[1] != 0 || cpu.sr&FlagZ == 0 {
+		t.Errorf("Expected D1 = 0 with Z set, got 0x%08X %s", cpu.d[1], cpu.FlagsString())
+	}
+
+	cpu.Step()
+	if cpu.d[0] != 0xFFFFFFFF || cpu.sr&FlagN == 0 || cpu.sr&FlagZ != 0 {
+		t.Errorf("Expected D0 = 0xFFFFFFFF with N set, got 0x%08X %s", cpu.d[0], cpu.FlagsString())
+	}
+}
+
+// TestADDQAddressRegister tests ADDQ/SUBQ with an address register destination
+func TestADDQAddressRegister(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorIllegal*4, 0x00000800)
+
+	memory.Write16(0x400, 0x5248) // ADDQ.W #1,A0
+	memory.Write16(0x402, 0x5189) // SUBQ.L #8,A1
+	memory.Write16(0x404, 0x5208) // ADDQ.B #1,A0 (illegal)
+
+	cpu.Reset()
+	cpu.a[0] = 0x0000FFFF
+	cpu.a[1] = 0x00000004
+	cpu.sr |= FlagZ | FlagX
+
+	if cycles := cpu.Step(); cycles != 8 {
+		t.Errorf("Expected ADDQ.W to An to take 8 cycles, got %d", cycles)
+	}
+	if cpu.a[0] != 0x00010000 {
+		t.Errorf("Expected A0 = 0x00010000, got 0x%08X", cpu.a[0])
+	}
+	if cpu.sr&(FlagN|FlagZ|FlagV|FlagC|FlagX) != FlagZ|FlagX {
+		t.Errorf("Expected flags unchanged after ADDQ to An, got %s", cpu.FlagsString())
+	}
+
+	cpu.Step()
+	if cpu.a[1] != 0xFFFFFFFC {
+		t.Errorf("Expected A1 = 0xFFFFFFFC, got 0x%08X", cpu.a[1])
+	}
+	if cpu.sr&(FlagN|FlagZ|FlagV|FlagC|FlagX) != FlagZ|FlagX {
+		t.Errorf("Expected flags unchanged after SUBQ to An, got %s", cpu.FlagsString())
+	}
+
+	cpu.Step()
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected ADDQ.B to An to take the illegal instruction vector, got PC 0x%08X", cpu.pc)
+	}
+	if cpu.a[0] != 0x00010000 {
+		t.Errorf("Expected A0 unchanged by illegal ADDQ.B, got 0x%08X", cpu.a[0])
+	}
+}
+
+// TestCMPAInstruction tests CMPA.W and CMPA.L flags
+func TestCMPAInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0xB0FC) // CMPA.W #$8000,A0
+	memory.Write16(0x402, 0x8000)
+	memory.Write16(0x404, 0xB1FC) // CMPA.L #$00008000,A0
+	memory.Write32(0x406, 0x00008000)
+
+	cpu.Reset()
+	cpu.a[0] = 0x00008000
+	cpu.sr |= FlagX
+
+	// The word source is sign-extended to 0xFFFF8000, so it is not equal
+	// and the unsigned compare borrows
+	if cycles := cpu.Step(); cycles != 6 {
+		t.Errorf("Expected CMPA.W to take 6 cycles, got %d", cycles)
+	}
+	if cpu.sr&(FlagN|FlagZ|FlagV|FlagC|FlagX) != FlagC|FlagX {
+		t.Errorf("Expected C and X only after CMPA.W, got %s", cpu.FlagsString())
+	}
+
+	cpu.Step()
+	if cpu.sr&(FlagN|FlagZ|FlagV|FlagC|FlagX) != FlagZ|FlagX {
+		t.Errorf("Expected Z and X only after CMPA.L, got %s", cpu.FlagsString())
+	}
+	if cpu.a[0] != 0x00008000 {
+		t.Errorf("Expected A0 unchanged, got 0x%08X", cpu.a[0])
+	}
+}
+
+// TestADDIDisplacementDestination tests that the immediate is read before
+// the destination's extension words and that both are consumed only once
+func TestADDIDisplacementDestination(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x0668) // ADDI.W #$10,(8,A0)
+	memory.Write16(0x402, 0x0010)
+	memory.Write16(0x404, 0x0008)
+	memory.Write16(0x406, 0x0698) // ADDI.L #1,(A0)+
+	memory.Write32(0x408, 0x00000001)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+	memory.Write16(0x2008, 0x1234)
+	memory.Write32(0x2000, 0x0000FFFF)
+
+	cpu.Step()
+	if got := memory.Read16(0x2008); got != 0x1244 {
+		t.Errorf("Expected (8,A0) = 0x1244, got 0x%04X", got)
+	}
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected PC = 0x406 after ADDI.W, got 0x%08X", cpu.pc)
+	}
+
+	cpu.Step()
+	if got := memory.Read32(0x2000); got != 0x00010000 {
+		t.Errorf("Expected (A0) = 0x00010000, got 0x%08X", got)
+	}
+	if cpu.a[0] != 0x2004 {
+		t.Errorf("Expected A0 incremented once to 0x2004, got 0x%08X", cpu.a[0])
+	}
+}
+
+// TestDBccLoopMode tests that the 68010 runs tight DBcc loops in loop mode
+func TestDBccLoopMode(t *testing.T) {
+	run := func(cpuType CPUType) (dbraCycles []int) {
+		cpu := NewCPU(cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+
+		memory.Write16(0x400, 0x5281) // loop: ADDQ.L #1,D1
+		memory.Write16(0x402, 0x51C8) // DBRA D0,loop
+		memory.Write16(0x404, 0xFFFC)
+
+		cpu.Reset()
+		cpu.d[0] = 3
+
+		// 4 x (ADDQ + DBRA)
+		for i := 0; i < 4; i++ {
+			cpu.Step()
+			dbraCycles = append(dbraCycles, cpu.Step())
+		}
+		if cpu.d[1] != 4 || cpu.pc != 0x406 {
+			t.Errorf("%v: expected 4 iterations ending at 0x406, got %d at 0x%08X", cpuType, cpu.d[1], cpu.pc)
+		}
+		return dbraCycles
+	}
+
+	want68000 := []int{10, 10, 10, 14}
+	want68010 := []int{10, 6, 6, 14}
+
+	got := run(CPU68000)
+	for i := range want68000 {
+		if got[i] != want68000[i] {
+			t.Errorf("68000: expected DBRA cycles %v, got %v", want68000, got)
+			break
+		}
+	}
+
+	got = run(CPU68010)
+	for i := range want68010 {
+		if got[i] != want68010[i] {
+			t.Errorf("68010: expected DBRA cycles %v, got %v", want68010, got)
+			break
+		}
+	}
+}
+
+// TestBccCycles tests the taken and not-taken timing of both Bcc forms
+func TestBccCycles(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x6702) // BEQ.S *+4 (taken)
+	memory.Write16(0x404, 0x6700) // BEQ.W (not taken)
+	memory.Write16(0x406, 0x0010)
+	memory.Write16(0x408, 0x6602) // BNE.S (not taken)
+	memory.Write16(0x40A, 0x6700) // BEQ.W *+$10 (taken)
+	memory.Write16(0x40C, 0x000E)
+
+	cpu.Reset()
+
+	tests := []struct {
+		name   string
+		z      bool
+		cycles int
+		pc     uint32
+	}{
+		{"taken byte", true, 10, 0x404},
+		{"not taken word", false, 12, 0x408},
+		{"not taken byte", true, 8, 0x40A},
+		{"taken word", true, 10, 0x41A},
+	}
+	for _, tt := range tests {
+		if tt.z {
+			cpu.SetCCR(FlagZ)
+		} else {
+			cpu.SetCCR(0)
+		}
+		if cycles := cpu.Step(); cycles != tt.cycles {
+			t.Errorf("%s: expected %d cycles, got %d", tt.name, tt.cycles, cycles)
+		}
+		if cpu.pc != tt.pc {
+			t.Errorf("%s: expected PC = 0x%08X, got 0x%08X", tt.name, tt.pc, cpu.pc)
+		}
+	}
+}
+
+// TestMOVEfromCCR tests that MOVE from CCR is illegal on the 68000 and
+// works on the 68010
+func TestMOVEfromCCR(t *testing.T) {
+	for _, cpuType := range []CPUType{CPU68000, CPU68010} {
+		cpu := NewCPU(cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write32(VectorIllegal*4, 0x00000800)
+
+		memory.Write16(0x400, 0x42C0) // MOVE CCR,D0
+
+		cpu.Reset()
+		cpu.d[0] = 0xFFFFFFFF
+		cpu.sr |= FlagX | FlagZ
+		cpu.Step()
+
+		if cpuType == CPU68000 {
+			if cpu.pc != 0x800 {
+				t.Errorf("68000: expected illegal instruction trap, got PC 0x%08X", cpu.pc)
+			}
+			if cpu.d[0] != 0xFFFFFFFF {
+				t.Errorf("68000: expected D0 unchanged, got 0x%08X", cpu.d[0])
+			}
+			continue
+		}
+
+		if cpu.pc != 0x402 {
+			t.Errorf("68010: expected PC = 0x402, got 0x%08X", cpu.pc)
+		}
+		if cpu.d[0] != 0xFFFF0000|uint32(FlagX|FlagZ) {
+			t.Errorf("68010: expected D0 = 0x%08X, got 0x%08X", 0xFFFF0000|uint32(FlagX|FlagZ), cpu.d[0])
+		}
+	}
+}
+
+// TestMOVEfromSRPrivilege tests that MOVE from SR works in user mode on the
+// 68000 but is privileged on the 68010
+func TestMOVEfromSRPrivilege(t *testing.T) {
+	for _, cpuType := range []CPUType{CPU68000, CPU68010} {
+		cpu := NewCPU(cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write32(VectorPrivilege*4, 0x00000800)
+
+		// MOVE SR,D1 = 0x40C1
+		memory.Write16(0x400, 0x40C1)
+
+		cpu.Reset()
+		cpu.usp = 0x3000
+		cpu.SetSR(0x0015) // User mode, X Z C
+		cpu.Step()
+
+		if cpuType == CPU68000 {
+			if cpu.d[1] != 0x0015 || cpu.pc != 0x402 {
+				t.Errorf("68000: expected D1 = 0x0015 at 0x402, got 0x%08X at 0x%08X", cpu.d[1], cpu.pc)
+			}
+			continue
+		}
+		if cpu.pc != 0x800 || cpu.d[1] != 0 {
+			t.Errorf("%v: expected privilege violation at 0x800 with D1 untouched, got PC 0x%08X D1 0x%08X", cpuType, cpu.pc, cpu.d[1])
+		}
+
+		// Supervisor code may still read SR
+		cpu.SetSR(0x2704)
+		cpu.SetPC(0x400)
+		cpu.Step()
+		if cpu.d[1] != 0x2704 {
+			t.Errorf("%v: expected D1 = 0x2704 in supervisor mode, got 0x%08X", cpuType, cpu.d[1])
+		}
+	}
+}
+
+// TestMOVEUSPPrivilege tests that MOVE An,USP traps in user mode and
+// sets USP in supervisor mode
+func TestMOVEUSPPrivilege(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorPrivilege*4, 0x00000800)
+
+	// MOVE A0,USP = 0x4E60
+	memory.Write16(0x400, 0x4E60)
+	// MOVE USP,A1 = 0x4E69
+	memory.Write16(0x402, 0x4E69)
+
+	cpu.Reset()
+	cpu.usp = 0x3000
+	cpu.SetSR(0x0000)
+	cpu.a[0] = 0x5000
+	cpu.Step()
+
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected privilege violation at 0x800, got PC 0x%08X", cpu.pc)
+	}
+	if cpu.usp != 0x3000 {
+		t.Errorf("Expected USP untouched, got 0x%08X", cpu.usp)
+	}
+
+	cpu.SetPC(0x400)
+	cpu.Step()
+	cpu.Step()
+	if cpu.usp != 0x5000 || cpu.a[1] != 0x5000 {
+		t.Errorf("Expected USP = A1 = 0x5000 in supervisor mode, got USP 0x%08X A1 0x%08X", cpu.usp, cpu.a[1])
+	}
+	if cpu.pc != 0x404 {
+		t.Errorf("Expected PC = 0x404, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestSccCycles tests that Scc timing depends on the condition and destination
+func TestSccCycles(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x50C0) // ST D0
+	memory.Write16(0x402, 0x51C1) // SF D1
+	memory.Write16(0x404, 0x50D0) // ST (A0)
+
+	cpu.Reset()
+	cpu.d[1] = 0xFFFFFFFF
+	cpu.a[0] = 0x2000
+
+	if cycles := cpu.Step(); cycles != 6 {
+		t.Errorf("Expected ST D0 to take 6 cycles, got %d", cycles)
+	}
+	if cpu.d[0] != 0x000000FF {
+		t.Errorf("Expected D0 = 0x000000FF, got 0x%08X", cpu.d[0])
+	}
+
+	if cycles := cpu.Step(); cycles != 4 {
+		t.Errorf("Expected SF D1 to take 4 cycles, got %d", cycles)
+	}
+	if cpu.d[1] != 0xFFFFFF00 {
+		t.Errorf("Expected D1 = 0xFFFFFF00, got 0x%08X", cpu.d[1])
+	}
+
+	if cycles := cpu.Step(); cycles != 12 {
+		t.Errorf("Expected ST (A0) to take 12 cycles, got %d", cycles)
+	}
+	if got := memory.Read8(0x2000); got != 0xFF {
+		t.Errorf("Expected 0xFF at 0x2000, got 0x%02X", got)
+	}
+}
+
+// TestSccMemory tests that Scc on memory writes the byte whatever the
+// condition, after a read cycle on the 68000
+func TestSccMemory(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x57D0) // SEQ (A0)
+	memory.Write16(0x402, 0x57D0) // SEQ (A0)
+	memory.Write16(0x404, 0x57E8) // SEQ $10(A0)
+	memory.Write16(0x406, 0x0010)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+
+	var reads, writes int
+	cpu.SetWatchpointCallback(func(addr uint32, size int, isWrite bool, value uint32) {
+		if isWrite {
+			writes++
+		} else {
+			reads++
+		}
+	})
+	cpu.AddWatchpoint(0x2000, true, true)
+
+	cpu.SetCCR(FlagZ)
+	if cycles := cpu.Step(); cycles != 12 {
+		t.Errorf("Expected SEQ (A0) to take 12 cycles, got %d", cycles)
+	}
+	if got := memory.Read8(0x2000); got != 0xFF {
+		t.Errorf("Expected 0xFF with Z set, got 0x%02X", got)
+	}
+
+	cpu.SetCCR(0)
+	if cycles := cpu.Step(); cycles != 12 {
+		t.Errorf("Expected SEQ (A0) to take 12 cycles, got %d", cycles)
+	}
+	if got := memory.Read8(0x2000); got != 0x00 {
+		t.Errorf("Expected 0x00 with Z clear, got 0x%02X", got)
+	}
+	if reads != 2 || writes != 2 {
+		t.Errorf("Expected a read and a write per SEQ, got %d reads and %d writes", reads, writes)
+	}
+
+	memory.Write8(0x2010, 0x55)
+	if cycles := cpu.Step(); cycles != 16 {
+		t.Errorf("Expected SEQ $10(A0) to take 16 cycles, got %d", cycles)
+	}
+	if got := memory.Read8(0x2010); got != 0x00 {
+		t.Errorf("Expected 0x00 at 0x2010, got 0x%02X", got)
+	}
+}
+
+// TestTASInstruction tests TAS and the TAS callback
+func TestTASInstruction(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x4AD0) // TAS (A0)
+	memory.Write16(0x402, 0x4AD0) // TAS (A0)
+	memory.Write16(0x404, 0x4AD0) // TAS (A0)
+	memory.Write16(0x406, 0x4AC1) // TAS D1
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+	cpu.d[1] = 0x12345681
+
+	// The callback blocks the write-back
+	calls := 0
+	cpu.SetTASCallback(func() int {
+		calls++
+		return 1
+	})
+	cpu.Step()
+	if got := memory.Read8(0x2000); got != 0x00 {
+		t.Errorf("Expected write-back to be skipped, got 0x%02X", got)
+	}
+	if calls != 1 || cpu.sr&FlagZ == 0 {
+		t.Errorf("Expected one callback and Z set from the byte read, got %d calls %s", calls, cpu.FlagsString())
+	}
+
+	// The callback allows the write-back
+	cpu.SetTASCallback(func() int { return 0 })
+	if cycles := cpu.Step(); cycles != 10 {
+		t.Errorf("Expected TAS (A0) to take 10 cycles, got %d", cycles)
+	}
+	if got := memory.Read8(0x2000); got != 0x80 {
+		t.Errorf("Expected bit 7 set, got 0x%02X", got)
+	}
+
+	// The byte is now negative
+	cpu.SetTASCallback(nil)
+	cpu.Step()
+	if cpu.sr&FlagN == 0 || cpu.sr&FlagZ != 0 {
+		t.Errorf("Expected N set from the byte read, got %s", cpu.FlagsString())
+	}
+
+	if cycles := cpu.Step(); cycles != 4 {
+		t.Errorf("Expected TAS D1 to take 4 cycles, got %d", cycles)
+	}
+	if cpu.d[1] != 0x12345681 || cpu.sr&FlagN == 0 {
+		t.Errorf("Expected D1 = 0x12345681 with N set, got 0x%08X %s", cpu.d[1], cpu.FlagsString())
+	}
+}
+
+// TestCALLMRTM tests a CALLM/RTM module call round trip
+func TestCALLMRTM(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// Module descriptor at 0x2000: type 0, entry at 0x3000, data at 0x4000
+	memory.Write32(0x2000, 0x00000000)
+	memory.Write32(0x2004, 0x00003000)
+	memory.Write32(0x2008, 0x00004000)
+
+	// Entry word: load A5 with the data area pointer
+	memory.Write16(0x3000, 0xD000)
+	// MOVEQ #$12,D0
+	memory.Write16(0x3002, 0x7012)
+	// RTM A5 = 0x06CD
+	memory.Write16(0x3004, 0x06CD)
+
+	// MOVE.L D1,-(A7) = 0x2F01 (one long argument)
+	memory.Write16(0x400, 0x2F01)
+	// CALLM #4,(A0) = 0x06D0 0x0004
+	memory.Write16(0x402, 0x06D0)
+	memory.Write16(0x404, 0x0004)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+	cpu.a[5] = 0x12345678
+
+	cpu.Step()
+	cpu.SetCCR(FlagX | FlagC)
+	cpu.Step()
+
+	if cpu.pc != 0x3002 {
+		t.Errorf("Expected module entry at 0x3002, got PC 0x%08X", cpu.pc)
+	}
+	if cpu.a[5] != 0x4000 {
+		t.Errorf("Expected A5 = module data area 0x4000, got 0x%08X", cpu.a[5])
+	}
+	if cpu.a[7] != 0x1000-4-24 {
+		t.Errorf("Expected SP = 0x%08X after CALLM, got 0x%08X", 0x1000-4-24, cpu.a[7])
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected return to 0x406, got PC 0x%08X", cpu.pc)
+	}
+	if cpu.a[5] != 0x12345678 {
+		t.Errorf("Expected A5 restored to 0x12345678, got 0x%08X", cpu.a[5])
+	}
+	if cpu.a[7] != 0x1000 {
+		t.Errorf("Expected SP = 0x1000 with arguments deallocated, got 0x%08X", cpu.a[7])
+	}
+	if cpu.GetCCR() != FlagX|FlagC {
+		t.Errorf("Expected CCR restored to 0x%02X, got 0x%02X", FlagX|FlagC, cpu.GetCCR())
+	}
+	if cpu.d[0] != 0x12 {
+		t.Errorf("Expected module code to run, D0 = 0x%08X", cpu.d[0])
+	}
+
+	// CALLM is illegal on other CPUs
+	cpu.SetCPUType(CPU68030)
+	memory.Write32(VectorIllegal*4, 0x00000800)
+	cpu.pc = 0x402
+	cpu.Step()
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected illegal instruction on 68030, got PC 0x%08X", cpu.pc)
+	}
+}
+
+// TestRTEFrameFormat tests that RTE unwinds valid frame formats and takes a
+// format error exception for an invalid one
+func TestRTEFrameFormat(t *testing.T) {
+	tests := []struct {
+		cpuType CPUType
+		format  uint16
+		valid   bool
+		size    uint32
+	}{
+		{CPU68010, 0x0, true, 8},
+		{CPU68010, 0x2, false, 0},
+		{CPU68010, 0xF, false, 0},
+		{CPU68020, 0x2, true, 12},
+		{CPU68020, 0xB, true, 92},
+		{CPU68020, 0x7, false, 0},
+		{CPU68040, 0x7, true, 60},
+		{CPU68EC040, 0x7, true, 60},
+		{CPU68LC040, 0x3, true, 12},
+		{CPU68EC040, 0xB, false, 0},
+	}
+
+	for _, tt := range tests {
+		cpu := NewCPU(tt.cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write32(VectorFormatError*4, 0x00000800)
+		memory.Write16(0x400, 0x4E73) // RTE
+
+		// Frame at 0xF00: SR, PC, format/vector word
+		memory.Write16(0xF00, 0x2700)
+		memory.Write32(0xF02, 0x00000600)
+		memory.Write16(0xF06, tt.format<<12)
+
+		cpu.Reset()
+		cpu.a[7] = 0xF00
+		cpu.Step()
+
+		name := fmt.Sprintf("%v format $%X", tt.cpuType, tt.format)
+		if tt.valid {
+			if cpu.pc != 0x600 || cpu.a[7] != 0xF00+tt.size {
+				t.Errorf("%s: expected return to 0x600 with SP 0x%X, got PC 0x%08X SP 0x%08X", name, 0xF00+tt.size, cpu.pc, cpu.a[7])
+			}
+			continue
+		}
+		if cpu.pc != 0x800 {
+			t.Errorf("%s: expected format error handler at 0x800, got PC 0x%08X", name, cpu.pc)
+		}
+		// The bad frame stays below the format error frame
+		if got := memory.Read32(cpu.a[7] + 2); got != 0x400 {
+			t.Errorf("%s: expected the format error to return to RTE at 0x400, got 0x%08X", name, got)
+		}
+		if got := memory.Read16(cpu.a[7] + 6); got != VectorFormatError<<2 {
+			t.Errorf("%s: expected vector offset 0x%X, got 0x%04X", name, VectorFormatError<<2, got)
+		}
+	}
+}
+
+// TestMOVE16 tests the postincrement and absolute forms of MOVE16
+func TestMOVE16(t *testing.T) {
+	cpu := NewCPU(CPU68040)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// MOVE16 (A0)+,(A1)+ = 0xF620 0x9000
+	memory.Write16(0x400, 0xF620)
+	memory.Write16(0x402, 0x9000)
+	// MOVE16 ($00003000).L,(A2) = 0xF61A
+	memory.Write16(0x404, 0xF61A)
+	memory.Write32(0x406, 0x00003000)
+
+	for i := uint32(0); i < 16; i += 4 {
+		memory.Write32(0x2000+i, 0x11111111*(i/4+1))
+		memory.Write32(0x3000+i, 0xA0B0C0D0+i)
+	}
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+	cpu.a[1] = 0x2800
+	cpu.a[2] = 0x2C08 // Low bits are ignored
+
+	cpu.Step()
+	for i := uint32(0); i < 16; i += 4 {
+		if got, want := memory.Read32(0x2800+i), 0x11111111*(i/4+1); got != want {
+			t.Errorf("Expected 0x%08X at 0x%X, got 0x%08X", want, 0x2800+i, got)
+		}
+	}
+	if cpu.a[0] != 0x2010 || cpu.a[1] != 0x2810 {
+		t.Errorf("Expected A0 = 0x2010 and A1 = 0x2810, got 0x%08X and 0x%08X", cpu.a[0], cpu.a[1])
+	}
+
+	cpu.Step()
+	if got := memory.Read32(0x2C0C); got != 0xA0B0C0DC {
+		t.Errorf("Expected 0xA0B0C0DC at 0x2C0C, got 0x%08X", got)
+	}
+	if cpu.a[2] != 0x2C08 {
+		t.Errorf("Expected A2 unchanged, got 0x%08X", cpu.a[2])
+	}
+	if cpu.pc != 0x40A {
+		t.Errorf("Expected PC = 0x40A, got 0x%08X", cpu.pc)
+	}
+
+	// Other CPUs take a line F exception
+	memory.Write32(VectorLineF*4, 0x00000800)
+	cpu.SetCPUType(CPU68030)
+	cpu.Reset()
+	cpu.Step()
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected line F exception on the 68030, got PC 0x%08X", cpu.pc)
+	}
+}
+
+// TestMOVEMCycles tests that MOVEM transfers the registers in its mask and
+// charges cycles per register
+func TestMOVEMCycles(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x48E7) // MOVEM.L D0-D1,-(A7)
+	memory.Write16(0x402, 0xC000)
+	memory.Write16(0x404, 0x48E7) // MOVEM.L D0-D7,-(A7)
+	memory.Write16(0x406, 0xFF00)
+	memory.Write16(0x408, 0x4CDF) // MOVEM.L (A7)+,D0-D7
+	memory.Write16(0x40A, 0x00FF)
+	memory.Write16(0x40C, 0x4C9F) // MOVEM.W (A7)+,D0-D1
+	memory.Write16(0x40E, 0x0003)
+
+	cpu.Reset()
+	for i := range cpu.d {
+		cpu.d[i] = uint32(i+1) * 0x11111111
+	}
+	cpu.d[0] = 0x00008000
+
+	tests := []struct {
+		name   string
+		cycles int
+		sp     uint32
+	}{
+		{"MOVEM.L 2 registers to memory", 8 + 2*8, 0x1000 - 8},
+		{"MOVEM.L 8 registers to memory", 8 + 8*8, 0x1000 - 40},
+		{"MOVEM.L 8 registers from memory", 12 + 8*8, 0x1000 - 8},
+		{"MOVEM.W 2 registers from memory", 12 + 2*4, 0x1000 - 4},
+	}
+	for _, tt := range tests {
+		if cycles := cpu.Step(); cycles != tt.cycles {
+			t.Errorf("%s: expected %d cycles, got %d", tt.name, tt.cycles, cycles)
+		}
+		if cpu.a[7] != tt.sp {
+			t.Errorf("%s: expected SP = 0x%08X, got 0x%08X", tt.name, tt.sp, cpu.a[7])
+		}
+	}
+
+	// D0 was stored first, at the lowest address
+	if memory.Read32(0x1000-40) != 0x00008000 || memory.Read32(0x1000-36) != 0x22222222 {
+		t.Errorf("Expected D0 and D1 at the bottom of the saved block, got 0x%08X 0x%08X",
+			memory.Read32(0x1000-40), memory.Read32(0x1000-36))
+	}
+	if cpu.d[7] != 0x88888888 {
+		t.Errorf("Expected D7 restored to 0x88888888, got 0x%08X", cpu.d[7])
+	}
+	// Word transfers are sign-extended into the register
+	if cpu.d[0] != 0 || cpu.d[1] != 0xFFFF8000 {
+		t.Errorf("Expected D0 = 0 and D1 = 0xFFFF8000, got 0x%08X 0x%08X", cpu.d[0], cpu.d[1])
+	}
+}
+
+// TestTraceException tests that the T bit traps to vector 9 after each
+// instruction, and that T0 on the 68020 traps only after changes of flow
+func TestTraceException(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorTrace*4, 0x00000600)
+	memory.Write16(0x400, 0x4E71) // NOP
+	memory.Write16(0x600, 0x4E71) // NOP
+
+	cpu.Reset()
+	cpu.SetSR(0xA700)
+
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Fatalf("Expected trace handler at 0x600 after NOP, got PC 0x%08X", cpu.pc)
+	}
+	if got := memory.Read32(0x1000 - 4); got != 0x402 {
+		t.Errorf("Expected stacked PC 0x402, got 0x%08X", got)
+	}
+	if got := memory.Read16(0x1000 - 6); got != 0xA700 {
+		t.Errorf("Expected stacked SR 0xA700, got 0x%04X", got)
+	}
+	if cpu.sr&FlagT != 0 {
+		t.Error("Expected T cleared in the trace handler")
+	}
+
+	// The handler itself is not traced
+	cpu.Step()
+	if cpu.pc != 0x602 {
+		t.Errorf("Expected the handler to run untraced, got PC 0x%08X", cpu.pc)
+	}
+
+	// T0 on the 68020 traces a jump but not a NOP
+	cpu = NewCPU(CPU68020)
+	cpu.SetMemoryHandler(memory)
+	memory.Write16(0x402, 0x4EF8) // JMP $0500.W
+	memory.Write16(0x404, 0x0500)
+	cpu.Reset()
+	cpu.SetSR(0x6700)
+
+	cpu.Step()
+	if cpu.pc != 0x402 {
+		t.Errorf("Expected no trace after NOP with T0, got PC 0x%08X", cpu.pc)
+	}
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Fatalf("Expected trace handler at 0x600 after JMP with T0, got PC 0x%08X", cpu.pc)
+	}
+	// Format $2 frame: SR, PC, format/vector, instruction address
+	if got := memory.Read32(0x1000 - 10); got != 0x500 {
+		t.Errorf("Expected stacked PC 0x500, got 0x%08X", got)
+	}
+	if got := memory.Read32(0x1000 - 4); got != 0x402 {
+		t.Errorf("Expected stacked instruction address 0x402, got 0x%08X", got)
+	}
+}
+
+// TestExtendChain tests that X carries between multi-precision ADDX and
+// SUBX steps, and that logical operations in between leave it alone
+func TestExtendChain(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// 96-bit D2:D1:D0 += D5:D4:D3
+	memory.Write16(0x400, 0xD083) // ADD.L D3,D0
+	memory.Write16(0x402, 0xD384) // ADDX.L D4,D1
+	memory.Write16(0x404, 0x4687) // NOT.L D7
+	memory.Write16(0x406, 0xD585) // ADDX.L D5,D2
+	// 64-bit ($2000) -= ($2010)
+	memory.Write16(0x408, 0x9388) // SUBX.L -(A0),-(A1)
+	memory.Write16(0x40A, 0x9388) // SUBX.L -(A0),-(A1)
+
+	cpu.Reset()
+	cpu.d[0], cpu.d[1], cpu.d[2] = 0xFFFFFFFF, 0xFFFFFFFF, 0x00000001
+	cpu.d[3], cpu.d[4], cpu.d[5] = 0x00000001, 0x00000000, 0x00000002
+
+	cpu.Step()
+	if cpu.d[0] != 0 || cpu.sr&FlagX == 0 {
+		t.Fatalf("Expected ADD.L to give 0 with X set, got 0x%08X SR 0x%04X", cpu.d[0], cpu.sr)
+	}
+	cpu.Step()
+	if cpu.d[1] != 0 || cpu.sr&(FlagX|FlagZ) != FlagX|FlagZ {
+		t.Errorf("Expected ADDX.L to give 0 with X and Z set, got 0x%08X SR 0x%04X", cpu.d[1], cpu.sr)
+	}
+	cpu.Step()
+	if cpu.sr&FlagX == 0 {
+		t.Error("Expected NOT.L to leave X set")
+	}
+	cpu.Step()
+	if cpu.d[2] != 4 {
+		t.Errorf("Expected the high long word 1 + 2 + X = 4, got 0x%08X", cpu.d[2])
+	}
+	if cpu.sr&(FlagX|FlagZ) != 0 {
+		t.Errorf("Expected X and Z clear after the last ADDX.L, got SR 0x%04X", cpu.sr)
+	}
+
+	memory.Write32(0x2000, 0x00000001)
+	memory.Write32(0x2004, 0x00000000)
+	memory.Write32(0x2010, 0x00000000)
+	memory.Write32(0x2014, 0x00000001)
+	cpu.a[0] = 0x2018
+	cpu.a[1] = 0x2008
+	cpu.SetCCR(FlagZ)
+
+	if cycles := cpu.Step(); cycles != 30 {
+		t.Errorf("Expected SUBX.L -(A0),-(A1) to take 30 cycles, got %d", cycles)
+	}
+	cpu.Step()
+	if hi, lo := memory.Read32(0x2000), memory.Read32(0x2004); hi != 0 || lo != 0xFFFFFFFF {
+		t.Errorf("Expected $00000000FFFFFFFF, got $%08X%08X", hi, lo)
+	}
+	if cpu.sr&(FlagX|FlagZ) != 0 {
+		t.Errorf("Expected X and Z clear, got SR 0x%04X", cpu.sr)
+	}
+	if cpu.a[0] != 0x2010 || cpu.a[1] != 0x2000 {
+		t.Errorf("Expected A0 = 0x2010 and A1 = 0x2000, got 0x%08X and 0x%08X", cpu.a[0], cpu.a[1])
+	}
+}
+
+// TestNEGFlags tests the flags of NEG and NEGX at the edge cases
+func TestNEGFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  uint16
+		x       bool
+		d0      uint32
+		want    uint32
+		flags   uint16
+		initial uint16
+	}{
+		{"NEG.B 0", 0x4400, false, 0x00, 0x00, FlagZ, 0},
+		{"NEG.B $80", 0x4400, false, 0x80, 0x80, FlagX | FlagN | FlagV | FlagC, 0},
+		{"NEG.B $01", 0x4400, false, 0x01, 0xFF, FlagX | FlagN | FlagC, 0},
+		{"NEG.L 0 clears X", 0x4480, true, 0x00, 0x00, FlagZ, FlagX},
+		{"NEGX.B 0 with X", 0x4000, true, 0x00, 0xFF, FlagX | FlagN | FlagC, FlagX},
+		{"NEGX.B 0 keeps Z", 0x4000, false, 0x00, 0x00, FlagZ, FlagZ},
+		{"NEGX.B 0 never sets Z", 0x4000, false, 0x00, 0x00, 0, 0},
+		{"NEGX.W $8000", 0x4040, false, 0x8000, 0x8000, FlagX | FlagN | FlagV | FlagC, 0},
+	}
+
+	for _, tt := range tests {
+		cpu := NewCPU(CPU68000)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write16(0x400, tt.opcode)
+		cpu.Reset()
+
+		cpu.d[0] = tt.d0
+		cpu.SetCCR(uint8(tt.initial))
+		cpu.Step()
+
+		if got := maskValue(cpu.d[0], getSize(tt.opcode, 6)); got != tt.want {
+			t.Errorf("%s: expected result 0x%X, got 0x%X", tt.name, tt.want, got)
+		}
+		if got := cpu.sr & 0x1F; got != tt.flags {
+			t.Errorf("%s: expected CCR 0x%02X, got 0x%02X", tt.name, tt.flags, got)
+		}
+	}
+}
+
+// TestMOVEMPredecrementBase tests the value stored for the base register
+// of a predecrement MOVEM, which depends on the CPU type
+func TestMOVEMPredecrementBase(t *testing.T) {
+	for _, tt := range []struct {
+		cpuType CPUType
+		want    uint32
+	}{
+		{CPU68000, 0x1000},
+		{CPU68010, 0x1000},
+		{CPU68020, 0x0FFC},
+	} {
+		cpu := NewCPU(tt.cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+
+		// MOVEM.L A7/D0,-(A7)
+		memory.Write16(0x400, 0x48E7)
+		memory.Write16(0x402, 0x8001)
+
+		cpu.Reset()
+		cpu.d[0] = 0x12345678
+		cpu.Step()
+
+		if got := memory.Read32(0xFFC); got != tt.want {
+			t.Errorf("%v: expected A7 stored as 0x%08X, got 0x%08X", tt.cpuType, tt.want, got)
+		}
+		if got := memory.Read32(0xFF8); got != 0x12345678 {
+			t.Errorf("%v: expected D0 stored below A7, got 0x%08X", tt.cpuType, got)
+		}
+		if cpu.a[7] != 0xFF8 {
+			t.Errorf("%v: expected A7 = 0xFF8, got 0x%08X", tt.cpuType, cpu.a[7])
+		}
+	}
+}
+
+// TestMULCycles tests multiply results and that the 68000's data-dependent
+// timing differs from the 68020's fixed cost
+func TestMULCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpuType CPUType
+		opcode  uint16
+		d1      uint32
+		want    uint32
+		cycles  int
+	}{
+		{"68000 MULU.W $FFFF", CPU68000, 0xC0C1, 0xFFFF, 0x0001FFFE, 70},
+		{"68000 MULU.W 0", CPU68000, 0xC0C1, 0x0000, 0x00000000, 38},
+		{"68020 MULU.W $FFFF", CPU68020, 0xC0C1, 0xFFFF, 0x0001FFFE, 27},
+		{"68000 MULS.W -1", CPU68000, 0xC1C1, 0xFFFF, 0xFFFFFFFE, 40},
+		{"68000 MULS.W $5555", CPU68000, 0xC1C1, 0x5555, 0x0000AAAA, 70},
+		// MULU.W (A0),D0 with $FFFF at (A0)
+		{"68000 MULU.W (A0)", CPU68000, 0xC0D0, 0, 0x0001FFFE, 74},
+		{"68010 MULU.W (A0)", CPU68010, 0xC0D0, 0, 0x0001FFFE, 44},
+		{"68020 MULU.W (A0)", CPU68020, 0xC0D0, 0, 0x0001FFFE, 27},
+	}
+
+	for _, tt := range tests {
+		cpu := NewCPU(tt.cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write16(0x400, tt.opcode)
+		memory.Write16(0x2000, 0xFFFF)
+
+		cpu.Reset()
+		cpu.d[0] = 2
+		cpu.d[1] = tt.d1
+		cpu.a[0] = 0x2000
+		cycles := cpu.Step()
+
+		if cpu.d[0] != tt.want {
+			t.Errorf("%s: expected D0 = 0x%08X, got 0x%08X", tt.name, tt.want, cpu.d[0])
+		}
+		if cycles != tt.cycles {
+			t.Errorf("%s: expected %d cycles, got %d", tt.name, tt.cycles, cycles)
+		}
+	}
+}
+
+// TestLogicalImmediateToCCR tests that ORI, ANDI and EORI to CCR only
+// change the five defined CCR bits
+func TestLogicalImmediateToCCR(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		imm    uint16
+		ccr    uint8
+		want   uint16
+	}{
+		{"ORI #$FF,CCR", 0x003C, 0x00FF, 0x00, 0x271F},
+		{"ANDI #$E5,CCR", 0x023C, 0x00E5, 0x1F, 0x2705},
+		{"EORI #$FF,CCR", 0x0A3C, 0x00FF, 0x0A, 0x2715},
+	}
+
+	for _, tt := range tests {
+		cpu := NewCPU(CPU68000)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write16(0x400, tt.opcode)
+		memory.Write16(0x402, tt.imm)
+
+		cpu.Reset()
+		cpu.SetCCR(tt.ccr)
+		cycles := cpu.Step()
+
+		if cpu.sr != tt.want {
+			t.Errorf("%s: expected SR = 0x%04X, got 0x%04X", tt.name, tt.want, cpu.sr)
+		}
+		if cycles != 20 {
+			t.Errorf("%s: expected 20 cycles, got %d", tt.name, cycles)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package musashi
+
+// memory.go - Built-in memory implementations
+
+import "io"
+
+// Read16BE reads a big-endian word from b at off
+func Read16BE(b []byte, off uint32) uint16 {
+	return uint16(b[off])<<8 | uint16(b[off+1])
+}
+
+// Read32BE reads a big-endian longword from b at off
+func Read32BE(b []byte, off uint32) uint32 {
+	return uint32(b[off])<<24 | uint32(b[off+1])<<16 | uint32(b[off+2])<<8 | uint32(b[off+3])
+}
+
+// Write16BE writes a big-endian word to b at off
+func Write16BE(b []byte, off uint32, value uint16) {
+	b[off] = uint8(value >> 8)
+	b[off+1] = uint8(value)
+}
+
+// Write32BE writes a big-endian longword to b at off
+func Write32BE(b []byte, off uint32, value uint32) {
+	b[off] = uint8(value >> 24)
+	b[off+1] = uint8(value >> 16)
+	b[off+2] = uint8(value >> 8)
+	b[off+3] = uint8(value)
+}
+
+// RAM is a flat, big-endian block of memory implementing MemoryHandler.
+// Addresses wrap around at the end of the RAM, so it is mirrored across
+// the address space like RAM with incomplete address decoding.
+type RAM struct {
+	data []byte
+	mask uint32
+}
+
+// NewRAM creates a RAM of the given size in bytes. The size is rounded up
+// to a power of two (from 4 bytes to 2GB) so that addresses can be masked.
+func NewRAM(size uint32) *RAM {
+	n := uint32(4)
+	for n < size && n < 1<<31 {
+		n <<= 1
+	}
+	return &RAM{data: make([]byte, n), mask: n - 1}
+}
+
+// Size returns the size of the RAM in bytes
+func (r *RAM) Size() uint32 {
+	return r.mask + 1
+}
+
+// Load copies data into the RAM starting at the given address
+func (r *RAM) Load(address uint32, data []byte) {
+	for i, b := range data {
+		r.data[(address+uint32(i))&r.mask] = b
+	}
+}
+
+// Bytes returns the RAM contents. The slice aliases the RAM.
+func (r *RAM) Bytes() []byte {
+	return r.data
+}
+
+// Read8 reads a byte from the specified address
+func (r *RAM) Read8(address uint32) uint8 {
+	return r.data[address&r.mask]
+}
+
+// Read16 reads a big-endian word from the specified address
+func (r *RAM) Read16(address uint32) uint16 {
+	return uint16(r.data[address&r.mask])<<8 | uint16(r.data[(address+1)&r.mask])
+}
+
+// Read32 reads a big-endian longword from the specified address
+func (r *RAM) Read32(address uint32) uint32 {
+	return uint32(r.Read16(address))<<16 | uint32(r.Read16(address+2))
+}
+
+// Write8 writes a byte to the specified address
+func (r *RAM) Write8(address uint32, value uint8) {
+	r.data[address&r.mask] = value
+}
+
+// Write16 writes a big-endian word to the specified address
+func (r *RAM) Write16(address uint32, value uint16) {
+	r.data[address&r.mask] = uint8(value >> 8)
+	r.data[(address+1)&r.mask] = uint8(value)
+}
+
+// Write32 writes a big-endian longword to the specified address
+func (r *RAM) Write32(address uint32, value uint32) {
+	r.Write16(address, uint16(value>>16))
+	r.Write16(address+2, uint16(value))
+}
+
+// romBlockSize is the granularity at which a ROM reads its backing store
+const romBlockSize = 4096
+
+// ROM is a read-only MemoryHandler backed by an io.ReaderAt, such as an
+// open ROM image file, so large images need not be held in memory. Blocks
+// are read on first access and cached. Like a Bus handler it receives full
+// addresses; reads outside the ROM return 0 and writes are ignored.
+type ROM struct {
+	r      io.ReaderAt
+	base   uint32
+	size   uint32
+	blocks map[uint32][]byte
+	err    error
+}
+
+// NewROM creates a ROM of size bytes at base, read from r starting at
+// offset 0
+func NewROM(r io.ReaderAt, base, size uint32) *ROM {
+	return &ROM{r: r, base: base, size: size, blocks: make(map[uint32][]byte)}
+}
+
+// Err returns the first error reading the backing store, other than a
+// short read at its end
+func (m *ROM) Err() error {
+	return m.err
+}
+
+// block returns the cached block holding the ROM offset, reading it from
+// the backing store if needed. Bytes past the end of the store read as 0.
+func (m *ROM) block(offset uint32) []byte {
+	index := offset / romBlockSize
+	if b, ok := m.blocks[index]; ok {
+		return b
+	}
+	b := make([]byte, romBlockSize)
+	if _, err := m.r.ReadAt(b, int64(index)*romBlockSize); err != nil && err != io.EOF && m.err == nil {
+		m.err = err
+	}
+	m.blocks[index] = b
+	return b
+}
+
+// Read8 reads a byte from the specified address
+func (m *ROM) Read8(address uint32) uint8 {
+	offset := address - m.base
+	if offset >= m.size {
+		return 0
+	}
+	return m.block(offset)[offset%romBlockSize]
+}
+
+// Read16 reads a big-endian word from the specified address
+func (m *ROM) Read16(address uint32) uint16 {
+	return uint16(m.Read8(address))<<8 | uint16(m.Read8(address+1))
+}
+
+// Read32 reads a big-endian longword from the specified address
+func (m *ROM) Read32(address uint32) uint32 {
+	return uint32(m.Read16(address))<<16 | uint32(m.Read16(address+2))
+}
+
+// Write8 ignores writes to ROM
+func (m *ROM) Write8(address uint32, value uint8) {}
+
+// Write16 ignores writes to ROM
+func (m *ROM) Write16(address uint32, value uint16) {}
+
+// Write32 ignores writes to ROM
+func (m *ROM) Write32(address uint32, value uint32) {}
+
+// busRegion is a memory handler mapped over an address range
+type busRegion struct {
+	addrRange
+	handler MemoryHandler
+}
+
+// Bus is a MemoryHandler that dispatches each access to the handler mapped
+// over the address, falling back to a default handler (typically RAM) for
+// unmapped addresses. Handlers receive the full address, not an offset.
+type Bus struct {
+	regions  []busRegion
+	fallback MemoryHandler
+}
+
+// NewBus creates a bus with the given fallback handler for unmapped
+// addresses. If fallback is nil, unmapped reads return 0 and unmapped
+// writes are ignored.
+func NewBus(fallback MemoryHandler) *Bus {
+	return &Bus{fallback: fallback}
+}
+
+// Map maps a handler over the addresses from start to end inclusive.
+// Regions mapped later take precedence where ranges overlap.
+func (b *Bus) Map(start, end uint32, h MemoryHandler) {
+	if start > end {
+		start, end = end, start
+	}
+	b.regions = append(b.regions, busRegion{addrRange{start, end}, h})
+}
+
+// Unmap removes a mapping made with Map
+func (b *Bus) Unmap(start, end uint32) {
+	if start > end {
+		start, end = end, start
+	}
+	for i := len(b.regions) - 1; i >= 0; i-- {
+		if b.regions[i].start == start && b.regions[i].end == end {
+			b.regions = append(b.regions[:i], b.regions[i+1:]...)
+			return
+		}
+	}
+}
+
+// handler returns the handler for an address, or nil if none
+func (b *Bus) handler(address uint32) MemoryHandler {
+	for i := len(b.regions) - 1; i >= 0; i-- {
+		if b.regions[i].contains(address) {
+			return b.regions[i].handler
+		}
+	}
+	return b.fallback
+}
+
+// Read8 reads a byte from the handler mapped at the address
+func (b *Bus) Read8(address uint32) uint8 {
+	if h := b.handler(address); h != nil {
+		return h.Read8(address)
+	}
+	return 0
+}
+
+// Read16 reads a word from the handler mapped at the address
+func (b *Bus) Read16(address uint32) uint16 {
+	if h := b.handler(address); h != nil {
+		return h.Read16(address)
+	}
+	return 0
+}
+
+// Read32 reads a longword from the handler mapped at the address
+func (b *Bus) Read32(address uint32) uint32 {
+	if h := b.handler(address); h != nil {
+		return h.Read32(address)
+	}
+	return 0
+}
+
+// DebugRead8 reads a byte from the handler mapped at the address, through
+// its DebugReader methods if it has them
+func (b *Bus) DebugRead8(address uint32) uint8 {
+	if d, ok := b.handler(address).(DebugReader); ok {
+		return d.DebugRead8(address)
+	}
+	return b.Read8(address)
+}
+
+// DebugRead16 reads a word like DebugRead8
+func (b *Bus) DebugRead16(address uint32) uint16 {
+	if d, ok := b.handler(address).(DebugReader); ok {
+		return d.DebugRead16(address)
+	}
+	return b.Read16(address)
+}
+
+// DebugRead32 reads a longword like DebugRead8
+func (b *Bus) DebugRead32(address uint32) uint32 {
+	if d, ok := b.handler(address).(DebugReader); ok {
+		return d.DebugRead32(address)
+	}
+	return b.Read32(address)
+}
+
+// Write8 writes a byte to the handler mapped at the address
+func (b *Bus) Write8(address uint32, value uint8) {
+	if h := b.handler(address); h != nil {
+		h.Write8(address, value)
+	}
+}
+
+// Write16 writes a word to the handler mapped at the address
+func (b *Bus) Write16(address uint32, value uint16) {
+	if h := b.handler(address); h != nil {
+		h.Write16(address, value)
+	}
+}
+
+// Write32 writes a longword to the handler mapped at the address
+func (b *Bus) Write32(address uint32, value uint32) {
+	if h := b.handler(address); h != nil {
+		h.Write32(address, value)
+	}
+}
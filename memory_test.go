@@ -0,0 +1,296 @@
+package musashi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRAM(t *testing.T) {
+	ram := NewRAM(1000)
+	if ram.Size() != 1024 {
+		t.Errorf("Expected size rounded up to 1024, got %d", ram.Size())
+	}
+
+	ram.Write32(0x10, 0x12345678)
+	if got := ram.Read16(0x10); got != 0x1234 {
+		t.Errorf("Expected big-endian high word 0x1234, got 0x%04X", got)
+	}
+	if got := ram.Read8(0x13); got != 0x78 {
+		t.Errorf("Expected low byte 0x78, got 0x%02X", got)
+	}
+
+	// Addresses wrap at the end of the RAM
+	if got := ram.Read32(0x10 + 1024); got != 0x12345678 {
+		t.Errorf("Expected mirrored read 0x12345678, got 0x%08X", got)
+	}
+	ram.Write16(0x3FF, 0xABCD)
+	if ram.Read8(0x3FF) != 0xAB || ram.Read8(0) != 0xCD {
+		t.Error("Expected word write to wrap around the end of the RAM")
+	}
+}
+
+func TestBigEndianHelpers(t *testing.T) {
+	b := make([]byte, 8)
+
+	Write32BE(b, 1, 0x12345678)
+	if b[1] != 0x12 || b[2] != 0x34 || b[3] != 0x56 || b[4] != 0x78 {
+		t.Errorf("Expected bytes 12 34 56 78, got % X", b[1:5])
+	}
+	if got := Read32BE(b, 1); got != 0x12345678 {
+		t.Errorf("Expected longword 0x12345678, got 0x%08X", got)
+	}
+	if got := Read16BE(b, 2); got != 0x3456 {
+		t.Errorf("Expected word 0x3456, got 0x%04X", got)
+	}
+
+	Write16BE(b, 6, 0xABCD)
+	if b[6] != 0xAB || b[7] != 0xCD {
+		t.Errorf("Expected bytes AB CD, got % X", b[6:8])
+	}
+	if got := Read16BE(b, 6); got != 0xABCD {
+		t.Errorf("Expected word 0xABCD, got 0x%04X", got)
+	}
+}
+
+func TestRAMLoadProgram(t *testing.T) {
+	ram := NewRAM(64 * 1024)
+
+	ram.Load(0, []byte{
+		0x00, 0x00, 0x10, 0x00, // Initial SSP
+		0x00, 0x00, 0x04, 0x00, // Initial PC
+	})
+	ram.Load(0x400, []byte{
+		0x70, 0x05, // MOVEQ #5,D0
+		0x72, 0x03, // MOVEQ #3,D1
+		0xD0, 0x81, // ADD.L D1,D0
+	})
+
+	cpu := NewCPU(CPU68000)
+	cpu.SetMemoryHandler(ram)
+	cpu.Reset()
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.d[0] != 8 {
+		t.Errorf("Expected D0 = 8, got %d", cpu.d[0])
+	}
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected PC = 0x406, got 0x%08X", cpu.pc)
+	}
+}
+
+// fakeUART records bytes written to its data register
+type fakeUART struct {
+	RAM
+	sent []byte
+}
+
+func (u *fakeUART) Write8(address uint32, value uint8) {
+	u.sent = append(u.sent, value)
+}
+
+func TestRunProgram(t *testing.T) {
+	cpu := RunProgram(CPU68000, []byte{
+		0x70, 0x05, // MOVEQ #5,D0
+		0x5E, 0x80, // ADDQ.L #7,D0
+		0x2F, 0x00, // MOVE.L D0,-(SP)
+	}, 0x400, 0x400, 12)
+
+	if cpu.d[0] != 12 {
+		t.Errorf("Expected D0 = 12, got %d", cpu.d[0])
+	}
+	if cpu.pc != 0x404 {
+		t.Errorf("Expected PC = 0x404 after 12 cycles, got 0x%08X", cpu.pc)
+	}
+
+	// The stack starts at the top of the RAM
+	cpu.Step()
+	ram := cpu.GetMemoryHandler().(*RAM)
+	if cpu.a[7] != ram.Size()-4 || ram.Read32(cpu.a[7]) != 12 {
+		t.Errorf("Expected D0 pushed at the top of the RAM, got SP 0x%08X", cpu.a[7])
+	}
+}
+
+func TestExecuteOpcode(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+	cpu.SetPC(0x2000)
+	cpu.d[0] = 0x00017FFF
+	cpu.d[1] = 0x00000001
+
+	// ADD.W D1,D0
+	if cycles := cpu.ExecuteOpcode(0xD041, nil); cycles != 4 {
+		t.Errorf("Expected ADD.W D1,D0 to take 4 cycles, got %d", cycles)
+	}
+	if cpu.d[0] != 0x00018000 {
+		t.Errorf("Expected D0 = 0x00018000, got 0x%08X", cpu.d[0])
+	}
+	if cpu.sr&(FlagN|FlagV) != FlagN|FlagV {
+		t.Errorf("Expected N and V set, got SR 0x%04X", cpu.sr)
+	}
+	if cpu.pc != 0x2002 || cpu.ppc != 0x2000 {
+		t.Errorf("Expected PC = 0x2002 and PPC = 0x2000, got 0x%08X and 0x%08X", cpu.pc, cpu.ppc)
+	}
+
+	// ADD.W #$1234,D0 takes its immediate from the extension words, not memory
+	cpu.ExecuteOpcode(0xD07C, []uint16{0x1234})
+	if cpu.d[0] != 0x00019234 {
+		t.Errorf("Expected D0 = 0x00019234, got 0x%08X", cpu.d[0])
+	}
+	if cpu.pc != 0x2006 {
+		t.Errorf("Expected PC = 0x2006, got 0x%08X", cpu.pc)
+	}
+	if got := memory.Read16(0x2002); got != 0 {
+		t.Errorf("Expected memory to be untouched, got 0x%04X", got)
+	}
+}
+
+func TestBus(t *testing.T) {
+	ram := NewRAM(64 * 1024)
+	uart := &fakeUART{RAM: *NewRAM(16)}
+
+	bus := NewBus(ram)
+	bus.Map(0xFF0000, 0xFF000F, uart)
+
+	ram.Load(0, []byte{
+		0x00, 0x00, 0x10, 0x00, // Initial SSP
+		0x00, 0x00, 0x04, 0x00, // Initial PC
+	})
+	ram.Load(0x400, []byte{
+		0x70, 0x48, // MOVEQ #'H',D0
+		0x13, 0xC0, 0x00, 0xFF, 0x00, 0x01, // MOVE.B D0,$FF0001
+		0x13, 0xC0, 0x00, 0x00, 0x20, 0x00, // MOVE.B D0,$2000
+	})
+
+	cpu := NewCPU(CPU68000)
+	cpu.SetMemoryHandler(bus)
+	cpu.Reset()
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if string(uart.sent) != "H" {
+		t.Errorf("Expected UART to receive \"H\", got %q", uart.sent)
+	}
+	if got := ram.Read8(0x2000); got != 'H' {
+		t.Errorf("Expected RAM write at 0x2000, got 0x%02X", got)
+	}
+	// The UART address is outside the RAM's mask, so a mirrored write would land at 0x0001
+	if got := ram.Read8(0xFF0001); got != 0x00 {
+		t.Errorf("Expected UART write not to reach RAM, got 0x%02X", got)
+	}
+
+	bus.Unmap(0xFF0000, 0xFF000F)
+	if bus.handler(0xFF0001) != MemoryHandler(ram) {
+		t.Error("Expected unmapped address to fall back to RAM")
+	}
+}
+
+// statusPort is an I/O register whose status byte counts emulated reads,
+// like a port that acknowledges on read
+type statusPort struct {
+	RAM
+	reads uint8
+}
+
+func (p *statusPort) Read8(address uint32) uint8 {
+	p.reads++
+	return p.reads
+}
+
+func (p *statusPort) DebugRead8(address uint32) uint8   { return p.reads }
+func (p *statusPort) DebugRead16(address uint32) uint16 { return uint16(p.reads) << 8 }
+func (p *statusPort) DebugRead32(address uint32) uint32 { return uint32(p.reads) << 24 }
+
+func TestDebugReader(t *testing.T) {
+	ram := NewRAM(64 * 1024)
+	port := &statusPort{RAM: *NewRAM(16)}
+
+	bus := NewBus(ram)
+	bus.Map(0xFF0000, 0xFF000F, port)
+
+	ram.Load(0, []byte{
+		0x00, 0x00, 0x10, 0x00, // Initial SSP
+		0x00, 0x00, 0x04, 0x00, // Initial PC
+	})
+	ram.Load(0x400, []byte{
+		0x10, 0x39, 0x00, 0xFF, 0x00, 0x00, // MOVE.B $FF0000,D0
+	})
+
+	cpu := NewCPUWithMemory(CPU68000, bus)
+
+	cpu.Step()
+	if cpu.d[0] != 1 || port.reads != 1 {
+		t.Errorf("Expected the emulated read to count, got D0 = %d after %d reads", cpu.d[0], port.reads)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := cpu.Peek8(0xFF0000); got != 1 {
+			t.Errorf("Expected Peek8 = 1, got %d", got)
+		}
+	}
+	if port.reads != 1 {
+		t.Errorf("Expected debug reads to have no side effects, got %d reads", port.reads)
+	}
+
+	// Unmapped addresses and handlers without DebugReader fall back to normal reads
+	if got := cpu.Peek16(0x400); got != 0x1039 {
+		t.Errorf("Expected Peek16 = 0x1039 from RAM, got 0x%04X", got)
+	}
+}
+
+// countingReader counts the reads made from its backing bytes
+type countingReader struct {
+	*bytes.Reader
+	reads int
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	r.reads++
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestROM(t *testing.T) {
+	image := make([]byte, 2*romBlockSize+2)
+	image[romBlockSize-1] = 0x12
+	image[romBlockSize] = 0x34
+	image[len(image)-1] = 0x56
+	backing := &countingReader{Reader: bytes.NewReader(image)}
+
+	rom := NewROM(backing, 0x400000, uint32(len(image)))
+
+	// A word straddling the first block boundary
+	if got := rom.Read16(0x400000 + romBlockSize - 1); got != 0x1234 {
+		t.Errorf("Expected 0x1234 across the block boundary, got 0x%04X", got)
+	}
+	if backing.reads != 2 {
+		t.Errorf("Expected both blocks read once, got %d reads", backing.reads)
+	}
+	rom.Read32(0x400000 + romBlockSize - 2)
+	if backing.reads != 2 {
+		t.Errorf("Expected cached blocks to be reused, got %d reads", backing.reads)
+	}
+
+	// The short final block and addresses outside the ROM
+	if got := rom.Read16(uint32(0x400000 + len(image) - 2)); got != 0x0056 {
+		t.Errorf("Expected 0x0056 at the end of the ROM, got 0x%04X", got)
+	}
+	if got := rom.Read8(uint32(0x400000 + len(image))); got != 0 {
+		t.Errorf("Expected 0 past the end of the ROM, got 0x%02X", got)
+	}
+	if got := rom.Read8(0x3FFFFF); got != 0 {
+		t.Errorf("Expected 0 below the ROM base, got 0x%02X", got)
+	}
+	if rom.Err() != nil {
+		t.Errorf("Expected no read error, got %v", rom.Err())
+	}
+
+	rom.Write8(0x400000+romBlockSize, 0xFF)
+	if got := rom.Read8(0x400000 + romBlockSize); got != 0x34 {
+		t.Errorf("Expected writes to be ignored, got 0x%02X", got)
+	}
+}
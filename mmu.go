@@ -0,0 +1,250 @@
+package musashi
+
+// mmu.go - Paged memory management unit (68030)
+
+// Translation control register fields
+const (
+	tcEnable = 0x80000000 // Translation enabled
+	tcSRE    = 0x02000000 // Supervisor root pointer enable
+)
+
+// Descriptor types (bits 1-0 of root pointers and descriptors)
+const (
+	dtInvalid = 0 // Invalid descriptor
+	dtPage    = 1 // Page descriptor (or early termination)
+	dtTable4  = 2 // Valid table of 4-byte descriptors
+	dtTable8  = 3 // Valid table of 8-byte descriptors (not supported)
+)
+
+// Descriptor write protect bit
+const descWP = 0x04
+
+// MMU status register bits, as set by PTEST
+const (
+	mmusrWP      = 0x0800 // Write protected
+	mmusrInvalid = 0x0400 // Invalid descriptor
+	mmusrLevels  = 0x0007 // Number of levels searched
+)
+
+// PMOVE register selectors (bits 12-10 of the extension word)
+const (
+	pregTC    = 0
+	pregSRP   = 2
+	pregCRP   = 3
+	pregTT0   = 2 // With extension format 000
+	pregTT1   = 3 // With extension format 000
+	pregMMUSR = 0 // With extension format 011
+)
+
+// mmuWalk is the outcome of a translation table search
+type mmuWalk struct {
+	phys     uint32 // Physical address
+	descAddr uint32 // Address of the last descriptor fetched
+	levels   int    // Number of table levels searched
+	invalid  bool   // The search ended at an invalid descriptor
+	wp       bool   // A descriptor on the path is write protected
+}
+
+// mmuEnabled reports whether addresses are translated by the MMU
+func (cpu *CPU) mmuEnabled() bool {
+	return cpu.cpuType == CPU68030 && cpu.tc&tcEnable != 0
+}
+
+// resetMMU disables translation and clears the MMU registers
+func (cpu *CPU) resetMMU() {
+	cpu.tc = 0
+	cpu.crp = 0
+	cpu.srp = 0
+	cpu.tt0 = 0
+	cpu.tt1 = 0
+	cpu.mmusr = 0
+}
+
+// mmuTranslate translates a logical address in the given address space.
+// An access through an invalid descriptor or a write to a write-protected
+// page takes a bus error, and ok is false.
+func (cpu *CPU) mmuTranslate(address uint32, fc uint8, write bool) (phys uint32, ok bool) {
+	w := cpu.mmuSearch(address, fc)
+	if w.invalid || (write && w.wp) {
+		cpu.busFault(VectorBusError, address, write)
+		return 0, false
+	}
+	return w.phys, true
+}
+
+// mmuSearch walks the translation tables for a logical address. Only
+// short-format (4-byte) descriptors are supported; a page descriptor above
+// the last level terminates the search early and maps a larger page.
+func (cpu *CPU) mmuSearch(address uint32, fc uint8) mmuWalk {
+	root := cpu.crp
+	if cpu.tc&tcSRE != 0 && fc&4 != 0 {
+		root = cpu.srp
+	}
+
+	var w mmuWalk
+	dt := uint32(root>>32) & 3
+	table := uint32(root) &^ 0x0F
+	if dt == dtPage {
+		// The root pointer itself maps all of memory untranslated
+		w.phys = address
+		return w
+	}
+
+	// Bits of the logical address not yet used as a table index
+	remaining := 32 - int((cpu.tc>>16)&0x0F)
+	for shift := 12; shift >= 0 && dt == dtTable4; shift -= 4 {
+		bits := int((cpu.tc >> uint(shift)) & 0x0F)
+		if bits == 0 {
+			break
+		}
+		remaining -= bits
+		index := (address >> uint(remaining)) & (1<<uint(bits) - 1)
+		w.descAddr = table + index*4
+		desc := cpu.physRead32(w.descAddr)
+		w.levels++
+		if desc&descWP != 0 {
+			w.wp = true
+		}
+		dt = desc & 3
+		table = desc &^ 0x0F
+		if dt == dtPage {
+			table = desc &^ 0xFF
+		}
+	}
+
+	if dt != dtPage || remaining < 0 {
+		w.invalid = true
+		return w
+	}
+	offset := uint32(uint64(1)<<uint(remaining) - 1)
+	w.phys = table&^offset | address&offset
+	return w
+}
+
+// physRead32 reads a descriptor from physical memory during a table search
+func (cpu *CPU) physRead32(address uint32) uint32 {
+	address &= cpu.addressMask
+	if cpu.memoryFC != nil {
+		return cpu.memoryFC.Read32FC(address, FCSupervisorData)
+	}
+	return cpu.memory.Read32(address)
+}
+
+// PMMU instructions - PMOVE, PTEST, PLOAD, PFLUSH (68030)
+func (cpu *CPU) opPMMU(opcode uint16) {
+	// Format: 1111 0000 00EE Emmm + extension word
+	if cpu.cpuType != CPU68030 {
+		cpu.opIllegal(opcode)
+		return
+	}
+	if cpu.sr&FlagS == 0 {
+		cpu.privilegeViolation()
+		return
+	}
+
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	ext := cpu.readImmediate16()
+
+	switch ext >> 13 {
+	case 0, 2, 3: // PMOVE
+		cpu.pmove(eaMode, eaReg, ext)
+	case 1: // PLOAD, PFLUSH
+		// There is no ATC to load or flush, but the operand of PLOAD and
+		// of PFLUSH fc,#mask,<ea> is still decoded
+		if m := (ext >> 10) & 7; m == 0 || m == 6 {
+			cpu.calcEA(eaMode, eaReg, 8)
+		}
+		cpu.useCycles(12)
+	case 4: // PTEST
+		cpu.ptest(eaMode, eaReg, ext)
+	default:
+		cpu.pc = cpu.ppc + 2
+		cpu.opIllegal(opcode)
+	}
+}
+
+// pmove moves an MMU register to or from an operand. Bit 9 of the
+// extension word selects the direction (1 = register to <ea>).
+func (cpu *CPU) pmove(mode, reg int, ext uint16) {
+	toEA := ext&0x0200 != 0
+	preg := (ext >> 10) & 7
+
+	var reg32 *uint32
+	var reg64 *uint64
+	switch {
+	case ext>>13 == 0 && preg == pregTT0:
+		reg32 = &cpu.tt0
+	case ext>>13 == 0 && preg == pregTT1:
+		reg32 = &cpu.tt1
+	case ext>>13 == 2 && preg == pregTC:
+		reg32 = &cpu.tc
+	case ext>>13 == 2 && preg == pregSRP:
+		reg64 = &cpu.srp
+	case ext>>13 == 2 && preg == pregCRP:
+		reg64 = &cpu.crp
+	case ext>>13 == 3 && preg == pregMMUSR:
+		if toEA {
+			cpu.writeEA(mode, reg, 16, uint32(cpu.mmusr))
+		} else {
+			cpu.mmusr = uint16(cpu.readEA(mode, reg, 16))
+		}
+		cpu.useCycles(8)
+		return
+	}
+
+	switch {
+	case reg32 != nil:
+		if toEA {
+			cpu.writeEA(mode, reg, 32, *reg32)
+		} else {
+			*reg32 = cpu.readEA(mode, reg, 32)
+		}
+	case reg64 != nil && mode >= 2:
+		addr := cpu.calcEA(mode, reg, 64)
+		if toEA {
+			cpu.writeMem(addr, uint32(*reg64>>32), 32)
+			cpu.writeMem(addr+4, uint32(*reg64), 32)
+		} else {
+			hi := cpu.readMem(addr, 32)
+			*reg64 = uint64(hi)<<32 | uint64(cpu.readMem(addr+4, 32))
+		}
+	default:
+		cpu.pc = cpu.ppc + 2
+		cpu.opIllegal(cpu.ir)
+		return
+	}
+	cpu.useCycles(8)
+}
+
+// ptest searches the translation tables for the operand address and
+// reports the result in MMUSR, optionally loading the address of the last
+// descriptor into an address register
+func (cpu *CPU) ptest(mode, reg int, ext uint16) {
+	// Extension: 100L LLRA rrrF FFFF
+	// L = level, R = 1: test for read, A = load An, rrr = An, F = FC
+	var fc uint8
+	switch {
+	case ext&0x18 == 0x10: // Immediate
+		fc = uint8(ext & 7)
+	case ext&0x18 == 0x08: // Data register
+		fc = uint8(cpu.d[ext&7] & 7)
+	case ext&0x1F == 0x01:
+		fc = cpu.dfc
+	default:
+		fc = cpu.sfc
+	}
+
+	w := cpu.mmuSearch(cpu.calcEA(mode, reg, 8), fc)
+	cpu.mmusr = uint16(w.levels) & mmusrLevels
+	if w.invalid {
+		cpu.mmusr |= mmusrInvalid
+	}
+	if w.wp {
+		cpu.mmusr |= mmusrWP
+	}
+	if ext&0x0100 != 0 {
+		cpu.a[(ext>>5)&7] = w.descAddr
+	}
+	cpu.useCycles(22)
+}
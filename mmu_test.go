@@ -0,0 +1,145 @@
+package musashi
+
+import "testing"
+
+// TestMMUTranslation tests a two-level page table walk installed with PMOVE
+func TestMMUTranslation(t *testing.T) {
+	cpu := NewCPU(CPU68030)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorBusError*4, 0x00000600)
+
+	// CRP: 4-byte table at 0x10000
+	memory.Write32(0x800, 0x00000002)
+	memory.Write32(0x804, 0x00010000)
+	// TC: enabled, 4K pages, IS = 0, TIA = 10, TIB = 10
+	memory.Write32(0x808, 0x80C0AA00)
+
+	// Logical page 0 maps to itself, logical $401000 to physical $5000
+	memory.Write32(0x10000, 0x00011002)
+	memory.Write32(0x10004, 0x00012002)
+	memory.Write32(0x11000, 0x00000001)
+	memory.Write32(0x12004, 0x00005001)
+	memory.Write32(0x5234, 0xCAFEBABE)
+
+	// PMOVE (A0),CRP
+	memory.Write16(0x400, 0xF010)
+	memory.Write16(0x402, 0x4C00)
+	// PMOVE (A1),TC
+	memory.Write16(0x404, 0xF011)
+	memory.Write16(0x406, 0x4000)
+	// MOVE.L $00401234,D0
+	memory.Write16(0x408, 0x2039)
+	memory.Write32(0x40A, 0x00401234)
+	// PTESTR #5,(A3),#7,A2
+	memory.Write16(0x40E, 0xF013)
+	memory.Write16(0x410, 0x9F55)
+	// MOVE.L $00802000,D1 (unmapped)
+	memory.Write16(0x412, 0x2239)
+	memory.Write32(0x414, 0x00802000)
+
+	cpu.Reset()
+	cpu.a[0] = 0x800
+	cpu.a[1] = 0x808
+	cpu.a[3] = 0x00401234
+
+	cpu.Step()
+	cpu.Step()
+	if !cpu.mmuEnabled() {
+		t.Fatal("Expected translation to be enabled")
+	}
+
+	cpu.Step()
+	if cpu.d[0] != 0xCAFEBABE {
+		t.Errorf("Expected D0 = 0xCAFEBABE from physical $5234, got 0x%08X", cpu.d[0])
+	}
+
+	cpu.Step()
+	if cpu.mmusr != 2 {
+		t.Errorf("Expected MMUSR = 2 levels, got 0x%04X", cpu.mmusr)
+	}
+	if cpu.a[2] != 0x12004 {
+		t.Errorf("Expected A2 = 0x12004 (last descriptor), got 0x%08X", cpu.a[2])
+	}
+
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Errorf("Expected bus error handler at 0x600 for an invalid page, got PC 0x%08X", cpu.pc)
+	}
+}
+
+// TestPMMUOtherCPUs tests that PMMU opcodes trap on CPUs without the 68030 MMU
+func TestPMMUOtherCPUs(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorLineF*4, 0x00000800)
+
+	// PMOVE (A1),TC
+	memory.Write16(0x400, 0xF011)
+	memory.Write16(0x402, 0x4000)
+
+	cpu.Reset()
+	cpu.Step()
+
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected line F exception handler at 0x800, got PC 0x%08X", cpu.pc)
+	}
+	if cpu.tc != 0 {
+		t.Errorf("Expected TC unchanged, got 0x%08X", cpu.tc)
+	}
+}
+
+// TestInstrDecodedHookMMU tests that the decoded hook names the instruction
+// fetched through the MMU, not the one at the same physical address
+func TestInstrDecodedHookMMU(t *testing.T) {
+	cpu := NewCPU(CPU68030)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	// Logical page 0 maps to itself, logical $401000 to physical $5000
+	memory.Write32(0x800, 0x00000002)
+	memory.Write32(0x804, 0x00010000)
+	memory.Write32(0x808, 0x80C0AA00)
+	memory.Write32(0x10000, 0x00011002)
+	memory.Write32(0x10004, 0x00012002)
+	memory.Write32(0x11000, 0x00000001)
+	memory.Write32(0x12004, 0x00005001)
+
+	// PMOVE (A0),CRP; PMOVE (A1),TC; JMP $00401000
+	memory.Write16(0x400, 0xF010)
+	memory.Write16(0x402, 0x4C00)
+	memory.Write16(0x404, 0xF011)
+	memory.Write16(0x406, 0x4000)
+	memory.Write16(0x408, 0x4EF9)
+	memory.Write32(0x40A, 0x00401000)
+	memory.Write16(0x5000, 0x7001) // MOVEQ #1,D0
+	memory.Write16(0x1000, 0x4E71) // NOP, at $401000 in the 1MB test memory
+
+	cpu.Reset()
+	cpu.a[0] = 0x800
+	cpu.a[1] = 0x808
+	cpu.StepN(3)
+
+	var gotOpcode uint16
+	var gotMnemonic string
+	cpu.SetInstrDecodedHook(func(pc uint32, opcode uint16, mnemonic string) {
+		gotOpcode, gotMnemonic = opcode, mnemonic
+	})
+	cpu.Step()
+	if cpu.d[0] != 1 {
+		t.Fatalf("Expected the MOVEQ at physical $5000 to run, got D0 = %d", cpu.d[0])
+	}
+	if gotOpcode != 0x7001 || gotMnemonic != "MOVEQ" {
+		t.Errorf("Expected opcode 0x7001 MOVEQ, got 0x%04X %s", gotOpcode, gotMnemonic)
+	}
+}
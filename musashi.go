@@ -11,6 +11,13 @@
 //	cycles := cpu.Execute(1000)
 package musashi
 
+import (
+	"io"
+	"math/bits"
+	"strings"
+	"time"
+)
+
 // CPUType represents the type of M68000 CPU to emulate
 type CPUType int
 
@@ -26,7 +33,7 @@ const (
 	CPU68EC040          // Motorola 68EC040 (no FPU)
 	CPU68LC040          // Motorola 68LC040 (no FPU, no MMU)
 	CPU68040            // Motorola 68040
-	CPUSCC68070         // Philips SCC68070 (68010 with 32-bit data bus)
+	CPUSCC68070         // Philips SCC68070 (68010 core with 16-bit data bus)
 )
 
 // String returns the string representation of a CPU type
@@ -57,6 +64,63 @@ func (c CPUType) String() string {
 	}
 }
 
+// StopReason is the reason Execute returned
+type StopReason int
+
+// Reasons for Execute to return
+const (
+	StopBudget     StopReason = iota // The cycle budget ran out
+	StopStopped                      // A STOP instruction is waiting for an interrupt
+	StopHalted                       // The CPU is halted
+	StopBreakpoint                   // An execution breakpoint or a breaking watchpoint was hit
+	StopException                    // An exception was taken with exception break enabled
+	StopEnded                        // The host called EndTimeslice
+	StopFault                        // A memory fault was returned to the host (FaultModeGo)
+	StopNoMemory                     // No memory handler is set
+)
+
+// String returns the name of a stop reason
+func (r StopReason) String() string {
+	switch r {
+	case StopBudget:
+		return "Budget"
+	case StopStopped:
+		return "Stopped"
+	case StopHalted:
+		return "Halted"
+	case StopBreakpoint:
+		return "Breakpoint"
+	case StopException:
+		return "Exception"
+	case StopEnded:
+		return "Ended"
+	case StopFault:
+		return "Fault"
+	case StopNoMemory:
+		return "NoMemory"
+	default:
+		return "Invalid"
+	}
+}
+
+// is020Plus reports whether the CPU has the 68020 instruction set and
+// addressing modes. The SCC68070 is a 68010-class core despite being
+// enumerated after the 68040.
+func (cpu *CPU) is020Plus() bool {
+	return cpu.cpuType >= CPU68EC020 && cpu.cpuType != CPUSCC68070
+}
+
+// defaultAddressMask returns the address bus width of a CPU type: 24 bits
+// for the 68000, 68010 and 68EC020, 32 bits for the others
+func defaultAddressMask(cpuType CPUType) uint32 {
+	switch cpuType {
+	case CPU68000, CPU68010, CPU68EC020:
+		return 0x00FFFFFF
+	default:
+		return 0xFFFFFFFF
+	}
+}
+
 // Register represents a CPU register that can be accessed
 type Register int
 
@@ -99,6 +163,7 @@ const (
 	RegPPC      // Previous Program Counter
 	RegIR       // Instruction Register
 	RegCPUType  // CPU Type register
+	RegCCR      // Condition Code Register (low byte of SR)
 )
 
 // IRQ levels
@@ -154,10 +219,37 @@ type MemoryHandler interface {
 	Write32(address uint32, value uint32)
 }
 
+// MemoryHandlerFC is an optional extension of MemoryHandler for handlers
+// that need the function code of each access, e.g. to protect supervisor
+// memory from user programs or to separate program and data spaces.
+// If the handler passed to SetMemoryHandler implements it, the CPU uses
+// these methods instead of the plain ones. fc is one of the FC constants.
+type MemoryHandlerFC interface {
+	Read8FC(address uint32, fc int) uint8
+	Read16FC(address uint32, fc int) uint16
+	Read32FC(address uint32, fc int) uint32
+	Write8FC(address uint32, value uint8, fc int)
+	Write16FC(address uint32, value uint16, fc int)
+	Write32FC(address uint32, value uint32, fc int)
+}
+
+// DebugReader is an optional extension of MemoryHandler for handlers with
+// read side effects, such as memory-mapped I/O registers that acknowledge
+// on read. If the handler passed to SetMemoryHandler implements it, Peek8,
+// Peek16, Peek32 and the disassembler use these methods, which should
+// return the current contents without side effects.
+type DebugReader interface {
+	DebugRead8(address uint32) uint8
+	DebugRead16(address uint32) uint16
+	DebugRead32(address uint32) uint32
+}
+
 // CPU represents a Motorola 68000 family processor
 type CPU struct {
 	// CPU type
-	cpuType CPUType
+	cpuType         CPUType
+	addressMask     uint32 // Address lines driven on the bus
+	resetVectorBase uint32 // Address the reset SSP and PC are fetched from
 
 	// Data registers (D0-D7)
 	d [8]uint32
@@ -174,6 +266,7 @@ type CPU struct {
 	sr uint16
 
 	// Stack pointers
+	// A7 holds the active stack pointer; the inactive one is saved here
 	usp uint32 // User stack pointer
 	isp uint32 // Interrupt stack pointer (68010+)
 	msp uint32 // Master stack pointer (68020+)
@@ -187,20 +280,89 @@ type CPU struct {
 	cacr uint32 // Cache control register
 	caar uint32 // Cache address register
 
+	// Floating-point unit (68881/68882, 68040)
+	fp    [8]float64 // FP0-FP7
+	fpcr  uint32     // FPU control register
+	fpsr  uint32     // FPU status register
+	fpiar uint32     // FPU instruction address register
+
+	// Memory management unit (68030)
+	tc    uint32 // Translation control register
+	crp   uint64 // CPU root pointer
+	srp   uint64 // Supervisor root pointer
+	tt0   uint32 // Transparent translation register 0
+	tt1   uint32 // Transparent translation register 1
+	mmusr uint16 // MMU status register
+
 	// Execution state
-	stopped      bool    // CPU is stopped
-	halted       bool    // CPU is halted
-	cyclesRun    int     // Cycles executed in current timeslice
-	cyclesRemain int     // Cycles remaining in current timeslice
-	irqLevel     uint8   // Current IRQ level (0-7)
-	virq         [8]bool // Virtual IRQ lines
-	prefetchAddr uint32  // Last prefetch address
-	prefetchData uint32  // Last prefetch data
-	ppc          uint32  // Previous program counter
-	ir           uint16  // Instruction register
+	stopped       bool         // CPU is stopped
+	halted        bool         // CPU is halted
+	inFault       bool         // Processing a bus or address error
+	busAddress    uint32       // Logical address of the last bus cycle
+	busWriting    bool         // The last bus cycle was a write
+	faultMode     FaultMode    // Where bus and address errors are handled
+	fault         *MemoryFault // Fault awaiting ExecuteChecked (FaultModeGo)
+	faultContext  Context      // Context before the current instruction (FaultModeGo)
+	inInstruction bool         // An instruction is executing and can be aborted
+	loopMode      bool         // 68010 DBcc loop mode active
+	loopPC        uint32       // Address of the DBcc running in loop mode
+	cyclesRun     int          // Cycles executed in current timeslice
+	cyclesRemain  int          // Cycles remaining in current timeslice
+	instructions  int          // Instructions completed (for StepN)
+	irqLevel      uint8        // Current IRQ level (0-7)
+	virq          [8]bool      // Virtual IRQ lines
+	irqPulsed     bool         // irqLevel clears when acknowledged (PulseIRQ)
+	prefetchAddr  uint32       // Address of the first word in the prefetch queue
+	prefetchData  uint32       // Prefetch queue, first word in the high half
+	prefetchValid bool         // Prefetch queue holds two words
+	scratch       []uint16     // Remaining extension words for ExecuteOpcode
+	scratchActive bool         // Instruction words come from scratch
+	ppc           uint32       // Previous program counter
+	ir            uint16       // Instruction register
+
+	// Last exception taken, for debuggers
+	lastVector    uint32 // Vector number
+	lastFaultPC   uint32 // PPC when the exception was taken
+	lastFaultIR   uint16 // IR when the exception was taken
+	lastException bool   // An exception has been taken since reset
+	tracePending  bool   // A trace exception follows the current instruction
+	flowChanged   bool   // The current instruction changed the flow (for T0)
+
+	// Breakpoints
+	breakpoints        map[uint32]struct{}
+	breakRanges        []addrRange
+	breakpointCallback func(pc uint32)
+	breakPC            uint32 // Address execution last stopped at
+	breakResume        bool   // Let the instruction at breakPC through once
+
+	// Watchpoints
+	watchpoints        []watchpoint // Sorted by start address
+	watchMaxEnd        []uint32     // Running maximum of watchpoints[:i+1] end addresses
+	watchpointCallback func(addr uint32, size int, isWrite bool, value uint32)
+	watchBreak         bool
+
+	// Disassembler symbol lookup (optional)
+	symbolResolver func(addr uint32) (string, bool)
+
+	// Instruction trace output (nil when tracing is off)
+	traceWriter io.Writer
+
+	// Clock (for RunFor)
+	clockHz   uint64 // Clock frequency in Hz
+	clockFrac uint64 // Fractional cycle carried between RunFor calls, in Hz*ns
+
+	// Why the last Execute call returned
+	stopReason     StopReason
+	exceptionBreak bool // Taking an exception ends the timeslice
+
+	// Cycle budget overshoot
+	cycleCarry bool // Carry overshoot into the next Execute call
+	overshoot  int  // Cycles the last timeslice ran past its budget
 
 	// Memory access
-	memory MemoryHandler
+	memory   MemoryHandler
+	memoryFC MemoryHandlerFC // memory, if it is function code aware
+	debugMem DebugReader     // memory, if it has side-effect free reads
 
 	// Callbacks (optional)
 	intAckCallback    func(level int) uint32
@@ -208,24 +370,56 @@ type CPU struct {
 	pcChangedCallback func(newPC uint32)
 	fcCallback        func(fc uint8)
 	instrHookCallback func(pc uint32)
+	instrDecodedHook  func(pc uint32, opcode uint16, mnemonic string)
+	exceptionCallback func(vector uint32, entering bool)
 	bkptAckCallback   func(data uint32)
 	illegalCallback   func(opcode uint16) bool
 	tasCallback       func() int
+	busTimingCallback func(addr uint32, size int, isWrite bool) int
 }
 
 // NewCPU creates a new CPU instance of the specified type
 func NewCPU(cpuType CPUType) *CPU {
 	cpu := &CPU{
-		cpuType: cpuType,
+		cpuType:     cpuType,
+		addressMask: defaultAddressMask(cpuType),
+		cycleCarry:  true,
 	}
 	return cpu
 }
 
+// NewCPUWithMemory creates a CPU of the specified type attached to the
+// memory handler and resets it, so the returned CPU is ready to execute
+// with PC and SSP loaded from the reset vectors.
+func NewCPUWithMemory(cpuType CPUType, h MemoryHandler) *CPU {
+	cpu := NewCPU(cpuType)
+	cpu.SetMemoryHandler(h)
+	cpu.Reset()
+	return cpu
+}
+
 // Reset resets the CPU to its initial state.
 // This simulates pulsing the RESET pin on the physical CPU.
 // The CPU will read the initial stack pointer and program counter from
-// memory locations 0 and 4 respectively.
+// memory locations 0 and 4 respectively (see SetResetVectorBase). Pending interrupts, virtual IRQ
+// lines and the stopped and halted states are cleared, so the CPU always
+// starts from the same state.
 func (cpu *CPU) Reset() {
+	cpu.reset(true)
+}
+
+// ResetColdNoVectors resets the CPU like Reset but does not fetch the reset
+// vectors: PC and A7 keep the values they had, so tests and hosts can set
+// them directly without providing a vector table in memory.
+func (cpu *CPU) ResetColdNoVectors() {
+	cpu.reset(false)
+}
+
+// reset performs a reset, reading the initial SSP and PC from memory if
+// fetchVectors is set
+func (cpu *CPU) reset(fetchVectors bool) {
+	pc, sp := cpu.pc, cpu.a[7]
+
 	// Clear all data registers
 	for i := range cpu.d {
 		cpu.d[i] = 0
@@ -245,49 +439,98 @@ func (cpu *CPU) Reset() {
 	cpu.vbr = 0
 	cpu.cacr = 0
 	cpu.caar = 0
+	cpu.resetFPU()
+	cpu.resetMMU()
 
 	// Clear execution state
 	cpu.stopped = false
 	cpu.halted = false
+	cpu.inFault = false
+	cpu.fault = nil
+	cpu.lastException = false
 	cpu.cyclesRun = 0
 	cpu.cyclesRemain = 0
+	cpu.overshoot = 0
+	cpu.loopMode = false
+
+	// Drop all interrupt requests, including virtual IRQ lines
 	cpu.irqLevel = 0
+	cpu.irqPulsed = false
+	for i := range cpu.virq {
+		cpu.virq[i] = false
+	}
 
 	// Read initial SSP and PC from memory if handler is set
-	if cpu.memory != nil {
-		cpu.a[7] = cpu.memory.Read32(0) // Initial SSP
-		cpu.pc = cpu.memory.Read32(4)   // Initial PC
+	if !fetchVectors {
+		cpu.a[7] = sp
+		cpu.pc = pc
+	} else if cpu.memory != nil {
+		cpu.a[7] = cpu.busRead(cpu.resetVectorBase, 32, FCSupervisorProg) // Initial SSP
+		cpu.pc = cpu.busRead(cpu.resetVectorBase+4, 32, FCSupervisorProg) // Initial PC
 	} else {
 		cpu.a[7] = 0
 		cpu.pc = 0
 	}
 
+	// The reset SSP is the interrupt stack pointer, so it is also the
+	// stack the CPU returns to from user mode
 	cpu.usp = 0
-	cpu.isp = 0
+	cpu.isp = cpu.a[7]
 	cpu.msp = 0
 
 	// Clear prefetch
 	cpu.prefetchAddr = 0
 	cpu.prefetchData = 0
+	cpu.prefetchValid = false
 	cpu.ppc = cpu.pc
 	cpu.ir = 0
 }
 
+// ResetPeripherals asserts the RESET line to external devices the way the
+// RESET instruction does, by invoking the reset callback. Unlike Reset, the
+// CPU itself is left untouched: registers, PC and SR keep their values and
+// the vectors are not re-read.
+func (cpu *CPU) ResetPeripherals() {
+	if cpu.resetCallback != nil {
+		cpu.resetCallback()
+	}
+}
+
 // Execute runs the CPU for the specified number of cycles.
-// Returns the actual number of cycles executed.
+// Returns the actual number of cycles executed. A CPU stopped by STOP
+// consumes the whole timeslice unless an interrupt wakes it.
+// Instructions are never split, so the last one may run past the budget;
+// that overshoot is deducted from the next call (see SetCycleCarry).
 func (cpu *CPU) Execute(cycles int) int {
 	if cpu.memory == nil {
+		cpu.stopReason = StopNoMemory
 		return 0
 	}
 
 	cpu.cyclesRemain = cycles
 	cpu.cyclesRun = 0
+	cpu.stopReason = StopBudget
+	if cpu.cycleCarry {
+		cpu.cyclesRemain -= cpu.overshoot
+		cpu.overshoot = 0
+	}
 
 	// Main execution loop
-	for cpu.cyclesRemain > 0 && !cpu.stopped && !cpu.halted {
+	for cpu.cyclesRemain > 0 && !cpu.halted {
 		// Check for interrupts
 		cpu.checkInterrupts()
 
+		// A stopped CPU idles until an interrupt wakes it
+		if cpu.stopped {
+			cpu.useCycles(cpu.cyclesRemain)
+			break
+		}
+
+		// Stop before an instruction at a breakpoint
+		if cpu.checkBreakpoint() {
+			break
+		}
+
 		// Call instruction hook if set
 		if cpu.instrHookCallback != nil {
 			cpu.instrHookCallback(cpu.pc)
@@ -295,33 +538,177 @@ func (cpu *CPU) Execute(cycles int) int {
 
 		// Fetch and execute instruction
 		cpu.ppc = cpu.pc
-		cpu.executeInstruction()
+		if cpu.traceWriter != nil {
+			text, _ := cpu.Disassemble(cpu.pc)
+			cpu.executeInstruction()
+			cpu.traceInstruction(cpu.ppc, text)
+		} else {
+			cpu.executeInstruction()
+		}
 	}
 
+	if cpu.cycleCarry && cpu.cyclesRemain < 0 {
+		cpu.overshoot = -cpu.cyclesRemain
+	}
+	switch {
+	case cpu.halted:
+		cpu.stopReason = StopHalted
+	case cpu.stopped:
+		cpu.stopReason = StopStopped
+	}
 	return cpu.cyclesRun
 }
 
-// executeInstruction fetches and executes a single instruction
+// ExecuteChecked is Execute for hosts that handle memory faults themselves.
+// With FaultModeGo, a bus or address error ends the timeslice and is
+// returned as a *MemoryFault. The faulting instruction is abandoned with
+// the registers and PC as they were before it, so the host can fix the
+// cause and retry it. Memory is not rolled back: writes the instruction
+// made before the fault (e.g. the first registers of a MOVEM) remain, and
+// the retry makes them again. In the default mode the error is always nil.
+func (cpu *CPU) ExecuteChecked(cycles int) (int, error) {
+	if fault := cpu.fault; fault != nil {
+		// A fault raised by PulseBusError between calls
+		cpu.fault = nil
+		return 0, fault
+	}
+	n := cpu.Execute(cycles)
+	if fault := cpu.fault; fault != nil {
+		cpu.fault = nil
+		return n, fault
+	}
+	return n, nil
+}
+
+// Step executes exactly one instruction (or takes a pending interrupt) and
+// returns the cycles it consumed. Use PeekInstruction to see what it will
+// execute. Step neither uses nor adds to the overshoot carried between
+// Execute calls.
+func (cpu *CPU) Step() int {
+	carry := cpu.cycleCarry
+	cpu.cycleCarry = false
+	cycles := cpu.Execute(1)
+	cpu.cycleCarry = carry
+	return cycles
+}
+
+// StepN executes n instructions and returns the total cycles consumed,
+// including any interrupts and exceptions taken in between. Instructions
+// aborted by a bus or address error are not counted. It stops early when
+// an instruction leaves the CPU halted or stopped, or when Execute would
+// otherwise have returned for another reason (see StopReason).
+func (cpu *CPU) StepN(n int) int {
+	total := 0
+	for start := cpu.instructions; cpu.instructions-start < n; {
+		before := cpu.instructions
+		cycles := cpu.Step()
+		total += cycles
+		// A Step that ran nothing means the next would not either
+		if cpu.stopReason != StopBudget || (cycles == 0 && cpu.instructions == before) {
+			break
+		}
+	}
+	return total
+}
+
+// StopReason reports why the last Execute call returned. A halted or
+// stopped CPU takes precedence over whatever ended the timeslice.
+func (cpu *CPU) StopReason() StopReason {
+	return cpu.stopReason
+}
+
+// SetExceptionBreak sets whether taking an exception (including an
+// interrupt) ends the timeslice once the current instruction completes,
+// with StopReason reporting StopException
+func (cpu *CPU) SetExceptionBreak(enable bool) {
+	cpu.exceptionBreak = enable
+}
+
+// executeInstruction fetches and executes a single instruction. A bus or
+// address error aborts the instruction (see abortInstruction).
 func (cpu *CPU) executeInstruction() {
+	cpu.beginInstruction()
+	defer cpu.endInstruction()
+
 	// Fetch instruction
-	cpu.ir = cpu.memory.Read16(cpu.pc)
-	cpu.pc += 2
+	cpu.ir = cpu.fetchWord()
 
-	// Decode and execute
+	if cpu.instrDecodedHook != nil {
+		cpu.instrDecodedHook(cpu.ppc, cpu.ir, cpu.decodedMnemonic())
+	}
+
+	// Decode and execute. Tracing depends on the T bits as they were
+	// before the instruction, so the instruction that sets T is not traced.
+	trace := cpu.sr & (FlagT | FlagT0)
+	cpu.tracePending = trace != 0
+	cpu.flowChanged = false
 	cpu.decodeAndExecute(cpu.ir)
+	cpu.instructions++
+
+	// T1 traces every instruction, T0 (68020+) only changes of flow
+	if cpu.tracePending && !cpu.halted && (trace&FlagT != 0 || cpu.flowChanged) {
+		cpu.tracePending = false
+		cpu.stopped = false
+		cpu.trapException(VectorTrace)
+		cpu.useCycles(34)
+	}
 }
 
-// checkInterrupts checks for pending interrupts and handles them if needed
-func (cpu *CPU) checkInterrupts() {
-	if cpu.irqLevel == 0 {
-		return
+// decodedMnemonic returns the mnemonic of the instruction just fetched. It
+// is disassembled from the opcode and the two words in the prefetch queue,
+// which were read through the MMU like the instruction itself, rather than
+// by reading memory again.
+func (cpu *CPU) decodedMnemonic() string {
+	var code [6]byte
+	Write16BE(code[:], 0, cpu.ir)
+	Write32BE(code[:], 2, cpu.prefetchData)
+	text, _ := Disassemble(cpu.cpuType, code[:], cpu.ppc)
+	mnemonic, _, _ := strings.Cut(text, "\t")
+	return mnemonic
+}
+
+// busAbort is the panic value that unwinds an instruction aborted by a bus
+// or address error
+type busAbort struct{}
+
+// beginInstruction marks the start of an instruction that a fault may
+// abort. In FaultModeGo the register context is saved so the instruction
+// can be retried; its memory writes are not.
+func (cpu *CPU) beginInstruction() {
+	cpu.inInstruction = true
+	if cpu.faultMode == FaultModeGo {
+		cpu.faultContext = cpu.context()
 	}
+}
 
-	// Get current interrupt mask from SR
-	intMask := uint8((cpu.sr >> 8) & 0x07)
+// endInstruction runs deferred after an instruction and recovers from an
+// abort. In FaultModeGo the context saved by beginInstruction is restored.
+func (cpu *CPU) endInstruction() {
+	cpu.inInstruction = false
+	if r := recover(); r != nil {
+		if _, ok := r.(busAbort); !ok {
+			panic(r)
+		}
+		if cpu.fault != nil {
+			cpu.SetContext(&cpu.faultContext)
+			cpu.prefetchValid = false
+		}
+	}
+}
+
+// abortInstruction abandons the rest of the current instruction after a
+// bus or address error, like the hardware, so that it makes no further
+// accesses and is not traced. Outside an instruction (interrupt processing
+// or a PulseBusError between instructions) there is nothing to abort.
+func (cpu *CPU) abortInstruction() {
+	if cpu.inInstruction {
+		panic(busAbort{})
+	}
+}
 
-	// Level 7 is NMI, always taken
-	if cpu.irqLevel == 7 || cpu.irqLevel > intMask {
+// checkInterrupts checks for pending interrupts and handles them if needed
+func (cpu *CPU) checkInterrupts() {
+	if cpu.InterruptPending() {
 		cpu.handleInterrupt(cpu.irqLevel)
 	}
 }
@@ -337,37 +724,28 @@ func (cpu *CPU) handleInterrupt(level uint8) {
 		vector = IntAckAutovector
 	}
 
+	// A pulsed request is withdrawn by the acknowledge cycle
+	if cpu.irqPulsed {
+		cpu.irqLevel = 0
+		cpu.irqPulsed = false
+	}
+
 	// Handle special cases
+	// Autovectors are exception numbers 25-31, so level n is fetched from
+	// address (VectorAutovector+n)*4, e.g. 0x64 for level 1
 	if vector == IntAckAutovector {
-		vector = 0x18 + uint32(level) // Autovector base is 0x18
+		vector = VectorAutovector + uint32(level)
 	} else if vector == IntAckSpurious {
-		vector = 0x18 // Spurious interrupt vector
+		vector = VectorSpurious
 	}
 
-	// Build SR for exception stack frame
-	oldSR := cpu.sr
-
-	// Set supervisor mode
-	cpu.sr |= 0x2000
+	// Stack the frame and enter supervisor mode, resuming from STOP
+	cpu.stopped = false
+	cpu.exception(vector, cpu.pc)
 
 	// Update interrupt mask
 	cpu.sr = (cpu.sr & 0xF8FF) | (uint16(level) << 8)
 
-	// Save context to stack
-	cpu.pushLong(cpu.pc)
-	cpu.pushWord(oldSR)
-
-	// Get vector address
-	var vectorAddr uint32
-	if cpu.cpuType >= CPU68010 {
-		vectorAddr = cpu.vbr + (vector * 4)
-	} else {
-		vectorAddr = vector * 4
-	}
-
-	// Read new PC from vector table
-	cpu.pc = cpu.memory.Read32(vectorAddr)
-
 	// Use some cycles for exception processing
 	cpu.useCycles(44) // Approximate
 }
@@ -375,6 +753,13 @@ func (cpu *CPU) handleInterrupt(level uint8) {
 // SetMemoryHandler sets the memory access handler
 func (cpu *CPU) SetMemoryHandler(handler MemoryHandler) {
 	cpu.memory = handler
+	cpu.memoryFC, _ = handler.(MemoryHandlerFC)
+	cpu.debugMem, _ = handler.(DebugReader)
+}
+
+// GetMemoryHandler returns the memory handler set with SetMemoryHandler
+func (cpu *CPU) GetMemoryHandler() MemoryHandler {
+	return cpu.memory
 }
 
 // GetCPUType returns the current CPU type
@@ -382,9 +767,31 @@ func (cpu *CPU) GetCPUType() CPUType {
 	return cpu.cpuType
 }
 
-// SetCPUType changes the CPU type
+// SetCPUType changes the CPU type. The address mask is reset to the bus
+// width of the new type.
 func (cpu *CPU) SetCPUType(cpuType CPUType) {
 	cpu.cpuType = cpuType
+	cpu.addressMask = defaultAddressMask(cpuType)
+}
+
+// SetAddressMask sets the mask applied to every address the CPU puts on
+// the bus. It defaults to 0x00FFFFFF for CPUs with 24 address lines (68000,
+// 68010, 68EC020), so that accesses wrap around at 16MB, and to 0xFFFFFFFF
+// otherwise. Override it for systems that decode fewer or more lines.
+func (cpu *CPU) SetAddressMask(mask uint32) {
+	cpu.addressMask = mask
+}
+
+// AddressMask returns the mask applied to bus addresses
+func (cpu *CPU) AddressMask() uint32 {
+	return cpu.addressMask
+}
+
+// SetResetVectorBase sets the address Reset fetches the initial SSP and PC
+// from (at base and base+4), for systems that overlay ROM somewhere other
+// than address 0 during reset. The default is 0.
+func (cpu *CPU) SetResetVectorBase(base uint32) {
+	cpu.resetVectorBase = base
 }
 
 // SetIRQ sets the interrupt request level (0-7)
@@ -393,6 +800,32 @@ func (cpu *CPU) SetIRQ(level int) {
 		level = 0
 	}
 	cpu.irqLevel = uint8(level)
+	cpu.irqPulsed = false
+}
+
+// PulseIRQ asserts an interrupt request level (1-7) only until the CPU
+// acknowledges it, like an edge-triggered device that clears its request
+// on IACK. A later SetIRQ or SetVIRQ replaces the pulsed request.
+func (cpu *CPU) PulseIRQ(level int) {
+	cpu.SetIRQ(level)
+	cpu.irqPulsed = cpu.irqLevel != 0
+}
+
+// CurrentIRQLevel returns the interrupt request level currently asserted
+// (0 for none), whether set by SetIRQ or by virtual IRQ lines
+func (cpu *CPU) CurrentIRQLevel() int {
+	return int(cpu.irqLevel)
+}
+
+// InterruptPending reports whether the asserted interrupt would be serviced
+// before the next instruction: its level is above the SR interrupt mask,
+// or it is the non-maskable level 7
+func (cpu *CPU) InterruptPending() bool {
+	if cpu.irqLevel == 0 {
+		return false
+	}
+	intMask := uint8((cpu.sr >> 8) & 0x07)
+	return cpu.irqLevel == 7 || cpu.irqLevel > intMask
 }
 
 // SetVIRQ sets a virtual IRQ line.
@@ -405,6 +838,7 @@ func (cpu *CPU) SetVIRQ(level int, active bool) {
 
 	// Update actual IRQ level to highest active
 	cpu.irqLevel = 0
+	cpu.irqPulsed = false
 	for i := 7; i >= 1; i-- {
 		if cpu.virq[i] {
 			cpu.irqLevel = uint8(i)
@@ -426,9 +860,34 @@ func (cpu *CPU) PulseHalt() {
 	cpu.halted = true
 }
 
-// PulseBusError triggers a bus error exception
+// IsStopped reports whether the CPU is stopped by a STOP instruction,
+// waiting for an interrupt
+func (cpu *CPU) IsStopped() bool {
+	return cpu.stopped
+}
+
+// IsHalted reports whether the CPU is halted, by PulseHalt or a double
+// bus fault
+func (cpu *CPU) IsHalted() bool {
+	return cpu.halted
+}
+
+// Resume clears the halted state so that execution continues from the
+// current PC, e.g. after a PulseHalt while debugging
+func (cpu *CPU) Resume() {
+	cpu.halted = false
+	cpu.inFault = false
+}
+
+// PulseBusError triggers a bus error exception, as if the current bus cycle
+// had been terminated by the BERR pin. Called from a memory handler, it
+// aborts the instruction making the access, and the frame records that
+// access. A bus error while the CPU cannot stack the exception frame (e.g.
+// the supervisor stack pointer is invalid) is a double fault and halts the
+// CPU.
 func (cpu *CPU) PulseBusError() {
-	// TODO: Implement bus error exception
+	cpu.stopped = false
+	cpu.busFault(VectorBusError, cpu.busAddress, cpu.busWriting)
 }
 
 // CyclesRun returns the number of cycles executed so far in current timeslice
@@ -448,7 +907,62 @@ func (cpu *CPU) ModifyTimeslice(cycles int) {
 
 // EndTimeslice ends the current timeslice immediately
 func (cpu *CPU) EndTimeslice() {
+	cpu.endTimeslice(StopEnded)
+}
+
+// endTimeslice ends the current timeslice, recording the reason
+func (cpu *CPU) endTimeslice(reason StopReason) {
 	cpu.cyclesRemain = 0
+	cpu.stopReason = reason
+}
+
+// SetCycleCarry controls what happens to the cycles by which an instruction
+// runs past the end of an Execute budget. When enabled (the default), the
+// overshoot is deducted from the next Execute call (which may then run no
+// instruction at all), so that the cycles run over many calls match the
+// cycles requested. When disabled, each call starts afresh and always runs
+// at least one instruction.
+func (cpu *CPU) SetCycleCarry(enable bool) {
+	cpu.cycleCarry = enable
+	cpu.overshoot = 0
+}
+
+// SetClockHz sets the CPU clock frequency used by RunFor
+func (cpu *CPU) SetClockHz(hz uint64) {
+	cpu.clockHz = hz
+	cpu.clockFrac = 0
+}
+
+// ClockHz returns the CPU clock frequency set with SetClockHz
+func (cpu *CPU) ClockHz() uint64 {
+	return cpu.clockHz
+}
+
+// RunFor runs the CPU for the number of cycles that elapse in the given
+// wall-clock duration at the configured clock frequency.
+// Fractions of a cycle are carried over to the next call so that repeated
+// short slices do not drift. Returns the actual number of cycles executed,
+// or 0 if no clock has been set.
+func (cpu *CPU) RunFor(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return cpu.Execute(cpu.cyclesFor(d))
+}
+
+// cyclesFor converts a duration into a cycle budget at the configured clock
+func (cpu *CPU) cyclesFor(d time.Duration) int {
+	hi, lo := bits.Mul64(cpu.clockHz, uint64(d))
+	lo, carry := bits.Add64(lo, cpu.clockFrac, 0)
+	hi += carry
+	if hi >= uint64(time.Second) {
+		// Budget too large to represent; no meaningful timeslice is this long
+		cpu.clockFrac = 0
+		return int(^uint(0) >> 1)
+	}
+	cycles, frac := bits.Div64(hi, lo, uint64(time.Second))
+	cpu.clockFrac = frac
+	return int(cycles)
 }
 
 // useCycles consumes the specified number of cycles
@@ -469,13 +983,16 @@ func (cpu *CPU) GetRegister(reg Register) uint32 {
 	case RegSR:
 		return uint32(cpu.sr)
 	case RegSP:
-		if cpu.sr&0x2000 != 0 { // Supervisor mode
+		return cpu.a[7]
+	case RegUSP:
+		if cpu.sr&FlagS == 0 { // User mode, USP is active
 			return cpu.a[7]
 		}
 		return cpu.usp
-	case RegUSP:
-		return cpu.usp
 	case RegISP:
+		if cpu.sr&FlagS != 0 { // Supervisor mode, ISP is active
+			return cpu.a[7]
+		}
 		return cpu.isp
 	case RegMSP:
 		return cpu.msp
@@ -499,6 +1016,8 @@ func (cpu *CPU) GetRegister(reg Register) uint32 {
 		return uint32(cpu.ir)
 	case RegCPUType:
 		return uint32(cpu.cpuType)
+	case RegCCR:
+		return uint32(cpu.GetCCR())
 	default:
 		return 0
 	}
@@ -514,11 +1033,21 @@ func (cpu *CPU) SetRegister(reg Register, value uint32) {
 	case RegPC:
 		cpu.pc = value
 	case RegSR:
-		cpu.sr = uint16(value)
+		cpu.SetSR(uint16(value))
+	case RegSP:
+		cpu.a[7] = value
 	case RegUSP:
-		cpu.usp = value
+		if cpu.sr&FlagS == 0 {
+			cpu.a[7] = value
+		} else {
+			cpu.usp = value
+		}
 	case RegISP:
-		cpu.isp = value
+		if cpu.sr&FlagS != 0 {
+			cpu.a[7] = value
+		} else {
+			cpu.isp = value
+		}
 	case RegMSP:
 		cpu.msp = value
 	case RegSFC:
@@ -528,12 +1057,76 @@ func (cpu *CPU) SetRegister(reg Register, value uint32) {
 	case RegVBR:
 		cpu.vbr = value
 	case RegCACR:
-		cpu.cacr = value
+		cpu.setCACR(value)
 	case RegCAAR:
 		cpu.caar = value
+	case RegCCR:
+		cpu.SetCCR(uint8(value))
+	}
+}
+
+// RegisterFile is a snapshot of the CPU registers for live inspection,
+// e.g. by a debugger UI. Unlike Context it is meant to be read and edited
+// field by field; use GetContext/SetContext for save-states.
+type RegisterFile struct {
+	D    [8]uint32 // D0-D7
+	A    [8]uint32 // A0-A7; A7 is the active stack pointer
+	PC   uint32    // Program counter
+	SR   uint16    // Status register
+	USP  uint32    // User stack pointer
+	ISP  uint32    // Interrupt (supervisor) stack pointer
+	MSP  uint32    // Master stack pointer (68020+)
+	SFC  uint8     // Source function code (68010+)
+	DFC  uint8     // Destination function code (68010+)
+	VBR  uint32    // Vector base register (68010+)
+	CACR uint32    // Cache control register (68020+)
+	CAAR uint32    // Cache address register (68020+)
+	PPC  uint32    // Address of the last instruction executed
+	IR   uint16    // Opcode of the last instruction executed
+}
+
+// GetRegisters returns all registers at once. USP and ISP hold the real
+// values of both stack pointers, one of which is also A[7].
+func (cpu *CPU) GetRegisters() RegisterFile {
+	return RegisterFile{
+		D:    cpu.d,
+		A:    cpu.a,
+		PC:   cpu.pc,
+		SR:   cpu.sr,
+		USP:  cpu.GetRegister(RegUSP),
+		ISP:  cpu.GetRegister(RegISP),
+		MSP:  cpu.msp,
+		SFC:  cpu.sfc,
+		DFC:  cpu.dfc,
+		VBR:  cpu.vbr,
+		CACR: cpu.cacr,
+		CAAR: cpu.caar,
+		PPC:  cpu.ppc,
+		IR:   cpu.ir,
 	}
 }
 
+// SetRegisters loads all registers at once. A[7] is taken as the stack
+// pointer of the mode selected by SR; the other of USP and ISP is set from
+// its field. PPC and IR are informational and are not written back.
+func (cpu *CPU) SetRegisters(regs RegisterFile) {
+	cpu.d = regs.D
+	cpu.a = regs.A
+	cpu.pc = regs.PC
+	cpu.sr = regs.SR & cpu.srMask()
+	if cpu.sr&FlagS != 0 {
+		cpu.usp = regs.USP
+	} else {
+		cpu.isp = regs.ISP
+	}
+	cpu.msp = regs.MSP
+	cpu.sfc = regs.SFC
+	cpu.dfc = regs.DFC
+	cpu.vbr = regs.VBR
+	cpu.setCACR(regs.CACR)
+	cpu.caar = regs.CAAR
+}
+
 // GetPC returns the program counter
 func (cpu *CPU) GetPC() uint32 {
 	return cpu.pc
@@ -541,27 +1134,28 @@ func (cpu *CPU) GetPC() uint32 {
 
 // SetPC sets the program counter
 func (cpu *CPU) SetPC(address uint32) {
+	cpu.setPC(address)
+}
+
+// setPC sets the program counter for a change of flow (jump, branch,
+// return or exception) and reports it to the PC changed callback
+func (cpu *CPU) setPC(address uint32) {
 	cpu.pc = address
+	cpu.flowChanged = true
+	cpu.prefetchValid = false
 	if cpu.pcChangedCallback != nil {
 		cpu.pcChangedCallback(address)
 	}
 }
 
-// GetSP returns the current stack pointer
+// GetSP returns the current stack pointer (A7 of the active mode)
 func (cpu *CPU) GetSP() uint32 {
-	if cpu.sr&0x2000 != 0 { // Supervisor mode
-		return cpu.a[7]
-	}
-	return cpu.usp
+	return cpu.a[7]
 }
 
-// SetSP sets the current stack pointer
+// SetSP sets the current stack pointer (A7 of the active mode)
 func (cpu *CPU) SetSP(address uint32) {
-	if cpu.sr&0x2000 != 0 { // Supervisor mode
-		cpu.a[7] = address
-	} else {
-		cpu.usp = address
-	}
+	cpu.a[7] = address
 }
 
 // GetSR returns the status register
@@ -569,24 +1163,53 @@ func (cpu *CPU) GetSR() uint16 {
 	return cpu.sr
 }
 
-// SetSR sets the status register
+// SetSR sets the status register.
+// Changing the S bit swaps A7 between the user and supervisor stack pointers,
+// and discards the prefetch queue, which was filled from the other program
+// space.
 func (cpu *CPU) SetSR(value uint16) {
-	cpu.sr = value
+	if (cpu.sr^value)&FlagS != 0 {
+		cpu.prefetchValid = false
+	}
+	cpu.setSR(value)
+}
+
+// GetCCR returns the condition code register (the low byte of SR)
+func (cpu *CPU) GetCCR() uint8 {
+	return uint8(cpu.sr)
+}
+
+// SetCCR sets the condition code register, leaving the system byte of SR
+// intact. Bits 5-7 do not exist and are cleared.
+func (cpu *CPU) SetCCR(value uint8) {
+	cpu.sr = (cpu.sr & 0xFF00) | uint16(value&0x1F)
+}
+
+// stackMisaligned reports whether the stack pointer is odd on a CPU whose
+// word and long accesses must be aligned, and if so takes an address error.
+// An odd stack pointer during exception processing is a double fault and
+// halts the CPU.
+func (cpu *CPU) stackMisaligned(write bool) bool {
+	if cpu.a[7]&1 == 0 || cpu.is020Plus() {
+		return false
+	}
+	cpu.busFault(VectorAddressError, cpu.a[7], write)
+	return true
 }
 
 // pushWord pushes a word onto the stack
 func (cpu *CPU) pushWord(value uint16) {
 	cpu.a[7] -= 2
-	if cpu.memory != nil {
-		cpu.memory.Write16(cpu.a[7], value)
+	if cpu.memory != nil && !cpu.stackMisaligned(true) {
+		cpu.busWrite(cpu.a[7], uint32(value), 16, cpu.dataFC())
 	}
 }
 
 // pushLong pushes a longword onto the stack
 func (cpu *CPU) pushLong(value uint32) {
 	cpu.a[7] -= 4
-	if cpu.memory != nil {
-		cpu.memory.Write32(cpu.a[7], value)
+	if cpu.memory != nil && !cpu.stackMisaligned(true) {
+		cpu.busWrite(cpu.a[7], value, 32, cpu.dataFC())
 	}
 }
 
@@ -595,7 +1218,7 @@ func (cpu *CPU) popWord() uint16 {
 	if cpu.memory == nil {
 		return 0
 	}
-	value := cpu.memory.Read16(cpu.a[7])
+	value := uint16(cpu.busRead(cpu.a[7], 16, cpu.dataFC()))
 	cpu.a[7] += 2
 	return value
 }
@@ -605,7 +1228,7 @@ func (cpu *CPU) popLong() uint32 {
 	if cpu.memory == nil {
 		return 0
 	}
-	value := cpu.memory.Read32(cpu.a[7])
+	value := cpu.busRead(cpu.a[7], 32, cpu.dataFC())
 	cpu.a[7] += 4
 	return value
 }
@@ -620,12 +1243,16 @@ func (cpu *CPU) SetResetCallback(callback func()) {
 	cpu.resetCallback = callback
 }
 
-// SetPCChangedCallback sets the PC changed callback
+// SetPCChangedCallback sets a callback invoked with the new PC on every
+// change of flow: jumps, taken branches, returns, exceptions and SetPC.
+// Sequential execution does not call it.
 func (cpu *CPU) SetPCChangedCallback(callback func(newPC uint32)) {
 	cpu.pcChangedCallback = callback
 }
 
-// SetFCCallback sets the function code callback
+// SetFCCallback sets the function code callback.
+// It is called with the function code (see FCUserData etc.) before each
+// bus access, including instruction fetches and stack accesses.
 func (cpu *CPU) SetFCCallback(callback func(fc uint8)) {
 	cpu.fcCallback = callback
 }
@@ -635,21 +1262,56 @@ func (cpu *CPU) SetInstrHookCallback(callback func(pc uint32)) {
 	cpu.instrHookCallback = callback
 }
 
+// SetInstrDecodedHook sets a callback invoked after each instruction is
+// fetched and before it executes, with its address, opcode and mnemonic
+// (e.g. "MOVEQ") as the disassembler renders it. The mnemonic is decoded
+// from the words actually fetched, so it matches the opcode even when the
+// MMU maps the code to a different physical address.
+func (cpu *CPU) SetInstrDecodedHook(callback func(pc uint32, opcode uint16, mnemonic string)) {
+	cpu.instrDecodedHook = callback
+}
+
+// SetExceptionCallback sets a callback invoked when the CPU enters an
+// exception (including interrupts) and when RTE returns from one. On exit
+// the vector comes from the stacked frame; the 68000's frames do not record
+// it, so there it is the vector of the most recent exception taken.
+func (cpu *CPU) SetExceptionCallback(callback func(vector uint32, entering bool)) {
+	cpu.exceptionCallback = callback
+}
+
 // SetBkptAckCallback sets the breakpoint acknowledge callback
 func (cpu *CPU) SetBkptAckCallback(callback func(data uint32)) {
 	cpu.bkptAckCallback = callback
 }
 
-// SetIllegalInstrCallback sets the illegal instruction callback
+// SetIllegalInstrCallback sets a callback invoked for every opcode that
+// would take an illegal instruction, line A or line F exception, for
+// high-level emulation of reserved opcodes. When it is called, PC points
+// just past the opcode word and PPC at the opcode. Returning true means the
+// host emulated the instruction: execution continues at PC (which the
+// callback may change, along with any other register) without trapping.
+// Returning false takes the exception as usual.
 func (cpu *CPU) SetIllegalInstrCallback(callback func(opcode uint16) bool) {
 	cpu.illegalCallback = callback
 }
 
-// SetTASCallback sets the TAS instruction callback
+// SetTASCallback sets a callback invoked by TAS on a memory operand after
+// the read and before the write-back of its read-modify-write cycle.
+// Returning nonzero skips the write-back, leaving bit 7 of the operand
+// unchanged, to model buses that do not support the locked cycle. The
+// flags are set from the value read either way. Returning 0 lets the write
+// proceed, as it does with no callback.
 func (cpu *CPU) SetTASCallback(callback func() int) {
 	cpu.tasCallback = callback
 }
 
+// SetBusTimingCallback sets a callback that returns the number of wait-state
+// cycles to add for each memory access, for emulating slow RAM or I/O.
+// It is called once per access, including instruction fetches.
+func (cpu *CPU) SetBusTimingCallback(callback func(addr uint32, size int, isWrite bool) int) {
+	cpu.busTimingCallback = callback
+}
+
 // Context represents a saved CPU context
 type Context struct {
 	cpuType CPUType
@@ -669,7 +1331,13 @@ type Context struct {
 
 // GetContext returns a copy of the current CPU context
 func (cpu *CPU) GetContext() *Context {
-	ctx := &Context{
+	ctx := cpu.context()
+	return &ctx
+}
+
+// context returns the current CPU context by value
+func (cpu *CPU) context() Context {
+	ctx := Context{
 		cpuType: cpu.cpuType,
 		pc:      cpu.pc,
 		sr:      cpu.sr,
@@ -689,7 +1357,9 @@ func (cpu *CPU) GetContext() *Context {
 
 // SetContext restores a saved CPU context
 func (cpu *CPU) SetContext(ctx *Context) {
-	cpu.cpuType = ctx.cpuType
+	if ctx.cpuType != cpu.cpuType {
+		cpu.SetCPUType(ctx.cpuType)
+	}
 	cpu.pc = ctx.pc
 	cpu.sr = ctx.sr
 	cpu.usp = ctx.usp
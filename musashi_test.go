@@ -1,7 +1,11 @@
 package musashi
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 // SimpleMemory is a basic memory implementation for testing
@@ -14,14 +18,11 @@ func (m *SimpleMemory) Read8(address uint32) uint8 {
 }
 
 func (m *SimpleMemory) Read16(address uint32) uint16 {
-	addr := address & 0xFFFFF
-	return uint16(m.ram[addr])<<8 | uint16(m.ram[addr+1])
+	return Read16BE(m.ram[:], address&0xFFFFF)
 }
 
 func (m *SimpleMemory) Read32(address uint32) uint32 {
-	addr := address & 0xFFFFF
-	return uint32(m.ram[addr])<<24 | uint32(m.ram[addr+1])<<16 |
-		uint32(m.ram[addr+2])<<8 | uint32(m.ram[addr+3])
+	return Read32BE(m.ram[:], address&0xFFFFF)
 }
 
 func (m *SimpleMemory) Write8(address uint32, value uint8) {
@@ -29,17 +30,11 @@ func (m *SimpleMemory) Write8(address uint32, value uint8) {
 }
 
 func (m *SimpleMemory) Write16(address uint32, value uint16) {
-	addr := address & 0xFFFFF
-	m.ram[addr] = uint8(value >> 8)
-	m.ram[addr+1] = uint8(value)
+	Write16BE(m.ram[:], address&0xFFFFF, value)
 }
 
 func (m *SimpleMemory) Write32(address uint32, value uint32) {
-	addr := address & 0xFFFFF
-	m.ram[addr] = uint8(value >> 24)
-	m.ram[addr+1] = uint8(value >> 16)
-	m.ram[addr+2] = uint8(value >> 8)
-	m.ram[addr+3] = uint8(value)
+	Write32BE(m.ram[:], address&0xFFFFF, value)
 }
 
 func TestNewCPU(t *testing.T) {
@@ -52,6 +47,29 @@ func TestNewCPU(t *testing.T) {
 	}
 }
 
+func TestNewCPUWithMemory(t *testing.T) {
+	memory := &SimpleMemory{}
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write16(0x400, 0x7005) // MOVEQ #5,D0
+
+	cpu := NewCPUWithMemory(CPU68010, memory)
+	if cpu.GetCPUType() != CPU68010 {
+		t.Errorf("Expected CPU type 68010, got %v", cpu.GetCPUType())
+	}
+	if cpu.GetSP() != 0x00001000 {
+		t.Errorf("Expected SP = 0x00001000, got 0x%08X", cpu.GetSP())
+	}
+	if cpu.GetPC() != 0x00000400 {
+		t.Errorf("Expected PC = 0x00000400, got 0x%08X", cpu.GetPC())
+	}
+
+	cpu.Step()
+	if cpu.d[0] != 5 {
+		t.Errorf("Expected the CPU to run MOVEQ, got D0 = %d", cpu.d[0])
+	}
+}
+
 func TestCPUTypeString(t *testing.T) {
 	tests := []struct {
 		cpuType CPUType
@@ -178,6 +196,79 @@ func TestIRQHandling(t *testing.T) {
 	}
 }
 
+func TestAutovectorInterrupt(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)    // Initial SSP
+	memory.Write32(4, 0x00000400)    // Initial PC
+	memory.Write32(0x64, 0x00000500) // Level 1 autovector
+	memory.Write16(0x400, 0x4E71)    // NOP
+	memory.Write16(0x500, 0x4E71)    // NOP
+
+	cpu.Reset()
+	cpu.SetSR(0x2000)
+	cpu.SetIRQ(1)
+	cpu.Step()
+
+	if cpu.ppc != 0x500 {
+		t.Errorf("Expected the level 1 handler at 0x500 to run, got PPC 0x%08X", cpu.ppc)
+	}
+	if got := cpu.GetSR() & 0x0700; got != 0x0100 {
+		t.Errorf("Expected interrupt mask 1, got %d", got>>8)
+	}
+	if got := memory.Read32(0x1000 - 4); got != 0x400 {
+		t.Errorf("Expected stacked PC 0x400, got 0x%08X", got)
+	}
+	if got := memory.Read16(0x1000 - 6); got != 0x2000 {
+		t.Errorf("Expected stacked SR 0x2000, got 0x%04X", got)
+	}
+}
+
+func TestPulseIRQ(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)    // Initial SSP
+	memory.Write32(4, 0x00000400)    // Initial PC
+	memory.Write32(0x6C, 0x00000500) // Level 3 autovector
+	for addr := uint32(0x400); addr < 0x410; addr += 2 {
+		memory.Write16(addr, 0x4E71) // NOP
+	}
+	memory.Write16(0x500, 0x4E73) // RTE
+
+	cpu.Reset()
+	cpu.SetSR(0x2000)
+
+	serviced := 0
+	cpu.SetExceptionCallback(func(vector uint32, entering bool) {
+		if entering && vector == VectorAutovector+3 {
+			serviced++
+		}
+	})
+
+	cpu.PulseIRQ(3)
+	if cpu.CurrentIRQLevel() != 3 {
+		t.Errorf("Expected IRQ level 3 while pulsed, got %d", cpu.CurrentIRQLevel())
+	}
+
+	// The handler's RTE restores mask 0, which would retake a latched level
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+	if serviced != 1 {
+		t.Errorf("Expected the pulsed IRQ to be serviced once, got %d", serviced)
+	}
+	if cpu.CurrentIRQLevel() != 0 {
+		t.Errorf("Expected IRQ level 0 after acknowledge, got %d", cpu.CurrentIRQLevel())
+	}
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected to resume the NOPs after RTE, got PC 0x%08X", cpu.pc)
+	}
+}
+
 func TestVirtualIRQ(t *testing.T) {
 	cpu := NewCPU(CPU68000)
 
@@ -200,6 +291,71 @@ func TestVirtualIRQ(t *testing.T) {
 	}
 }
 
+// TestInterruptPending tests the IRQ level and pending state against the
+// interrupt mask
+func TestInterruptPending(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+
+	cpu.SetSR(0x2300)
+	cpu.SetIRQ(2)
+	if cpu.CurrentIRQLevel() != 2 {
+		t.Errorf("Expected IRQ level 2, got %d", cpu.CurrentIRQLevel())
+	}
+	if cpu.InterruptPending() {
+		t.Error("Expected IRQ2 to be masked with mask 3")
+	}
+
+	cpu.SetSR(0x2100)
+	if !cpu.InterruptPending() {
+		t.Error("Expected IRQ2 to be pending with mask 1")
+	}
+
+	// Level 7 is non-maskable
+	cpu.SetSR(0x2700)
+	cpu.SetIRQ(7)
+	if !cpu.InterruptPending() {
+		t.Error("Expected IRQ7 to be pending with mask 7")
+	}
+
+	cpu.SetIRQ(0)
+	cpu.SetVIRQ(5, true)
+	if cpu.CurrentIRQLevel() != 5 || cpu.InterruptPending() {
+		t.Errorf("Expected virtual IRQ5 to be asserted but masked, got level %d", cpu.CurrentIRQLevel())
+	}
+}
+
+// TestResetClearsInterrupts tests that Reset drops virtual IRQ lines
+func TestResetClearsInterrupts(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	cpu.SetVIRQ(5, true)
+	cpu.stopped = true
+	cpu.PulseHalt()
+
+	cpu.Reset()
+
+	if cpu.GetVIRQ(5) {
+		t.Error("Expected VIRQ 5 to be cleared by reset")
+	}
+	if cpu.irqLevel != 0 {
+		t.Errorf("Expected IRQ level 0 after reset, got %d", cpu.irqLevel)
+	}
+	if cpu.IsStopped() || cpu.IsHalted() {
+		t.Error("Expected reset to clear the stopped and halted states")
+	}
+
+	// Lowering another line must not bring the old request back
+	cpu.SetVIRQ(2, false)
+	if cpu.irqLevel != 0 {
+		t.Errorf("Expected IRQ level 0, got %d", cpu.irqLevel)
+	}
+}
+
 func TestContextSaveRestore(t *testing.T) {
 	cpu := NewCPU(CPU68000)
 
@@ -321,24 +477,1505 @@ func TestCallbacks(t *testing.T) {
 	}
 }
 
-// Example test showing basic usage
-func ExampleCPU() {
-	// Create a new 68000 CPU
+// TestPCChangedCallback tests that jumps and returns report the new PC
+func TestPCChangedCallback(t *testing.T) {
 	cpu := NewCPU(CPU68000)
-
-	// Create simple memory
 	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
 
-	// Set up initial vectors
-	memory.Write32(0, 0x00001000) // Stack pointer
-	memory.Write32(4, 0x00000400) // Program counter
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
 
-	// Set memory handler
-	cpu.SetMemoryHandler(memory)
+	// JMP $0600 = 0x4EF8 0x0600
+	memory.Write16(0x400, 0x4EF8)
+	memory.Write16(0x402, 0x0600)
+	// NOP
+	memory.Write16(0x600, 0x4E71)
+	// RTS
+	memory.Write16(0x602, 0x4E75)
+	memory.Write32(0x0FFC, 0x00000800)
+
+	var seen []uint32
+	cpu.SetPCChangedCallback(func(newPC uint32) {
+		seen = append(seen, newPC)
+	})
 
-	// Reset CPU
 	cpu.Reset()
+	cpu.a[7] = 0x0FFC
+
+	cpu.Step()
+	if len(seen) != 1 || seen[0] != 0x600 {
+		t.Fatalf("Expected callback with 0x600 after JMP, got %v", seen)
+	}
+
+	// Sequential execution does not report
+	cpu.Step()
+	if len(seen) != 1 {
+		t.Fatalf("Expected no callback for NOP, got %v", seen)
+	}
+
+	cpu.Step()
+	if len(seen) != 2 || seen[1] != 0x800 {
+		t.Errorf("Expected callback with 0x800 after RTS, got %v", seen)
+	}
+}
+
+func TestSRUndefinedBits(t *testing.T) {
+	tests := []struct {
+		cpuType CPUType
+		want    uint16
+	}{
+		{CPU68000, 0xA71F},
+		{CPU68010, 0xA71F},
+		{CPU68020, 0xF71F},
+	}
+	for _, tt := range tests {
+		cpu := NewCPU(tt.cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		cpu.SetSR(0xFFFF)
+		if got := cpu.GetSR(); got != tt.want {
+			t.Errorf("%v: expected SR = 0x%04X after SetSR(0xFFFF), got 0x%04X", tt.cpuType, tt.want, got)
+		}
+
+		// STOP #$FFFF
+		memory.Write16(0x400, 0x4E72)
+		memory.Write16(0x402, 0xFFFF)
+		cpu.SetPC(0x400)
+		cpu.SetSR(0x2700)
+		cpu.Step()
+		if got := cpu.GetSR(); got != tt.want {
+			t.Errorf("%v: expected SR = 0x%04X after STOP #$FFFF, got 0x%04X", tt.cpuType, tt.want, got)
+		}
+	}
+}
+
+func TestFlagsString(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+
+	tests := []struct {
+		sr   uint16
+		want string
+	}{
+		{0x2700, "[--S7---xnzvc]"},
+		{0x2715, "[--S7---XnZvC]"},
+		{0x0008, "[---0---xNzvc]"},
+		{0xA31F, "[T-S3---XNZVC]"},
+	}
+
+	for _, tt := range tests {
+		cpu.SetSR(tt.sr)
+		if got := cpu.FlagsString(); got != tt.want {
+			t.Errorf("FlagsString() for SR 0x%04X = %s, want %s", tt.sr, got, tt.want)
+		}
+	}
+}
+
+// TestRunFor tests cycle budgets derived from the clock frequency
+func TestRunFor(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+	cpu.Reset()
+
+	if cycles := cpu.RunFor(time.Millisecond); cycles != 0 {
+		t.Errorf("Expected no cycles without a clock, got %d", cycles)
+	}
+
+	cpu.SetClockHz(7160000)
+
+	if budget := cpu.cyclesFor(time.Millisecond); budget != 7160 {
+		t.Errorf("Expected budget of 7160 cycles, got %d", budget)
+	}
+
+	// Fill memory with NOPs and run for 1ms
+	for addr := uint32(0x400); addr < 0x8000; addr += 2 {
+		mem.Write16(addr, 0x4E71)
+	}
+	cycles := cpu.RunFor(time.Millisecond)
+	if cycles < 7160 || cycles > 7164 {
+		t.Errorf("Expected about 7160 cycles, got %d", cycles)
+	}
+
+	// Fractional cycles accumulate across short slices
+	total := 0
+	for i := 0; i < 1000; i++ {
+		total += cpu.cyclesFor(time.Microsecond)
+	}
+	if total != 7160 {
+		t.Errorf("Expected 7160 cycles over 1000 x 1us, got %d", total)
+	}
+}
+
+// TestSaveLoadState tests that a save state round-trips exactly
+func TestSaveLoadState(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// Loop: ADDQ.L #1,D0; ADD.L D0,D1; MOVE.L D1,-(A7); BRA.S loop
+	mem.Write16(0x400, 0x5280)
+	mem.Write16(0x402, 0xD280)
+	mem.Write16(0x404, 0x2F01)
+	mem.Write16(0x406, 0x60F8)
+
+	cpu.Reset()
+	cpu.vbr = 0x100
+	cpu.SetVIRQ(2, true)
+	cpu.SetIRQ(0)
+
+	for i := 0; i < 10; i++ {
+		cpu.Step()
+	}
+
+	state, err := cpu.SaveState()
+	if err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		cpu.Step()
+	}
+	want, _ := cpu.SaveState()
+
+	if err := cpu.LoadState(state); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if cpu.vbr != 0x100 || !cpu.GetVIRQ(2) {
+		t.Error("Control registers and IRQ lines should be restored")
+	}
+
+	for i := 0; i < 10; i++ {
+		cpu.Step()
+	}
+	got, _ := cpu.SaveState()
+
+	if string(got) != string(want) {
+		t.Errorf("Re-run from save state diverged:\n got %x\nwant %x", got, want)
+	}
+
+	// The overshoot awaiting the next Execute is saved too
+	cpu.Execute(1)
+	pending := cpu.overshoot
+	state, _ = cpu.SaveState()
+	cpu.Reset()
+	if err := cpu.LoadState(state); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if pending == 0 || cpu.overshoot != pending {
+		t.Errorf("Expected overshoot %d restored, got %d", pending, cpu.overshoot)
+	}
+
+	if err := cpu.LoadState([]byte("junk")); err == nil {
+		t.Error("Expected error loading invalid state")
+	}
+	if err := cpu.LoadState(state[:20]); err == nil {
+		t.Error("Expected error loading truncated state")
+	}
+}
+
+// TestContextJSON tests marshaling a context to JSON and back
+func TestContextJSON(t *testing.T) {
+	cpu := NewCPU(CPU68020)
+	cpu.SetRegister(RegD0, 0x11111111)
+	cpu.SetRegister(RegA3, 0x00C0FFEE)
+	cpu.SetPC(0x00001234)
+	cpu.SetSR(0x2704)
+
+	data, err := json.Marshal(cpu.GetContext())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`"cpu_type":"68020"`,
+		`"d":[286331153,`,
+		`"a":[0,0,0,12648430,`,
+		`"pc":4660`,
+		`"sr":9988`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s in %s", want, data)
+		}
+	}
+
+	var ctx Context
+	if err := json.Unmarshal(data, &ctx); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if ctx != *cpu.GetContext() {
+		t.Errorf("Context did not round-trip: got %+v", ctx)
+	}
+
+	if err := json.Unmarshal([]byte(`{"cpu_type":"Z80"}`), &ctx); err == nil {
+		t.Error("Expected error for unknown CPU type")
+	}
+}
+
+// TestDiffContext tests listing the registers that differ between contexts
+func TestDiffContext(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	cpu.SetRegister(RegD0, 0x1234)
+	a := cpu.GetContext()
+
+	if diffs := DiffContext(a, cpu.GetContext()); diffs != nil {
+		t.Errorf("Expected no differences, got %v", diffs)
+	}
+
+	cpu.SetRegister(RegD0, 0x5678)
+	diffs := DiffContext(a, cpu.GetContext())
+	if len(diffs) != 1 || diffs[0] != "D0: 0x00001234 != 0x00005678" {
+		t.Errorf("Expected one D0 difference, got %q", diffs)
+	}
+}
+
+// TestBreakpoints tests that execution stops at a breakpoint and resumes
+func TestBreakpoints(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// ADDQ.L #1,D0 x 8
+	for addr := uint32(0x400); addr < 0x410; addr += 2 {
+		mem.Write16(addr, 0x5280)
+	}
+
+	cpu.Reset()
+
+	var hits []uint32
+	cpu.SetBreakpointCallback(func(pc uint32) {
+		hits = append(hits, pc)
+	})
+	cpu.AddBreakpoint(0x406)
+
+	cpu.Execute(1000)
+
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected PC = 0x406, got 0x%08X", cpu.pc)
+	}
+	if cpu.d[0] != 3 {
+		t.Errorf("Expected D0 = 3, got %d", cpu.d[0])
+	}
+	if len(hits) != 1 || hits[0] != 0x406 {
+		t.Errorf("Expected one callback at 0x406, got %v", hits)
+	}
+
+	// Resuming executes the instruction at the breakpoint
+	cpu.RemoveBreakpoint(0x406)
+	cpu.AddBreakpointRange(0x40A, 0x40E)
+	cpu.Execute(1000)
+
+	if cpu.pc != 0x40A || cpu.d[0] != 5 {
+		t.Errorf("Expected range break at 0x40A with D0 = 5, got PC = 0x%08X, D0 = %d", cpu.pc, cpu.d[0])
+	}
 
-	// Execute instructions
 	cpu.Execute(1000)
+
+	if cpu.pc != 0x40C || cpu.d[0] != 6 {
+		t.Errorf("Expected range break at 0x40C with D0 = 6, got PC = 0x%08X, D0 = %d", cpu.pc, cpu.d[0])
+	}
+}
+
+// TestPeekPoke tests debug memory accesses, which bypass watchpoints
+func TestPeekPoke(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	hits := 0
+	cpu.SetWatchpointCallback(func(addr uint32, size int, isWrite bool, value uint32) { hits++ })
+	cpu.AddWatchpointRange(0x2000, 0x2010, true, true)
+
+	cpu.Poke32(0x2000, 0x12345678)
+	cpu.Poke16(0x2004, 0xABCD)
+	cpu.Poke8(0x2006, 0xEF)
+
+	if got := cpu.Peek32(0x2000); got != 0x12345678 {
+		t.Errorf("Expected Peek32 = 0x12345678, got 0x%08X", got)
+	}
+	if got := cpu.Peek16(0x2004); got != 0xABCD {
+		t.Errorf("Expected Peek16 = 0xABCD, got 0x%04X", got)
+	}
+	if got := cpu.Peek8(0x2006); got != 0xEF {
+		t.Errorf("Expected Peek8 = 0xEF, got 0x%02X", got)
+	}
+	if got := mem.Read16(0x2002); got != 0x5678 {
+		t.Errorf("Expected big-endian storage, got 0x%04X at 0x2002", got)
+	}
+	if hits != 0 {
+		t.Errorf("Expected debug accesses not to trigger watchpoints, got %d hits", hits)
+	}
+}
+
+// TestWatchpoints tests that writes to a watched address fire the callback
+func TestWatchpoints(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// MOVE.B D1,(A0) = 0x1081
+	mem.Write16(0x400, 0x1081)
+	// MOVE.L D1,(A1) = 0x2281
+	mem.Write16(0x402, 0x2281)
+	// NOP
+	mem.Write16(0x404, 0x4E71)
+
+	cpu.Reset()
+
+	type hit struct {
+		addr    uint32
+		size    int
+		isWrite bool
+		value   uint32
+	}
+	var hits []hit
+	cpu.SetWatchpointCallback(func(addr uint32, size int, isWrite bool, value uint32) {
+		hits = append(hits, hit{addr, size, isWrite, value})
+	})
+
+	// Read-only watch on the byte target must not fire on a write
+	cpu.AddWatchpoint(0x3000, true, false)
+	// Write watch on a byte in the middle of the long target
+	cpu.AddWatchpoint(0x2002, false, true)
+	// Unrelated ranges
+	cpu.AddWatchpointRange(0x8000, 0x8FFF, true, true)
+	cpu.AddWatchpointRange(0x10, 0x1FFF, false, false)
+
+	cpu.a[0] = 0x3000
+	cpu.a[1] = 0x2000
+	cpu.d[1] = 0x12345678
+
+	cpu.Step()
+	if len(hits) != 0 {
+		t.Errorf("Expected no hits for a write to a read watchpoint, got %v", hits)
+	}
+
+	cpu.SetWatchpointBreak(true)
+	cycles := cpu.Execute(100)
+
+	if len(hits) != 1 {
+		t.Fatalf("Expected one hit, got %v", hits)
+	}
+	if want := (hit{0x2000, 32, true, 0x12345678}); hits[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, hits[0])
+	}
+	if cpu.pc != 0x404 {
+		t.Errorf("Expected execution to stop after the write at 0x404, got 0x%08X (%d cycles)", cpu.pc, cycles)
+	}
+
+	cpu.ClearWatchpoints()
+	mem.Write16(0x404, 0x2281)
+	cpu.Step()
+	if len(hits) != 1 {
+		t.Errorf("Expected no hits after ClearWatchpoints, got %v", hits)
+	}
+}
+
+// TestTraceWriter tests the instruction trace of a three-instruction program
+func TestTraceWriter(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// MOVEQ #$42,D0; NOP; MOVEQ #-1,D1
+	mem.Write16(0x400, 0x7042)
+	mem.Write16(0x402, 0x4E71)
+	mem.Write16(0x404, 0x72FF)
+
+	cpu.Reset()
+
+	var trace strings.Builder
+	cpu.SetTraceWriter(&trace)
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 trace lines, got %d:\n%s", len(lines), trace.String())
+	}
+
+	want := "00000400  MOVEQ #$42,D0            D0=00000042 D1=00000000 D2=00000000 D3=00000000" +
+		" D4=00000000 D5=00000000 D6=00000000 D7=00000000 A0=00000000 A1=00000000 A2=00000000" +
+		" A3=00000000 A4=00000000 A5=00000000 A6=00000000 A7=00001000 SR=2700"
+	if lines[0] != want {
+		t.Errorf("Line 1:\n got %q\nwant %q", lines[0], want)
+	}
+	if !strings.HasPrefix(lines[1], "00000402  NOP  ") {
+		t.Errorf("Line 2: got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "00000404  MOVEQ ") ||
+		!strings.Contains(lines[2], " D1=FFFFFFFF ") || !strings.HasSuffix(lines[2], " SR=2708") {
+		t.Errorf("Line 3: got %q", lines[2])
+	}
+
+	// No output once the writer is removed
+	cpu.SetTraceWriter(nil)
+	trace.Reset()
+	cpu.Step()
+	if trace.Len() != 0 {
+		t.Errorf("Expected no trace output, got %q", trace.String())
+	}
+}
+
+// protectedMemory rejects user data accesses to a supervisor-only region
+type protectedMemory struct {
+	SimpleMemory
+	violations []uint32
+}
+
+func (m *protectedMemory) allowed(address uint32, fc int) bool {
+	if address >= 0x8000 && address < 0x9000 && fc == FCUserData {
+		m.violations = append(m.violations, address)
+		return false
+	}
+	return true
+}
+
+func (m *protectedMemory) Read8FC(address uint32, fc int) uint8 {
+	if !m.allowed(address, fc) {
+		return 0xFF
+	}
+	return m.Read8(address)
+}
+
+func (m *protectedMemory) Read16FC(address uint32, fc int) uint16 {
+	if !m.allowed(address, fc) {
+		return 0xFFFF
+	}
+	return m.Read16(address)
+}
+
+func (m *protectedMemory) Read32FC(address uint32, fc int) uint32 {
+	if !m.allowed(address, fc) {
+		return 0xFFFFFFFF
+	}
+	return m.Read32(address)
+}
+
+func (m *protectedMemory) Write8FC(address uint32, value uint8, fc int) {
+	if m.allowed(address, fc) {
+		m.Write8(address, value)
+	}
+}
+
+func (m *protectedMemory) Write16FC(address uint32, value uint16, fc int) {
+	if m.allowed(address, fc) {
+		m.Write16(address, value)
+	}
+}
+
+func (m *protectedMemory) Write32FC(address uint32, value uint32, fc int) {
+	if m.allowed(address, fc) {
+		m.Write32(address, value)
+	}
+}
+
+// TestMemoryHandlerFC tests that function codes reach an FC-aware handler
+func TestMemoryHandlerFC(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &protectedMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+	mem.Write32(0x8000, 0x12345678)
+
+	// MOVE.L (A0),D0 = 0x2010, twice
+	mem.Write16(0x400, 0x2010)
+	mem.Write16(0x402, 0x2010)
+
+	cpu.Reset()
+	cpu.a[0] = 0x8000
+
+	// Supervisor data read is allowed
+	cpu.Step()
+	if cpu.d[0] != 0x12345678 {
+		t.Errorf("Expected supervisor read of 0x12345678, got 0x%08X", cpu.d[0])
+	}
+
+	// User data read is rejected
+	cpu.SetSR(0x0000)
+	cpu.Step()
+	if cpu.d[0] != 0xFFFFFFFF {
+		t.Errorf("Expected rejected user read, got 0x%08X", cpu.d[0])
+	}
+	if len(mem.violations) != 1 || mem.violations[0] != 0x8000 {
+		t.Errorf("Expected one violation at 0x8000, got %v", mem.violations)
+	}
+}
+
+// TestFCCallback tests the function codes reported for program and data accesses
+func TestFCCallback(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// MOVE.L (A0),D0 = 0x2010, twice
+	mem.Write16(0x400, 0x2010)
+	mem.Write16(0x402, 0x2010)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+
+	var fcs []uint8
+	cpu.SetFCCallback(func(fc uint8) {
+		fcs = append(fcs, fc)
+	})
+
+	// Supervisor: filling the prefetch queue and a prefetch, then data read
+	cpu.Step()
+	if want := []uint8{FCSupervisorProg, FCSupervisorProg, FCSupervisorProg, FCSupervisorData}; fmt.Sprint(fcs) != fmt.Sprint(want) {
+		t.Errorf("Expected supervisor program then data %v, got %v", want, fcs)
+	}
+
+	// User mode: the queue is refilled from user program space
+	fcs = nil
+	cpu.SetSR(0x0000)
+	cpu.Step()
+	if want := []uint8{FCUserProgram, FCUserProgram, FCUserProgram, FCUserData}; fmt.Sprint(fcs) != fmt.Sprint(want) {
+		t.Errorf("Expected user program then data %v, got %v", want, fcs)
+	}
+}
+
+// TestBusTimingCallback tests wait states added by the bus timing callback
+func TestBusTimingCallback(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// MOVE.L (A0),D0 = 0x2010, twice
+	mem.Write16(0x400, 0x2010)
+	mem.Write16(0x402, 0x2010)
+
+	cpu.Reset()
+	cpu.a[0] = 0x2000
+
+	base := cpu.Step()
+
+	// Slow I/O region at 0x8000-0x8FFF adds 4 wait states per access
+	cpu.SetBusTimingCallback(func(addr uint32, size int, isWrite bool) int {
+		if addr >= 0x8000 && addr < 0x9000 {
+			return 4
+		}
+		return 0
+	})
+	cpu.a[0] = 0x8000
+
+	if cycles := cpu.Step(); cycles != base+4 {
+		t.Errorf("Expected %d cycles with wait states, got %d", base+4, cycles)
+	}
+}
+
+// TestAddressMask tests 24-bit address wraparound and SetAddressMask
+func TestAddressMask(t *testing.T) {
+	run := func(cpu *CPU) uint32 {
+		mem := &SimpleMemory{}
+		cpu.SetMemoryHandler(mem)
+
+		mem.Write32(0, 0x00001000)
+		mem.Write32(4, 0x00000400)
+
+		// MOVE.W $01000000,D0 = 0x3039 + address
+		mem.Write16(0x400, 0x3039)
+		mem.Write32(0x402, 0x01000000)
+
+		var last uint32
+		cpu.SetBusTimingCallback(func(addr uint32, size int, isWrite bool) int {
+			last = addr
+			return 0
+		})
+		cpu.Reset()
+		cpu.Step()
+		return last
+	}
+
+	if addr := run(NewCPU(CPU68000)); addr != 0x000000 {
+		t.Errorf("Expected 68000 access to wrap to 0x000000, got 0x%08X", addr)
+	}
+	if addr := run(NewCPU(CPU68020)); addr != 0x01000000 {
+		t.Errorf("Expected 68020 access at 0x01000000, got 0x%08X", addr)
+	}
+
+	cpu := NewCPU(CPU68000)
+	cpu.SetAddressMask(0xFFFFFFFF)
+	if addr := run(cpu); addr != 0x01000000 {
+		t.Errorf("Expected unmasked access at 0x01000000, got 0x%08X", addr)
+	}
+
+	cpu.SetCPUType(CPU68EC020)
+	if mask := cpu.AddressMask(); mask != 0x00FFFFFF {
+		t.Errorf("Expected 68EC020 address mask 0x00FFFFFF, got 0x%08X", mask)
+	}
+}
+
+// TestStopAndHaltState tests IsStopped, IsHalted and Resume
+func TestStopAndHaltState(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+	mem.Write32((VectorAutovector+3)*4, 0x00000600)
+
+	// STOP #$2000 = 0x4E72 0x2000
+	mem.Write16(0x400, 0x4E72)
+	mem.Write16(0x402, 0x2000)
+	mem.Write16(0x600, 0x4E71)
+	mem.Write16(0x602, 0x4E71)
+
+	cpu.Reset()
+	cpu.Execute(100)
+
+	if !cpu.IsStopped() {
+		t.Fatal("Expected CPU to be stopped after STOP")
+	}
+	if cycles := cpu.Execute(100); cycles != 100 {
+		t.Errorf("Expected a stopped CPU to idle for the timeslice, got %d cycles", cycles)
+	}
+
+	// An interrupt above the mask resumes execution in the handler
+	cpu.SetIRQ(3)
+	cpu.Step()
+	if cpu.IsStopped() {
+		t.Error("Expected the interrupt to clear the stopped state")
+	}
+	if cpu.pc != 0x602 {
+		t.Errorf("Expected PC = 0x602 after the handler's first instruction, got 0x%08X", cpu.pc)
+	}
+	if ret := mem.Read32(cpu.a[7] + 2); ret != 0x404 {
+		t.Errorf("Expected stacked PC = 0x404, got 0x%08X", ret)
+	}
+
+	cpu.SetIRQ(0)
+	cpu.PulseHalt()
+	if !cpu.IsHalted() {
+		t.Error("Expected CPU to be halted after PulseHalt")
+	}
+	cpu.Resume()
+	if cpu.IsHalted() {
+		t.Error("Expected Resume to clear the halted state")
+	}
+	cpu.Step()
+	if cpu.pc != 0x604 {
+		t.Errorf("Expected execution to continue at 0x604, got 0x%08X", cpu.pc)
+	}
+}
+
+// TestStopReason tests that Execute records why it returned
+func TestStopReason(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+	mem.Write32(VectorIllegal*4, 0x00000600)
+
+	mem.Write16(0x400, 0x4E71) // NOP
+	mem.Write16(0x402, 0x4E71) // NOP
+	mem.Write16(0x404, 0x4AFC) // ILLEGAL
+	mem.Write16(0x600, 0x4E72) // STOP #$2000
+	mem.Write16(0x602, 0x2000)
+
+	cpu.Reset()
+	cpu.AddBreakpoint(0x402)
+
+	cpu.Execute(4)
+	if r := cpu.StopReason(); r != StopBudget {
+		t.Errorf("Expected Budget, got %v", r)
+	}
+	cpu.Execute(100)
+	if r := cpu.StopReason(); r != StopBreakpoint {
+		t.Errorf("Expected Breakpoint, got %v", r)
+	}
+
+	cpu.SetExceptionBreak(true)
+	cpu.Execute(100)
+	if r := cpu.StopReason(); r != StopException || cpu.pc != 0x600 {
+		t.Errorf("Expected Exception at 0x600, got %v at 0x%08X", r, cpu.pc)
+	}
+
+	cpu.Execute(100)
+	if r := cpu.StopReason(); r != StopStopped {
+		t.Errorf("Expected Stopped, got %v", r)
+	}
+
+	cpu.PulseHalt()
+	cpu.Execute(100)
+	if r := cpu.StopReason(); r != StopHalted {
+		t.Errorf("Expected Halted, got %v", r)
+	}
+}
+
+// TestStepAndPeek tests single-stepping with a look at the next instruction
+func TestStepAndPeek(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	mem.Write16(0x400, 0x0640) // ADDI.W #$1234,D0
+	mem.Write16(0x402, 0x1234)
+	mem.Write16(0x404, 0x4E71) // NOP
+
+	cpu.Reset()
+
+	text, size := cpu.PeekInstruction()
+	if text != "ADDI.W\t#$1234,D0" || size != 4 {
+		t.Errorf("Expected ADDI.W #$1234,D0 of 4 bytes, got %q of %d", text, size)
+	}
+	if cpu.pc != 0x400 {
+		t.Errorf("Expected PeekInstruction to leave PC at 0x400, got 0x%08X", cpu.pc)
+	}
+
+	if cycles := cpu.Step(); cycles != 8 {
+		t.Errorf("Expected Step to report 8 cycles for ADDI.W, got %d", cycles)
+	}
+	if cpu.pc != 0x400+uint32(size) || cpu.d[0] != 0x1234 {
+		t.Errorf("Expected PC 0x404 and D0 0x1234 after Step, got 0x%08X and 0x%08X", cpu.pc, cpu.d[0])
+	}
+}
+
+// TestStepN tests stepping by instructions and stopping at a STOP
+func TestStepN(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	for addr := uint32(0x400); addr < 0x408; addr += 2 {
+		mem.Write16(addr, 0x4E71) // NOP
+	}
+	mem.Write16(0x408, 0x4E72) // STOP #$2700
+	mem.Write16(0x40A, 0x2700)
+
+	cpu.Reset()
+
+	if cycles := cpu.StepN(3); cycles != 12 {
+		t.Errorf("Expected 12 cycles for 3 NOPs, got %d", cycles)
+	}
+	if cpu.pc != 0x406 {
+		t.Errorf("Expected PC = 0x406, got 0x%08X", cpu.pc)
+	}
+
+	cpu.StepN(10)
+	if cpu.pc != 0x40C || cpu.StopReason() != StopStopped {
+		t.Errorf("Expected to stop at the STOP with PC 0x40C, got %v at 0x%08X", cpu.StopReason(), cpu.pc)
+	}
+
+	// An instruction aborted by an address error does not count
+	mem.Write32(VectorAddressError*4, 0x00000600)
+	for addr := uint32(0x600); addr < 0x608; addr += 2 {
+		mem.Write16(addr, 0x4E71) // NOP
+	}
+	mem.Write16(0x400, 0x3010) // MOVE.W (A0),D0
+	cpu.Reset()
+	cpu.a[0] = 0x2001
+	cpu.StepN(3)
+	if cpu.pc != 0x606 {
+		t.Errorf("Expected 3 NOPs in the address error handler, got PC = 0x%08X", cpu.pc)
+	}
+
+	// Without memory nothing can run, so StepN returns at once
+	cpu = NewCPU(CPU68000)
+	if cycles := cpu.StepN(1); cycles != 0 || cpu.StopReason() != StopNoMemory {
+		t.Errorf("Expected StepN to return 0 cycles with StopNoMemory, got %d and %v", cycles, cpu.StopReason())
+	}
+}
+
+// TestCCRAccess tests that the CCR accessors leave the system byte intact
+func TestCCRAccess(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	cpu.SetSR(0x2700)
+
+	cpu.SetCCR(0xFF)
+	if got := cpu.GetSR(); got != 0x271F {
+		t.Errorf("Expected SR = 0x271F, got 0x%04X", got)
+	}
+	if got := cpu.GetCCR(); got != 0x1F {
+		t.Errorf("Expected CCR = 0x1F, got 0x%02X", got)
+	}
+
+	cpu.SetRegister(RegCCR, FlagZ|FlagC)
+	if got := cpu.GetSR(); got != 0x2700|FlagZ|FlagC {
+		t.Errorf("Expected SR = 0x%04X, got 0x%04X", 0x2700|FlagZ|FlagC, got)
+	}
+	if got := cpu.GetRegister(RegCCR); got != FlagZ|FlagC {
+		t.Errorf("Expected RegCCR = 0x%02X, got 0x%02X", FlagZ|FlagC, got)
+	}
+}
+
+func TestResetPeripherals(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	cpu.Reset()
+
+	resets := 0
+	cpu.SetResetCallback(func() { resets++ })
+
+	cpu.d[0] = 0x12345678
+	cpu.a[7] = 0x0800
+	cpu.pc = 0x2000
+	cpu.SetSR(0x2015)
+	before := cpu.GetContext()
+
+	cpu.ResetPeripherals()
+
+	if resets != 1 {
+		t.Errorf("Expected reset callback to be called once, got %d", resets)
+	}
+	if after := cpu.GetContext(); *after != *before {
+		t.Errorf("Expected CPU state unchanged, got PC 0x%08X SR 0x%04X D0 0x%08X",
+			cpu.pc, cpu.sr, cpu.d[0])
+	}
+}
+
+func TestPrefetchQueue(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x7001) // MOVEQ #1,D0
+	memory.Write16(0x402, 0x33FC) // MOVE.W #$4E71,$0000040A
+	memory.Write16(0x404, 0x4E71)
+	memory.Write32(0x406, 0x0000040A)
+	memory.Write16(0x40A, 0x7403) // MOVEQ #3,D2
+	memory.Write16(0x40C, 0x4E71) // NOP
+
+	cpu.Reset()
+
+	cpu.Step()
+	if got := cpu.GetRegister(RegPrefAddr); got != 0x402 {
+		t.Errorf("Expected prefetch address 0x402, got 0x%08X", got)
+	}
+	if got := cpu.GetRegister(RegPrefData); got != 0x33FC4E71 {
+		t.Errorf("Expected prefetch data 0x33FC4E71, got 0x%08X", got)
+	}
+
+	// The MOVE overwrites the instruction after it, which has already been
+	// prefetched, so the old MOVEQ still runs
+	cpu.AddBreakpoint(0x40C)
+	cpu.Execute(1000)
+	if got := memory.Read16(0x40A); got != 0x4E71 {
+		t.Errorf("Expected 0x40A patched to NOP, got 0x%04X", got)
+	}
+	if cpu.d[2] != 3 {
+		t.Errorf("Expected the prefetched MOVEQ #3,D2 to run, got D2 = %d", cpu.d[2])
+	}
+	if got := cpu.GetRegister(RegPrefAddr); got != 0x40C {
+		t.Errorf("Expected prefetch address 0x40C, got 0x%08X", got)
+	}
+	if got := cpu.GetRegister(RegPrefData); got != 0x4E710000 {
+		t.Errorf("Expected prefetch data 0x4E710000, got 0x%08X", got)
+	}
+
+	// The queue carries over to the next timeslice: a write the CPU cannot
+	// see is not picked up, but a poke into the queued words is
+	memory.Write16(0x40C, 0x7605) // MOVEQ #5,D3
+	cpu.Step()
+	if cpu.d[3] != 0 || cpu.pc != 0x40E {
+		t.Errorf("Expected the queued NOP to run, got D3 = %d, PC = 0x%08X", cpu.d[3], cpu.pc)
+	}
+	cpu.Poke16(0x40E, 0x7605)
+	cpu.Step()
+	if cpu.d[3] != 5 {
+		t.Errorf("Expected the poked MOVEQ #5,D3 to run, got D3 = %d", cpu.d[3])
+	}
+}
+
+func TestCycleCarry(t *testing.T) {
+	newLoopCPU := func() *CPU {
+		cpu := NewCPU(CPU68000)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write16(0x400, 0x7201) // loop: MOVEQ #1,D1
+		memory.Write16(0x402, 0x4E70) // RESET
+		memory.Write16(0x404, 0x60FA) // BRA.S loop
+
+		cpu.Reset()
+		return cpu
+	}
+
+	// Reference: the cost of each instruction, one at a time
+	ref := newLoopCPU()
+	var costs []int
+	for i := 0; i < 1000; i++ {
+		costs = append(costs, ref.Step())
+	}
+
+	// Short timeslices with the overshoot carried over, by default
+	cpu := newLoopCPU()
+	executed := 0
+	cpu.SetInstrHookCallback(func(pc uint32) { executed++ })
+
+	const slice, slices = 10, 1000
+	total := 0
+	for i := 0; i < slices; i++ {
+		total += cpu.Execute(slice)
+	}
+
+	want := 0
+	for _, c := range costs[:executed] {
+		want += c
+	}
+	if total != want {
+		t.Errorf("Expected %d cycles for %d instructions, got %d", want, executed, total)
+	}
+	if over := total - slice*slices; over < 0 || over >= 132 {
+		t.Errorf("Expected total within one instruction of the %d cycles requested, got %d", slice*slices, total)
+	}
+	if cpu.overshoot != total-slice*slices {
+		t.Errorf("Expected pending overshoot %d, got %d", total-slice*slices, cpu.overshoot)
+	}
+
+	// Stepping leaves the pending overshoot alone
+	pending := cpu.overshoot
+	cpu.Step()
+	if cpu.overshoot != pending {
+		t.Errorf("Expected Step to leave overshoot %d pending, got %d", pending, cpu.overshoot)
+	}
+
+	// Without carry every call runs at least one instruction
+	cpu = newLoopCPU()
+	cpu.SetCycleCarry(false)
+	total = 0
+	for i := 0; i < slices; i++ {
+		total += cpu.Execute(slice)
+	}
+	if total <= slice*slices+132 {
+		t.Errorf("Expected overshoot to accumulate without carry, got %d cycles", total)
+	}
+}
+
+func TestRegisterFile(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	cpu.Reset()
+
+	regs := cpu.GetRegisters()
+	if regs.A[7] != 0x1000 || regs.ISP != 0x1000 || regs.PC != 0x400 || regs.SR != 0x2700 {
+		t.Errorf("Unexpected registers after reset: %+v", regs)
+	}
+
+	regs.D[3] = 0xDEADBEEF
+	regs.A[2] = 0x2000
+	regs.A[7] = 0x0F00
+	regs.ISP = 0x0F00
+	regs.USP = 0x8000
+	regs.PC = 0x600
+	regs.SR = 0x2004
+	regs.VBR = 0x10000
+	cpu.SetRegisters(regs)
+
+	if cpu.GetRegister(RegD3) != 0xDEADBEEF || cpu.GetRegister(RegA2) != 0x2000 {
+		t.Errorf("Expected D3/A2 to be set, got 0x%08X/0x%08X", cpu.GetRegister(RegD3), cpu.GetRegister(RegA2))
+	}
+	if cpu.GetRegister(RegISP) != 0x0F00 || cpu.GetRegister(RegUSP) != 0x8000 {
+		t.Errorf("Expected ISP 0x0F00 and USP 0x8000, got 0x%08X and 0x%08X",
+			cpu.GetRegister(RegISP), cpu.GetRegister(RegUSP))
+	}
+	if cpu.GetPC() != 0x600 || cpu.GetSR() != 0x2004 || cpu.GetRegister(RegVBR) != 0x10000 {
+		t.Errorf("Expected PC/SR/VBR to be set, got 0x%08X/0x%04X/0x%08X",
+			cpu.GetPC(), cpu.GetSR(), cpu.GetRegister(RegVBR))
+	}
+
+	if got := cpu.GetRegisters(); got != regs {
+		t.Errorf("Round trip mismatch:\n got %+v\nwant %+v", got, regs)
+	}
+
+	// Switching to user mode makes USP the active stack pointer
+	cpu.SetSR(0x0000)
+	if got := cpu.GetRegisters(); got.A[7] != 0x8000 || got.ISP != 0x0F00 {
+		t.Errorf("Expected A7 = USP 0x8000 and ISP 0x0F00 in user mode, got 0x%08X and 0x%08X", got.A[7], got.ISP)
+	}
+}
+
+func TestResetVectorBase(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	ram := NewRAM(8 * 1024 * 1024)
+	cpu.SetMemoryHandler(ram)
+
+	ram.Write32(0, 0x00001000)
+	ram.Write32(4, 0x00000400)
+	ram.Write32(0x400000, 0x00002000)
+	ram.Write32(0x400004, 0x00400008)
+
+	cpu.SetResetVectorBase(0x400000)
+	cpu.Reset()
+	if cpu.a[7] != 0x2000 || cpu.pc != 0x400008 {
+		t.Errorf("Expected SSP 0x2000 and PC 0x400008 from the ROM overlay, got 0x%08X and 0x%08X", cpu.a[7], cpu.pc)
+	}
+
+	cpu.SetResetVectorBase(0)
+	cpu.Reset()
+	if cpu.a[7] != 0x1000 || cpu.pc != 0x400 {
+		t.Errorf("Expected SSP 0x1000 and PC 0x400 from address 0, got 0x%08X and 0x%08X", cpu.a[7], cpu.pc)
+	}
+}
+
+func TestResetInterruptStackPointer(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32((VectorTrap+1)*4, 0x00000600)
+
+	memory.Write16(0x400, 0x4E41) // TRAP #1
+
+	cpu.Reset()
+	if cpu.isp != 0x1000 {
+		t.Errorf("Expected ISP = 0x00001000 after reset, got 0x%08X", cpu.isp)
+	}
+	// A saved context reports the reset SSP as the ISP
+	data, err := json.Marshal(cpu.GetContext())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"isp":4096`) {
+		t.Errorf("Expected ISP 0x1000 in the context, got %s", data)
+	}
+
+	// Drop to user mode with its own stack
+	cpu.SetSR(0x0000)
+	cpu.SetRegister(RegA7, 0x8000)
+
+	cpu.Step()
+	if cpu.pc != 0x600 {
+		t.Fatalf("Expected TRAP #1 handler at 0x600, got PC 0x%08X", cpu.pc)
+	}
+	// Format 0 frame: SR, PC, format/vector
+	if cpu.a[7] != 0x1000-8 {
+		t.Errorf("Expected the frame on the reset SSP at 0x%08X, got SP 0x%08X", 0x1000-8, cpu.a[7])
+	}
+	if cpu.usp != 0x8000 {
+		t.Errorf("Expected USP = 0x00008000, got 0x%08X", cpu.usp)
+	}
+}
+
+func TestResetColdNoVectors(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	// The vector table is deliberately left empty
+	memory.Write16(0x2000, 0x7005) // MOVEQ #5,D0
+
+	cpu.SetPC(0x2000)
+	cpu.SetRegister(RegA7, 0x8000)
+	cpu.SetRegister(RegD3, 0x1234)
+	cpu.SetSR(0x0000)
+
+	cpu.ResetColdNoVectors()
+	if cpu.pc != 0x2000 {
+		t.Errorf("Expected PC to stay at 0x2000, got 0x%08X", cpu.pc)
+	}
+	if cpu.a[7] != 0x8000 {
+		t.Errorf("Expected A7 to stay at 0x8000, got 0x%08X", cpu.a[7])
+	}
+	if cpu.d[3] != 0 || cpu.sr != 0x2700 {
+		t.Errorf("Expected D3 cleared and SR = 0x2700, got D3 0x%08X SR 0x%04X", cpu.d[3], cpu.sr)
+	}
+
+	cpu.Step()
+	if cpu.d[0] != 5 || cpu.pc != 0x2002 {
+		t.Errorf("Expected MOVEQ to run from 0x2000, got D0 %d PC 0x%08X", cpu.d[0], cpu.pc)
+	}
+}
+
+func TestInstrDecodedHook(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+
+	memory.Write16(0x400, 0x7005) // MOVEQ #5,D0
+	memory.Write16(0x402, 0xD280) // ADD.L D0,D1
+	memory.Write16(0x404, 0x4E71) // NOP
+
+	cpu.Reset()
+
+	var mnemonics []string
+	var pcs []uint32
+	cpu.SetInstrDecodedHook(func(pc uint32, opcode uint16, mnemonic string) {
+		if opcode != memory.Read16(pc) {
+			t.Errorf("Opcode 0x%04X does not match memory at 0x%08X", opcode, pc)
+		}
+		if pc == 0x402 && cpu.d[0] != 5 {
+			t.Error("Expected the hook to run after MOVEQ executed")
+		}
+		mnemonics = append(mnemonics, mnemonic)
+		pcs = append(pcs, pc)
+	})
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	want := []string{"MOVEQ", "ADD", "NOP"}
+	if fmt.Sprint(mnemonics) != fmt.Sprint(want) {
+		t.Errorf("Expected mnemonics %v, got %v", want, mnemonics)
+	}
+	if fmt.Sprint(pcs) != fmt.Sprint([]uint32{0x400, 0x402, 0x404}) {
+		t.Errorf("Expected PCs 0x400, 0x402, 0x404, got %x", pcs)
+	}
+
+	cpu.SetInstrDecodedHook(nil)
+	cpu.Step()
+}
+
+func TestIllegalInstrCallback(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorIllegal*4, 0x00000800)
+
+	memory.Write16(0x400, 0x4AFC) // ILLEGAL, emulated by the host
+	memory.Write16(0x402, 0x7001) // MOVEQ #1,D0
+	memory.Write16(0x404, 0x4AFC) // ILLEGAL, declined by the host
+
+	cpu.Reset()
+
+	var seen []uint32
+	cpu.SetIllegalInstrCallback(func(opcode uint16) bool {
+		seen = append(seen, cpu.GetRegister(RegPPC))
+		if opcode != 0x4AFC || cpu.GetRegister(RegPPC) != 0x400 {
+			return false
+		}
+		cpu.SetRegister(RegD1, 0x1234)
+		return true
+	})
+
+	cpu.Step()
+	if cpu.pc != 0x402 || cpu.d[1] != 0x1234 {
+		t.Errorf("Expected emulated ILLEGAL to continue at 0x402 with D1 = 0x1234, got PC 0x%08X D1 0x%08X", cpu.pc, cpu.d[1])
+	}
+	if cpu.a[7] != 0x1000 {
+		t.Errorf("Expected no exception frame, got SP 0x%08X", cpu.a[7])
+	}
+
+	cpu.Step()
+	if cpu.d[0] != 1 {
+		t.Errorf("Expected MOVEQ to run after the emulated opcode, got D0 = %d", cpu.d[0])
+	}
+
+	cpu.Step()
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected declined ILLEGAL to trap to 0x800, got PC 0x%08X", cpu.pc)
+	}
+	if len(seen) != 2 || seen[0] != 0x400 || seen[1] != 0x404 {
+		t.Errorf("Expected callback at 0x400 and 0x404, got %v", seen)
+	}
+}
+
+func TestBKPT(t *testing.T) {
+	cpu := NewCPU(CPU68010)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorIllegal*4, 0x00000800)
+
+	memory.Write16(0x400, 0x484B) // BKPT #3
+
+	cpu.Reset()
+
+	acked := -1
+	cpu.SetBkptAckCallback(func(data uint32) {
+		acked = int(data)
+	})
+
+	cpu.Step()
+	if acked != 3 {
+		t.Errorf("Expected breakpoint acknowledge with 3, got %d", acked)
+	}
+	if cpu.pc != 0x800 {
+		t.Errorf("Expected unhandled BKPT to trap to 0x800, got PC 0x%08X", cpu.pc)
+	}
+
+	// The 68000 has no BKPT and never acknowledges
+	cpu.SetCPUType(CPU68000)
+	cpu.Reset()
+	acked = -1
+	cpu.Step()
+	if acked != -1 || cpu.pc != 0x800 {
+		t.Errorf("Expected 68000 BKPT to trap without acknowledge, got ack %d PC 0x%08X", acked, cpu.pc)
+	}
+}
+
+func TestExceptionCallback(t *testing.T) {
+	for _, cpuType := range []CPUType{CPU68000, CPU68010} {
+		cpu := NewCPU(cpuType)
+		memory := &SimpleMemory{}
+		cpu.SetMemoryHandler(memory)
+
+		memory.Write32(0, 0x00001000)
+		memory.Write32(4, 0x00000400)
+		memory.Write32((VectorTrap+2)*4, 0x00000600)
+
+		memory.Write16(0x400, 0x4E42) // TRAP #2
+		memory.Write16(0x402, 0x4E71) // NOP
+		memory.Write16(0x600, 0x4E73) // RTE
+
+		cpu.Reset()
+
+		type event struct {
+			vector   uint32
+			entering bool
+		}
+		var events []event
+		cpu.SetExceptionCallback(func(vector uint32, entering bool) {
+			events = append(events, event{vector, entering})
+		})
+
+		cpu.Step()
+		cpu.Step()
+		cpu.Step()
+
+		want := []event{{VectorTrap + 2, true}, {VectorTrap + 2, false}}
+		if len(events) != 2 || events[0] != want[0] || events[1] != want[1] {
+			t.Errorf("%v: expected events %v, got %v", cpuType, want, events)
+		}
+		if cpu.pc != 0x404 {
+			t.Errorf("%v: expected PC = 0x404 after the NOP, got 0x%08X", cpuType, cpu.pc)
+		}
+	}
+}
+
+func TestLastException(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write32(VectorIllegal*4, 0x00000800)
+
+	memory.Write16(0x400, 0x4E71) // NOP
+	memory.Write16(0x402, 0x4AFC) // ILLEGAL
+
+	cpu.Reset()
+	if _, _, _, ok := cpu.LastException(); ok {
+		t.Error("Expected no exception after reset")
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	vector, faultPC, faultIR, ok := cpu.LastException()
+	if !ok {
+		t.Fatal("Expected an exception to be reported")
+	}
+	if vector != VectorIllegal || faultPC != 0x402 || faultIR != 0x4AFC {
+		t.Errorf("Expected vector %d at 0x402 (0x4AFC), got %d at 0x%08X (0x%04X)",
+			VectorIllegal, vector, faultPC, faultIR)
+	}
+}
+
+// Example test showing basic usage
+func ExampleCPU() {
+	// Create a new 68000 CPU
+	cpu := NewCPU(CPU68000)
+
+	// Create simple memory
+	memory := &SimpleMemory{}
+
+	// Set up initial vectors
+	memory.Write32(0, 0x00001000) // Stack pointer
+	memory.Write32(4, 0x00000400) // Program counter
+
+	// Set memory handler
+	cpu.SetMemoryHandler(memory)
+
+	// Reset CPU
+	cpu.Reset()
+
+	// Execute instructions
+	cpu.Execute(1000)
+}
+
+// TestExecuteCheckedFault tests that an odd long read is returned to the
+// host as a *MemoryFault in FaultModeGo, with the faulting instruction
+// undone, and taken by the guest otherwise
+func TestExecuteCheckedFault(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &SimpleMemory{}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+	mem.Write32(VectorAddressError*4, 0x00000600)
+	mem.Write32(VectorTrace*4, 0x00000700)
+
+	// MOVE.L (A0)+,D0
+	mem.Write16(0x400, 0x2018)
+
+	cpu.Reset()
+	cpu.SetFaultMode(FaultModeGo)
+	cpu.a[0] = 0x2001
+	cpu.d[0] = 0x12345678
+	cpu.SetSR(0xA700 | FlagN) // Traced
+
+	_, err := cpu.ExecuteChecked(100)
+	fault, ok := err.(*MemoryFault)
+	if !ok {
+		t.Fatalf("Expected a *MemoryFault, got %v", err)
+	}
+	if fault.Vector != VectorAddressError || fault.Address != 0x2001 || fault.Write || fault.PC != 0x400 {
+		t.Errorf("Unexpected fault %+v", fault)
+	}
+	if r := cpu.StopReason(); r != StopFault {
+		t.Errorf("Expected Fault, got %v", r)
+	}
+	if cpu.d[0] != 0x12345678 || cpu.a[0] != 0x2001 {
+		t.Errorf("Expected D0 and A0 untouched, got D0 0x%08X A0 0x%08X", cpu.d[0], cpu.a[0])
+	}
+	if cpu.sr != 0xA700|FlagN {
+		t.Errorf("Expected SR untouched and no trace, got 0x%04X", cpu.sr)
+	}
+	if cpu.pc != 0x400 || cpu.a[7] != 0x1000 {
+		t.Errorf("Expected PC 0x400 and SP 0x1000 for a retry, got PC 0x%08X SP 0x%08X", cpu.pc, cpu.a[7])
+	}
+
+	// Once the cause is fixed the instruction runs normally
+	cpu.a[0] = 0x2000
+	mem.Write32(0x2000, 0xCAFEBABE)
+	cpu.SetSR(0x2700)
+	if _, err := cpu.ExecuteChecked(1); err != nil || cpu.d[0] != 0xCAFEBABE {
+		t.Errorf("Expected the retried MOVE to load 0xCAFEBABE, got 0x%08X, %v", cpu.d[0], err)
+	}
+
+	// The same access in the default mode goes to the guest's handler
+	cpu.Reset()
+	cpu.SetFaultMode(FaultModeGuest)
+	cpu.a[0] = 0x2001
+	_, err = cpu.ExecuteChecked(1)
+	if err != nil || cpu.pc != 0x600 {
+		t.Errorf("Expected address error handler at 0x600 and no error, got PC 0x%08X, %v", cpu.pc, err)
+	}
+}
+
+// TestExecuteCheckedPartialWrite tests a bus error partway through a
+// MOVEM in FaultModeGo: registers and PC are restored, but the write made
+// before the fault stays in memory
+func TestExecuteCheckedPartialWrite(t *testing.T) {
+	cpu := NewCPU(CPU68000)
+	mem := &berrMemory{cpu: cpu}
+	cpu.SetMemoryHandler(mem)
+
+	mem.Write32(0, 0x00001000)
+	mem.Write32(4, 0x00000400)
+
+	// MOVEM.L D0-D1,(A0)
+	mem.Write16(0x400, 0x48D0)
+	mem.Write16(0x402, 0x0003)
+
+	cpu.Reset()
+	cpu.SetFaultMode(FaultModeGo)
+	cpu.d[0] = 0x11111111
+	cpu.d[1] = 0x22222222
+	cpu.a[0] = 0x0FFFFC // D1 goes to 0x100000, which faults
+
+	_, err := cpu.ExecuteChecked(100)
+	fault, ok := err.(*MemoryFault)
+	if !ok {
+		t.Fatalf("Expected a *MemoryFault, got %v", err)
+	}
+	if fault.Vector != VectorBusError || fault.Address != 0x100000 || !fault.Write || fault.PC != 0x400 {
+		t.Errorf("Unexpected fault %+v", fault)
+	}
+	if cpu.pc != 0x400 || cpu.a[0] != 0x0FFFFC {
+		t.Errorf("Expected PC 0x400 and A0 0x0FFFFC for a retry, got PC 0x%08X A0 0x%08X", cpu.pc, cpu.a[0])
+	}
+	if got := mem.Read32(0x0FFFFC); got != 0x11111111 {
+		t.Errorf("Expected D0 already written at 0x0FFFFC, got 0x%08X", got)
+	}
+}
+
+// TestAddressErrorAbortsInstruction tests that an address error ends the
+// instruction, which makes no further accesses
+func TestAddressErrorAbortsInstruction(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+	}{
+		{"MOVE.L (A0),(A1)", 0x2290},
+		{"ADD.L D0,(A0)", 0xD190},
+	}
+
+	for _, tt := range tests {
+		cpu := NewCPU(CPU68000)
+		mem := &SimpleMemory{}
+		cpu.SetMemoryHandler(mem)
+
+		mem.Write32(0, 0x00001000)
+		mem.Write32(4, 0x00000400)
+		mem.Write32(VectorAddressError*4, 0x00000600)
+		mem.Write16(0x400, tt.opcode)
+		mem.Write32(0x3000, 0x11111111)
+
+		cpu.Reset()
+		cpu.a[0] = 0x2001
+		cpu.a[1] = 0x3000
+		cpu.Step()
+
+		if cpu.pc != 0x600 {
+			t.Errorf("%s: expected address error handler at 0x600, got PC 0x%08X", tt.name, cpu.pc)
+		}
+		if cpu.a[7] != 0x1000-14 {
+			t.Errorf("%s: expected one 14-byte frame, got SP 0x%08X", tt.name, cpu.a[7])
+		}
+		if got := mem.Read32(0x3000); got != 0x11111111 {
+			t.Errorf("%s: expected (A1) untouched, got 0x%08X", tt.name, got)
+		}
+	}
 }
@@ -2,347 +2,477 @@ package musashi
 
 // opcodes.go - Opcode dispatch table and decoder
 
-// decodeAndExecute decodes and executes a single instruction
+import (
+	"math/bits"
+	"reflect"
+)
+
+// opHandler executes one decoded instruction
+type opHandler func(cpu *CPU, opcode uint16)
+
+// opcodeTable maps every opcode to its handler. It is built once from the
+// decoder below so that dispatch is a single indexed call.
+var opcodeTable [0x10000]opHandler
+
+func init() {
+	for i := range opcodeTable {
+		opcodeTable[i] = decode(uint16(i))
+	}
+}
+
+// Opcode coverage classes reported by CoverageReport
+const (
+	CoverageImplemented = "implemented" // Decodes to a working handler
+	CoverageStub        = "stub"        // Decodes to a placeholder that only consumes cycles
+	CoverageIllegal     = "illegal"     // Decodes to the illegal instruction handler
+)
+
+// stubHandlers lists the placeholder handlers that do not yet emulate
+// their instruction
+var stubHandlers = []opHandler{
+	(*CPU).opNBCD, (*CPU).opCHK, (*CPU).opDIVU, (*CPU).opSBCD,
+	(*CPU).opCMPM, (*CPU).opABCD, (*CPU).opShiftMem,
+	(*CPU).opShiftReg, (*CPU).opBitDynamic, (*CPU).opBitStatic, (*CPU).opMOVEP,
+}
+
+// OpcodeCoverage classifies an opcode by the handler the decoder assigns
+// it. The decoder is shared by all CPU types, so an opcode reported as
+// implemented may still be illegal on some of them.
+func OpcodeCoverage(opcode uint16) string {
+	h := reflect.ValueOf(opcodeTable[opcode]).Pointer()
+	if h == reflect.ValueOf((*CPU).opIllegal).Pointer() {
+		return CoverageIllegal
+	}
+	for _, stub := range stubHandlers {
+		if h == reflect.ValueOf(stub).Pointer() {
+			return CoverageStub
+		}
+	}
+	return CoverageImplemented
+}
+
+// CoverageReport counts the 65536 opcodes in each coverage class
+func CoverageReport() map[string]int {
+	report := map[string]int{
+		CoverageImplemented: 0,
+		CoverageStub:        0,
+		CoverageIllegal:     0,
+	}
+	for op := 0; op < 0x10000; op++ {
+		report[OpcodeCoverage(uint16(op))]++
+	}
+	return report
+}
+
+// decodeAndExecute executes a single instruction
 func (cpu *CPU) decodeAndExecute(opcode uint16) {
-	// Decode based on top 4 bits and dispatch
+	opcodeTable[opcode](cpu, opcode)
+}
+
+// decode returns the handler for an opcode
+func decode(opcode uint16) opHandler {
+	// Decode based on top 4 bits
 	switch opcode >> 12 {
 	case 0x0:
-		cpu.decode0(opcode)
+		return decode0(opcode)
 	case 0x1, 0x2, 0x3:
-		cpu.decodeMOVE(opcode)
+		return decodeMOVE(opcode)
 	case 0x4:
-		cpu.decode4(opcode)
+		return decode4(opcode)
 	case 0x5:
-		cpu.decode5(opcode)
+		return decode5(opcode)
 	case 0x6:
-		cpu.decode6(opcode)
+		return decode6(opcode)
 	case 0x7:
-		cpu.decodeMOVEQ(opcode)
+		return decodeMOVEQ(opcode)
 	case 0x8:
-		cpu.decode8(opcode)
+		return decode8(opcode)
 	case 0x9, 0xD:
-		cpu.decode9D(opcode)
+		return decode9D(opcode)
 	case 0xB:
-		cpu.decodeB(opcode)
+		return decodeB(opcode)
 	case 0xC:
-		cpu.decodeC(opcode)
+		return decodeC(opcode)
 	case 0xE:
-		cpu.decodeE(opcode)
+		return decodeE(opcode)
+	case 0xF:
+		return decodeF(opcode)
 	default:
-		cpu.opIllegal(opcode)
+		return (*CPU).opIllegal
 	}
 }
 
 // decode0 handles opcodes starting with 0x0
-func (cpu *CPU) decode0(opcode uint16) {
-	if opcode&0x0100 == 0 {
-		// Bit 8 = 0
-		switch (opcode >> 6) & 0x03 {
-		case 0: // ORI, ANDI, SUBI, ADDI, EORI, CMPI
-			switch (opcode >> 9) & 0x07 {
-			case 0: // ORI
-				if opcode&0x003F == 0x003C { // to SR
-					cpu.opORItoCCR(opcode)
-				} else {
-					cpu.opORI(opcode)
-				}
-			case 1: // ANDI
-				if opcode&0x003F == 0x003C { // to SR
-					cpu.opANDItoCCR(opcode)
-				} else {
-					cpu.opANDI(opcode)
-				}
-			case 2: // SUBI
-				cpu.opSUBI(opcode)
-			case 3: // ADDI
-				cpu.opADDI(opcode)
-			case 5: // EORI
-				if opcode&0x003F == 0x003C { // to SR
-					cpu.opEORItoCCR(opcode)
-				} else {
-					cpu.opEORI(opcode)
-				}
-			case 6: // CMPI
-				cpu.opCMPI(opcode)
-			default:
-				cpu.opIllegal(opcode)
-			}
-		case 1: // BTST, BCHG, BCLR, BSET (dynamic)
-			cpu.opBitDynamic(opcode)
-		case 2: // BTST, BCHG, BCLR, BSET (static), MOVEP
-			if opcode&0x0138 == 0x0108 {
-				cpu.opMOVEP(opcode)
-			} else {
-				cpu.opBitStatic(opcode)
+func decode0(opcode uint16) opHandler {
+	if opcode&0xFF00 == 0x0E00 && opcode&0x00C0 != 0x00C0 {
+		return (*CPU).opMOVES
+	}
+
+	if opcode&0x0100 != 0 {
+		// Bit 8 = 1: BTST, BCHG, BCLR, BSET (dynamic), MOVEP
+		if opcode&0x0038 == 0x0008 {
+			return (*CPU).opMOVEP
+		}
+		return (*CPU).opBitDynamic
+	}
+
+	if (opcode>>9)&0x07 == 4 {
+		// BTST, BCHG, BCLR, BSET (static)
+		return (*CPU).opBitStatic
+	}
+
+	if (opcode>>6)&0x03 == 3 {
+		// Size field 3: CALLM, RTM, CAS, CAS2 (68020+)
+		if (opcode>>9)&0x07 >= 5 {
+			if opcode&0x003F == 0x003C {
+				return (*CPU).opCAS2
 			}
-		case 3: // BTST, BCHG, BCLR, BSET (static), MOVEP
-			if opcode&0x0138 == 0x0108 {
-				cpu.opMOVEP(opcode)
-			} else {
-				cpu.opBitStatic(opcode)
+			return (*CPU).opCAS
+		}
+		if (opcode>>9)&0x07 == 3 {
+			if opcode&0x0030 == 0 {
+				return (*CPU).opRTM
 			}
+			return (*CPU).opCALLM
 		}
-	} else {
-		// Bit 8 = 1
-		cpu.opIllegal(opcode)
+		return (*CPU).opIllegal
+	}
+
+	// ORI, ANDI, SUBI, ADDI, EORI, CMPI; bits 7-6 are the operand size
+	switch (opcode >> 9) & 0x07 {
+	case 0: // ORI
+		if opcode&0x003F == 0x003C { // to SR
+			return (*CPU).opORItoCCR
+		}
+		return (*CPU).opORI
+	case 1: // ANDI
+		if opcode&0x003F == 0x003C { // to SR
+			return (*CPU).opANDItoCCR
+		}
+		return (*CPU).opANDI
+	case 2: // SUBI
+		return (*CPU).opSUBI
+	case 3: // ADDI
+		return (*CPU).opADDI
+	case 5: // EORI
+		if opcode&0x003F == 0x003C { // to SR
+			return (*CPU).opEORItoCCR
+		}
+		return (*CPU).opEORI
+	case 6: // CMPI
+		return (*CPU).opCMPI
+	default:
+		return (*CPU).opIllegal
 	}
 }
 
 // decodeMOVE handles MOVE instructions
-func (cpu *CPU) decodeMOVE(opcode uint16) {
+func decodeMOVE(opcode uint16) opHandler {
 	// Check if it's MOVEA
 	destMode := (opcode >> 6) & 7
 	if destMode == 1 {
-		cpu.opMOVEA(opcode)
-	} else {
-		cpu.opMOVE(opcode)
+		return (*CPU).opMOVEA
 	}
+	return (*CPU).opMOVE
 }
 
 // decode4 handles opcodes starting with 0x4
-func (cpu *CPU) decode4(opcode uint16) {
+func decode4(opcode uint16) opHandler {
 	switch opcode {
 	case 0x4E70:
-		cpu.opRESET()
+		return (*CPU).opRESET
 	case 0x4E71:
-		cpu.opNOP()
+		return (*CPU).opNOP
 	case 0x4E72:
-		cpu.opSTOP()
+		return (*CPU).opSTOP
 	case 0x4E73:
-		cpu.opRTE()
+		return (*CPU).opRTE
+	case 0x4E74:
+		return (*CPU).opRTD
 	case 0x4E75:
-		cpu.opRTS()
+		return (*CPU).opRTS
 	case 0x4E76:
-		cpu.opTRAPV()
+		return (*CPU).opTRAPV
 	case 0x4E77:
-		cpu.opRTR()
+		return (*CPU).opRTR
+	case 0x4E7A, 0x4E7B:
+		return (*CPU).opMOVEC
+	case 0x4AFC: // ILLEGAL
+		return (*CPU).opIllegal
 	default:
+		switch {
+		case opcode&0xFFF8 == 0x4840:
+			return (*CPU).opSWAP
+		case opcode&0xFFF8 == 0x4848:
+			return (*CPU).opBKPT
+		case opcode&0xFFF8 == 0x4808:
+			return (*CPU).opLINKL
+		case opcode&0xFFF8 == 0x4E50:
+			return (*CPU).opLINK
+		case opcode&0xFFF8 == 0x4E58:
+			return (*CPU).opUNLK
+		case opcode&0xFFF0 == 0x4E40:
+			return (*CPU).opTRAP
+		case opcode&0xFFF0 == 0x4E60:
+			return (*CPU).opMOVEUSP
+		case opcode&0xFFB8 == 0x4880, opcode&0xFFF8 == 0x49C0:
+			return (*CPU).opEXT
+		case opcode&0xF900 == 0x4000 && opcode&0x00C0 != 0x00C0:
+			return [4]opHandler{(*CPU).opNEGX, (*CPU).opCLR, (*CPU).opNEG, (*CPU).opNOT}[(opcode>>9)&3]
+		case opcode&0xFF00 == 0x4A00 && opcode&0x00C0 != 0x00C0:
+			return (*CPU).opTST
+		case opcode&0xF1C0 == 0x41C0:
+			return (*CPU).opLEA
+		case opcode&0xFFC0 == 0x4840:
+			return (*CPU).opPEA
+		case opcode&0xFF80 == 0x4880:
+			return (*CPU).opMOVEMtoMem
+		case opcode&0xFF80 == 0x4C80:
+			return (*CPU).opMOVEMtoReg
+		case opcode&0xFFC0 == 0x40C0:
+			return (*CPU).opMOVEfromSR
+		case opcode&0xFFC0 == 0x42C0:
+			return (*CPU).opMOVEfromCCR
+		case opcode&0xFFC0 == 0x4E80:
+			return (*CPU).opJSR
+		case opcode&0xFFC0 == 0x4EC0:
+			return (*CPU).opJMP
+		}
+
 		switch (opcode >> 6) & 0x07 {
 		case 0: // NEGX, CLR, NEG, NOT
 			switch (opcode >> 9) & 0x07 {
 			case 0:
-				cpu.opNEGX(opcode)
+				return (*CPU).opNEGX
 			case 1:
-				cpu.opCLR(opcode)
+				return (*CPU).opCLR
 			case 2:
-				cpu.opNEG(opcode)
+				return (*CPU).opNEG
 			case 3:
-				cpu.opNOT(opcode)
+				return (*CPU).opNOT
 			default:
-				cpu.opIllegal(opcode)
+				return (*CPU).opIllegal
 			}
 		case 1: // NBCD, SWAP, PEA
 			switch (opcode >> 3) & 0x3F {
 			case 0x00, 0x01: // NBCD
-				cpu.opNBCD(opcode)
+				return (*CPU).opNBCD
 			case 0x08, 0x09: // SWAP, EXT
 				if opcode&0x0008 != 0 {
-					cpu.opSWAP(opcode)
-				} else {
-					cpu.opEXT(opcode)
+					return (*CPU).opSWAP
 				}
+				return (*CPU).opEXT
 			default:
 				if opcode&0x01C0 == 0x01C0 {
-					cpu.opPEA(opcode)
-				} else {
-					cpu.opIllegal(opcode)
+					return (*CPU).opPEA
 				}
+				return (*CPU).opIllegal
 			}
 		case 2: // MOVEM, EXT
 			if opcode&0x0800 != 0 {
-				cpu.opMOVEMtoMem(opcode)
+				return (*CPU).opMOVEMtoMem
 			} else if opcode&0x0B80 == 0x0880 {
-				cpu.opEXT(opcode)
-			} else {
-				cpu.opMOVEMtoReg(opcode)
+				return (*CPU).opEXT
 			}
+			return (*CPU).opMOVEMtoReg
 		case 3: // TST, TAS, ILLEGAL, TRAP, LINK, UNLK, MOVE USP
 			if opcode&0x0FC0 == 0x0AC0 {
-				cpu.opTAS(opcode)
+				return (*CPU).opTAS
 			} else if opcode&0x0B80 == 0x0880 {
-				cpu.opEXT(opcode)
+				return (*CPU).opEXT
 			} else if opcode&0x0F00 == 0x0E00 {
 				// TRAP, LINK, UNLK, MOVE USP
 				if opcode&0x0080 == 0 {
-					cpu.opLINK(opcode)
+					return (*CPU).opLINK
 				} else if opcode&0x0008 == 0 {
-					cpu.opUNLK(opcode)
-				} else {
-					cpu.opMOVEUSP(opcode)
+					return (*CPU).opUNLK
 				}
-			} else {
-				cpu.opTST(opcode)
+				return (*CPU).opMOVEUSP
 			}
+			return (*CPU).opTST
 		case 4, 6: // CHK, LEA
 			if opcode&0x01C0 == 0x01C0 {
-				cpu.opLEA(opcode)
-			} else {
-				cpu.opCHK(opcode)
+				return (*CPU).opLEA
 			}
+			return (*CPU).opCHK
 		case 5, 7: // ADDQ, SUBQ, Scc, DBcc
 			if opcode&0x00C0 == 0x00C0 {
 				if opcode&0x0038 == 0x0008 {
-					cpu.opDBcc(opcode)
-				} else {
-					cpu.opScc(opcode)
+					return (*CPU).opDBcc
 				}
+				return (*CPU).opScc
 			} else {
 				if opcode&0x0100 == 0 {
-					cpu.opADDQ(opcode)
-				} else {
-					cpu.opSUBQ(opcode)
+					return (*CPU).opADDQ
 				}
+				return (*CPU).opSUBQ
 			}
 		default:
 			if opcode&0x0FC0 == 0x04C0 {
-				cpu.opMOVEMtoReg(opcode)
+				return (*CPU).opMOVEMtoReg
 			} else if opcode&0x0B80 == 0x0080 {
-				cpu.opMOVEMtoMem(opcode)
+				return (*CPU).opMOVEMtoMem
 			} else if opcode&0x01C0 == 0x01C0 {
 				switch (opcode >> 9) & 0x07 {
 				case 4:
-					cpu.opJSR(opcode)
+					return (*CPU).opJSR
 				case 6:
-					cpu.opJMP(opcode)
+					return (*CPU).opJMP
 				default:
-					cpu.opIllegal(opcode)
+					return (*CPU).opIllegal
 				}
-			} else {
-				cpu.opIllegal(opcode)
 			}
+			return (*CPU).opIllegal
 		}
 	}
 }
 
-// decode5 handles ADDQ, SUBQ, Scc, DBcc
-func (cpu *CPU) decode5(opcode uint16) {
+// decode5 handles ADDQ, SUBQ, Scc, DBcc, TRAPcc
+func decode5(opcode uint16) opHandler {
 	if opcode&0x00C0 == 0x00C0 {
-		// Scc or DBcc
-		if opcode&0x0038 == 0x0008 {
-			cpu.opDBcc(opcode)
-		} else {
-			cpu.opScc(opcode)
+		// Scc, DBcc or TRAPcc
+		if opcode&0x00FF >= 0x00FA && opcode&0x00FF <= 0x00FC {
+			return (*CPU).opTRAPcc
+		} else if opcode&0x0038 == 0x0008 {
+			return (*CPU).opDBcc
 		}
+		return (*CPU).opScc
 	} else {
 		// ADDQ or SUBQ
 		if opcode&0x0100 == 0 {
-			cpu.opADDQ(opcode)
-		} else {
-			cpu.opSUBQ(opcode)
+			return (*CPU).opADDQ
 		}
+		return (*CPU).opSUBQ
 	}
 }
 
 // decode6 handles Bcc, BSR, BRA
-func (cpu *CPU) decode6(opcode uint16) {
+func decode6(opcode uint16) opHandler {
 	cond := (opcode >> 8) & 0x0F
 	switch cond {
 	case 0: // BRA
-		cpu.opBRA(opcode)
+		return (*CPU).opBRA
 	case 1: // BSR
-		cpu.opBSR(opcode)
+		return (*CPU).opBSR
 	default: // Bcc
-		cpu.opBcc(opcode)
+		return (*CPU).opBcc
 	}
 }
 
 // decodeMOVEQ handles MOVEQ
-func (cpu *CPU) decodeMOVEQ(opcode uint16) {
+func decodeMOVEQ(opcode uint16) opHandler {
 	if opcode&0x0100 == 0 {
-		cpu.opMOVEQ(opcode)
-	} else {
-		cpu.opIllegal(opcode)
+		return (*CPU).opMOVEQ
 	}
+	return (*CPU).opIllegal
 }
 
-// decode8 handles OR, DIVU, SBCD
-func (cpu *CPU) decode8(opcode uint16) {
-	if opcode&0x01C0 == 0x0100 {
-		cpu.opSBCD(opcode)
+// decode8 handles OR, DIVU, SBCD, PACK, UNPK
+func decode8(opcode uint16) opHandler {
+	if opcode&0x01F0 == 0x0140 {
+		return (*CPU).opPACK
+	} else if opcode&0x01F0 == 0x0180 {
+		return (*CPU).opUNPK
+	} else if opcode&0x01C0 == 0x0100 {
+		return (*CPU).opSBCD
 	} else if opcode&0x01F0 == 0x0100 {
-		cpu.opSBCD(opcode)
-	} else if opcode&0x01C0 == 0x01C0 {
-		cpu.opDIVU(opcode)
-	} else {
-		cpu.opOR(opcode)
+		return (*CPU).opSBCD
+	} else if opcode&0x00C0 == 0x00C0 {
+		// DIVU.W and DIVS.W
+		return (*CPU).opDIVU
 	}
+	return (*CPU).opOR
 }
 
 // decode9D handles SUB, SUBA, SUBX, ADD, ADDA, ADDX
-func (cpu *CPU) decode9D(opcode uint16) {
+func decode9D(opcode uint16) opHandler {
 	isAdd := (opcode & 0xF000) == 0xD000
 
 	if opcode&0x00C0 == 0x00C0 {
 		// ADDA or SUBA
 		if isAdd {
-			cpu.opADDA(opcode)
-		} else {
-			cpu.opSUBA(opcode)
+			return (*CPU).opADDA
 		}
+		return (*CPU).opSUBA
 	} else if opcode&0x0130 == 0x0100 {
 		// ADDX or SUBX
 		if isAdd {
-			cpu.opADDX(opcode)
-		} else {
-			cpu.opSUBX(opcode)
+			return (*CPU).opADDX
 		}
+		return (*CPU).opSUBX
 	} else {
 		// ADD or SUB
 		if isAdd {
-			cpu.opADD(opcode)
-		} else {
-			cpu.opSUB(opcode)
+			return (*CPU).opADD
 		}
+		return (*CPU).opSUB
 	}
 }
 
 // decodeB handles CMP, CMPA, CMPM, EOR
-func (cpu *CPU) decodeB(opcode uint16) {
+func decodeB(opcode uint16) opHandler {
 	if opcode&0x00C0 == 0x00C0 {
 		// CMPA
-		cpu.opCMPA(opcode)
+		return (*CPU).opCMPA
 	} else if opcode&0x0138 == 0x0108 {
 		// CMPM
-		cpu.opCMPM(opcode)
+		return (*CPU).opCMPM
 	} else if opcode&0x0100 == 0x0100 {
 		// EOR
-		cpu.opEOR(opcode)
+		return (*CPU).opEOR
 	} else {
 		// CMP
-		cpu.opCMP(opcode)
+		return (*CPU).opCMP
 	}
 }
 
 // decodeC handles AND, MULU, ABCD, EXG
-func (cpu *CPU) decodeC(opcode uint16) {
+func decodeC(opcode uint16) opHandler {
 	if opcode&0x01C0 == 0x0100 {
-		cpu.opABCD(opcode)
+		return (*CPU).opABCD
 	} else if opcode&0x01F0 == 0x0100 {
-		cpu.opABCD(opcode)
-	} else if opcode&0x01C0 == 0x01C0 {
-		cpu.opMULU(opcode)
+		return (*CPU).opABCD
+	} else if opcode&0x00C0 == 0x00C0 {
+		// MULU.W and MULS.W
+		return (*CPU).opMULU
 	} else if opcode&0x0130 == 0x0100 {
-		cpu.opEXG(opcode)
-	} else {
-		cpu.opAND(opcode)
+		return (*CPU).opEXG
 	}
+	return (*CPU).opAND
 }
 
-// decodeE handles shift/rotate instructions
-func (cpu *CPU) decodeE(opcode uint16) {
-	if opcode&0x00C0 == 0x00C0 {
+// decodeE handles shift/rotate and bit field instructions
+func decodeE(opcode uint16) opHandler {
+	if opcode&0x08C0 == 0x08C0 {
+		// Bit field operations (68020+)
+		return (*CPU).opBitField
+	} else if opcode&0x00C0 == 0x00C0 {
 		// Memory shifts
-		cpu.opShiftMem(opcode)
+		return (*CPU).opShiftMem
 	} else {
 		// Register shifts
-		cpu.opShiftReg(opcode)
+		return (*CPU).opShiftReg
 	}
 }
 
 // Stub implementations for missing instructions
 func (cpu *CPU) opIllegal(opcode uint16) {
-	// TODO: Generate illegal instruction exception
-	cpu.useCycles(4)
+	// The host may emulate the opcode instead of taking the exception
+	if cpu.illegalCallback != nil && cpu.illegalCallback(opcode) {
+		cpu.useCycles(4)
+		return
+	}
+
+	// Line A and line F opcodes have their own emulator vectors
+	switch opcode >> 12 {
+	case 0xA:
+		cpu.exception(VectorLineA, cpu.ppc)
+	case 0xF:
+		cpu.exception(VectorLineF, cpu.ppc)
+	default:
+		cpu.exception(VectorIllegal, cpu.ppc)
+	}
+	cpu.useCycles(34)
 }
 
 func (cpu *CPU) opMOVEQ(opcode uint16) {
@@ -353,45 +483,98 @@ func (cpu *CPU) opMOVEQ(opcode uint16) {
 	cpu.useCycles(4)
 }
 
-func (cpu *CPU) opRESET() {
-	if cpu.resetCallback != nil {
-		cpu.resetCallback()
-	}
+func (cpu *CPU) opRESET(opcode uint16) {
+	cpu.ResetPeripherals()
 	cpu.useCycles(132)
 }
 
-func (cpu *CPU) opSTOP() {
+func (cpu *CPU) opSTOP(opcode uint16) {
 	// Read immediate data (new SR)
 	newSR := cpu.readImmediate16()
-	cpu.sr = newSR
+	cpu.setSR(newSR)
 	cpu.stopped = true
 	cpu.useCycles(4)
 }
 
-func (cpu *CPU) opRTE() {
+func (cpu *CPU) opRTE(opcode uint16) {
 	// Return from exception
-	cpu.sr = cpu.popWord()
-	cpu.pc = cpu.popLong()
-	cpu.useCycles(20)
+	if cpu.cpuType == CPU68000 {
+		newSR := cpu.popWord()
+		cpu.setPC(cpu.popLong())
+		cpu.setSR(newSR)
+		if cpu.exceptionCallback != nil {
+			cpu.exceptionCallback(cpu.lastVector, false)
+		}
+		cpu.useCycles(20)
+		return
+	}
+
+	for {
+		// The format is checked before anything is unstacked, so a format
+		// error leaves the bad frame in place for the handler
+		formatVector := uint16(cpu.readMem(cpu.a[7]+6, 16))
+		format := formatVector >> 12
+		size, ok := cpu.frameSize(format)
+		if !ok {
+			cpu.exception(VectorFormatError, cpu.ppc)
+			cpu.useCycles(34)
+			return
+		}
+
+		// Frames that record internal state (bus faults, mid-instruction)
+		// are discarded and execution resumes at the stacked PC
+		newSR := cpu.popWord()
+		pc := cpu.popLong()
+		cpu.a[7] += uint32(size - 6)
+		if format == 1 {
+			// Throwaway frame: the real frame is on the stack SR selects
+			cpu.setSR(newSR)
+			continue
+		}
+		cpu.setPC(pc)
+		cpu.setSR(newSR)
+		if cpu.exceptionCallback != nil {
+			cpu.exceptionCallback(uint32(formatVector&0x0FFF)>>2, false)
+		}
+		cpu.useCycles(20)
+		return
+	}
+}
+
+func (cpu *CPU) opTRAP(opcode uint16) {
+	// The stacked PC is that of the next instruction
+	cpu.exception(VectorTrap+uint32(opcode&0x0F), cpu.pc)
+	cpu.useCycles(34)
 }
 
-func (cpu *CPU) opTRAPV() {
+func (cpu *CPU) opTRAPV(opcode uint16) {
 	if cpu.sr&FlagV != 0 {
 		// TODO: Generate TRAPV exception
 	}
 	cpu.useCycles(4)
 }
 
-func (cpu *CPU) opRTR() {
+func (cpu *CPU) opRTR(opcode uint16) {
 	// Return and restore condition codes
 	ccr := cpu.popWord()
 	cpu.sr = (cpu.sr & 0xFF00) | (ccr & 0x00FF)
-	cpu.pc = cpu.popLong()
+	cpu.setPC(cpu.popLong())
 	cpu.useCycles(20)
 }
 
 func (cpu *CPU) opNEGX(opcode uint16) {
-	// TODO: Implement NEGX
+	size := getSize(opcode, 6)
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+
+	dest, addr := cpu.readEAModify(eaMode, eaReg, size)
+	x := uint32(cpu.sr&FlagX) >> 4
+	result := uint32(0) - dest - x
+	z := cpu.sr & FlagZ
+	cpu.setFlagsSub(0, dest, result, size)
+	cpu.setFlagsExtend(z, result, size)
+
+	cpu.writeEAModify(eaMode, eaReg, size, addr, result)
 	cpu.useCycles(4)
 }
 
@@ -400,19 +583,138 @@ func (cpu *CPU) opNBCD(opcode uint16) {
 	cpu.useCycles(6)
 }
 
+// movemCycles returns the cycles taken by a MOVEM transferring count
+// registers: a base for the addressing mode plus 4 per word or 8 per long
+func movemCycles(mode, reg, size, count int, toReg bool) int {
+	base := 8
+	switch {
+	case mode == 5, mode == 7 && (reg == 0 || reg == 2):
+		base = 12
+	case mode == 6, mode == 7 && reg == 3:
+		base = 14
+	case mode == 7 && reg == 1:
+		base = 16
+	}
+	if toReg {
+		base += 4
+	}
+	return base + count*size/4
+}
+
+// movemRegister returns a pointer to register n of a MOVEM mask, where
+// 0-7 are D0-D7 and 8-15 are A0-A7
+func (cpu *CPU) movemRegister(n int) *uint32 {
+	if n < 8 {
+		return &cpu.d[n]
+	}
+	return &cpu.a[n-8]
+}
+
 func (cpu *CPU) opMOVEMtoReg(opcode uint16) {
-	// TODO: Implement MOVEM to registers
-	cpu.useCycles(12)
+	// MOVEM format: 0100 1D00 1Sxx xxxx + register mask
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	size := 16
+	if opcode&0x0040 != 0 {
+		size = 32
+	}
+	if eaMode < 2 || eaMode == 4 || (eaMode == 7 && eaReg > 3) {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	mask := cpu.readImmediate16()
+	var addr uint32
+	if eaMode == 3 {
+		addr = cpu.a[eaReg]
+	} else {
+		addr = cpu.calcEA(eaMode, eaReg, size)
+	}
+
+	// Words are sign-extended into the whole register
+	for n := 0; n < 16; n++ {
+		if mask&(1<<uint(n)) == 0 {
+			continue
+		}
+		value := cpu.readMem(addr, size)
+		if size == 16 {
+			value = signExtend16(value)
+		}
+		*cpu.movemRegister(n) = value
+		addr += uint32(size / 8)
+	}
+	if eaMode == 3 {
+		cpu.a[eaReg] = addr
+	}
+
+	cpu.useCycles(movemCycles(eaMode, eaReg, size, bits.OnesCount16(mask), true))
 }
 
 func (cpu *CPU) opMOVEMtoMem(opcode uint16) {
-	// TODO: Implement MOVEM to memory
-	cpu.useCycles(8)
+	// MOVEM format: 0100 1D00 1Sxx xxxx + register mask
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	size := 16
+	if opcode&0x0040 != 0 {
+		size = 32
+	}
+	if eaMode < 2 || eaMode == 3 || (eaMode == 7 && eaReg > 1) {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	mask := cpu.readImmediate16()
+	if eaMode == 4 {
+		// Predecrement: the mask is reversed, bit 0 is A7 and bit 15 is D0.
+		// When the base register is in the list, the 68000 and 68010 store
+		// its initial value; the 68020 and later store the initial value
+		// decremented by the operand size.
+		addr := cpu.a[eaReg]
+		for n := 0; n < 16; n++ {
+			if mask&(1<<uint(n)) == 0 {
+				continue
+			}
+			addr -= uint32(size / 8)
+			value := *cpu.movemRegister(15 - n)
+			if 15-n == 8+eaReg && cpu.is020Plus() {
+				value -= uint32(size / 8)
+			}
+			cpu.writeMem(addr, value, size)
+		}
+		cpu.a[eaReg] = addr
+	} else {
+		addr := cpu.calcEA(eaMode, eaReg, size)
+		for n := 0; n < 16; n++ {
+			if mask&(1<<uint(n)) == 0 {
+				continue
+			}
+			cpu.writeMem(addr, *cpu.movemRegister(n), size)
+			addr += uint32(size / 8)
+		}
+	}
+
+	cpu.useCycles(movemCycles(eaMode, eaReg, size, bits.OnesCount16(mask), false))
 }
 
 func (cpu *CPU) opTAS(opcode uint16) {
-	// TODO: Implement TAS
-	cpu.useCycles(4)
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+
+	// Test and set the operand in one indivisible read-modify-write cycle
+	value, addr := cpu.readEAModify(eaMode, eaReg, 8)
+	cpu.setFlagsLogical(value, 8)
+
+	// Some buses (e.g. the Amiga's) cannot complete the write of the
+	// read-modify-write cycle; the TAS callback reports that
+	if eaMode == 0 || cpu.tasCallback == nil || cpu.tasCallback() == 0 {
+		cpu.writeEAModify(eaMode, eaReg, 8, addr, value|0x80)
+	}
+
+	if eaMode == 0 {
+		cpu.useCycles(4)
+	} else {
+		cpu.useCycles(10)
+	}
 }
 
 func (cpu *CPU) opLINK(opcode uint16) {
@@ -444,6 +746,11 @@ func (cpu *CPU) opUNLK(opcode uint16) {
 }
 
 func (cpu *CPU) opMOVEUSP(opcode uint16) {
+	if cpu.sr&FlagS == 0 {
+		cpu.privilegeViolation()
+		return
+	}
+
 	reg := int(opcode & 7)
 	if opcode&0x0008 != 0 {
 		// USP to An
@@ -455,22 +762,42 @@ func (cpu *CPU) opMOVEUSP(opcode uint16) {
 	cpu.useCycles(4)
 }
 
+func (cpu *CPU) opMOVEfromSR(opcode uint16) {
+	// Unprivileged on the 68000; the 68010 made it privileged and added
+	// MOVE from CCR for user code
+	if cpu.cpuType != CPU68000 && cpu.sr&FlagS == 0 {
+		cpu.privilegeViolation()
+		return
+	}
+
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+
+	cpu.writeEA(eaMode, eaReg, 16, uint32(cpu.sr))
+	switch {
+	case eaMode == 0 && cpu.cpuType == CPU68000:
+		cpu.useCycles(6)
+	case eaMode == 0:
+		cpu.useCycles(4)
+	default:
+		cpu.useCycles(8)
+	}
+}
+
 func (cpu *CPU) opCHK(opcode uint16) {
 	// TODO: Implement CHK
 	cpu.useCycles(10)
 }
 
 func (cpu *CPU) opBSR(opcode uint16) {
-	disp := int32(int8(opcode & 0xFF))
-	if disp == 0 {
-		disp = int32(int16(cpu.readImmediate16()))
-	}
+	base := cpu.pc
+	disp := cpu.branchDisplacement(opcode)
 
 	// Push return address
 	cpu.pushLong(cpu.pc)
 
 	// Branch
-	cpu.pc = uint32(int32(cpu.pc) + disp)
+	cpu.setPC(uint32(int32(base) + disp))
 	cpu.useCycles(18)
 }
 
@@ -484,14 +811,67 @@ func (cpu *CPU) opSBCD(opcode uint16) {
 	cpu.useCycles(6)
 }
 
+// extendOperands reads the operands of ADDX or SUBX: Dy,Dx or, with bit 3
+// set, -(Ay),-(Ax). Returns the destination address for writeEAModify.
+func (cpu *CPU) extendOperands(opcode uint16, size int) (mode, rx int, src, dest, addr uint32) {
+	rx = int((opcode >> 9) & 7)
+	ry := int(opcode & 7)
+	if opcode&0x0008 != 0 {
+		src = cpu.readEA(4, ry, size)
+		dest, addr = cpu.readEAModify(4, rx, size)
+		return 4, rx, src, dest, addr
+	}
+	return 0, rx, maskValue(cpu.d[ry], size), maskValue(cpu.d[rx], size), 0
+}
+
+// setFlagsExtend finishes the flags of ADDX, SUBX and NEGX: Z is cleared
+// by a nonzero result but never set, so that it tests the whole of a
+// multi-precision value
+func (cpu *CPU) setFlagsExtend(z uint16, result uint32, size int) {
+	if maskValue(result, size) == 0 {
+		cpu.sr = (cpu.sr &^ FlagZ) | z
+	}
+}
+
+// extendCycles returns the cycles taken by ADDX or SUBX
+func extendCycles(mode, size int) int {
+	switch {
+	case mode == 0 && size == 32:
+		return 8
+	case mode == 0:
+		return 4
+	case size == 32:
+		return 30
+	}
+	return 18
+}
+
 func (cpu *CPU) opADDX(opcode uint16) {
-	// TODO: Implement ADDX
-	cpu.useCycles(4)
+	size := getSize(opcode, 6)
+	mode, rx, src, dest, addr := cpu.extendOperands(opcode, size)
+
+	x := uint32(cpu.sr&FlagX) >> 4
+	result := dest + src + x
+	z := cpu.sr & FlagZ
+	cpu.setFlagsAdd(dest, src, result, size)
+	cpu.setFlagsExtend(z, result, size)
+
+	cpu.writeEAModify(mode, rx, size, addr, result)
+	cpu.useCycles(extendCycles(mode, size))
 }
 
 func (cpu *CPU) opSUBX(opcode uint16) {
-	// TODO: Implement SUBX
-	cpu.useCycles(4)
+	size := getSize(opcode, 6)
+	mode, rx, src, dest, addr := cpu.extendOperands(opcode, size)
+
+	x := uint32(cpu.sr&FlagX) >> 4
+	result := dest - src - x
+	z := cpu.sr & FlagZ
+	cpu.setFlagsSub(dest, src, result, size)
+	cpu.setFlagsExtend(z, result, size)
+
+	cpu.writeEAModify(mode, rx, size, addr, result)
+	cpu.useCycles(extendCycles(mode, size))
 }
 
 func (cpu *CPU) opCMPM(opcode uint16) {
@@ -504,9 +884,53 @@ func (cpu *CPU) opABCD(opcode uint16) {
 	cpu.useCycles(6)
 }
 
+// opMULU handles MULU.W and MULS.W; bit 8 selects the signed form
 func (cpu *CPU) opMULU(opcode uint16) {
-	// TODO: Implement MULU
-	cpu.useCycles(70)
+	dataReg := int((opcode >> 9) & 7)
+	eaMode := int((opcode >> 3) & 7)
+	eaReg := int(opcode & 7)
+	signed := opcode&0x0100 != 0
+	if eaMode == 1 {
+		cpu.opIllegal(opcode)
+		return
+	}
+
+	src := cpu.readEA(eaMode, eaReg, 16)
+	var result uint32
+	if signed {
+		result = uint32(int32(int16(src)) * int32(int16(cpu.d[dataReg])))
+	} else {
+		result = src * (cpu.d[dataReg] & 0xFFFF)
+	}
+	cpu.d[dataReg] = result
+	cpu.setFlagsLogical(result, 32)
+
+	cycles := cpu.mulCycles(uint16(src), signed)
+	if !cpu.is020Plus() {
+		cycles += eaTime(eaMode, eaReg)
+	}
+	cpu.useCycles(cycles)
+}
+
+// mulCycles returns the execution time of MULU.W or MULS.W. The 68000 takes
+// 38 cycles plus 2 for each 1 bit in the source (MULU) or each 01/10 bit
+// pair in the source shifted left by one (MULS); the 68010 takes a fixed
+// time. On both the effective address time is extra. The 68020 and later
+// take a fixed time that includes the operand fetch.
+func (cpu *CPU) mulCycles(src uint16, signed bool) int {
+	switch {
+	case cpu.is020Plus():
+		return 27
+	case cpu.cpuType == CPU68010 && signed:
+		return 42
+	case cpu.cpuType == CPU68010:
+		return 40
+	case signed:
+		pairs := uint32(src)<<1 ^ uint32(src)
+		return 38 + 2*bits.OnesCount16(uint16(pairs))
+	default:
+		return 38 + 2*bits.OnesCount16(src)
+	}
 }
 
 func (cpu *CPU) opShiftMem(opcode uint16) {
@@ -534,20 +958,23 @@ func (cpu *CPU) opMOVEP(opcode uint16) {
 	cpu.useCycles(16)
 }
 
+// The logical immediate to CCR operations leave the system byte alone and
+// clear CCR bits 5-7, which do not exist. All three take 20 cycles on the
+// 68000.
 func (cpu *CPU) opORItoCCR(opcode uint16) {
 	data := cpu.readImmediate16() & 0xFF
-	cpu.sr = (cpu.sr & 0xFF00) | ((cpu.sr | uint16(data)) & 0x00FF)
+	cpu.sr = (cpu.sr & 0xFF00) | ((cpu.sr | uint16(data)) & 0x001F)
 	cpu.useCycles(20)
 }
 
 func (cpu *CPU) opANDItoCCR(opcode uint16) {
 	data := cpu.readImmediate16() & 0xFF
-	cpu.sr = (cpu.sr & 0xFF00) | ((cpu.sr & uint16(data)) & 0x00FF)
+	cpu.sr = (cpu.sr & 0xFF00) | ((cpu.sr & uint16(data)) & 0x001F)
 	cpu.useCycles(20)
 }
 
 func (cpu *CPU) opEORItoCCR(opcode uint16) {
 	data := cpu.readImmediate16() & 0xFF
-	cpu.sr = (cpu.sr & 0xFF00) | ((cpu.sr ^ uint16(data)) & 0x00FF)
+	cpu.sr = (cpu.sr & 0xFF00) | ((cpu.sr ^ uint16(data)) & 0x001F)
 	cpu.useCycles(20)
 }
@@ -0,0 +1,110 @@
+package musashi
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestOpcodeTable tests that opcodes dispatch to their handlers
+func TestOpcodeTable(t *testing.T) {
+	tests := []struct {
+		opcode  uint16
+		handler opHandler
+	}{
+		{0x4E71, (*CPU).opNOP},
+		{0x4E75, (*CPU).opRTS},
+		{0x7042, (*CPU).opMOVEQ},
+		{0x4840, (*CPU).opSWAP},
+		{0x51C8, (*CPU).opDBcc},
+		{0x0668, (*CPU).opADDI},
+		{0xB0FC, (*CPU).opCMPA},
+		{0x4808, (*CPU).opLINKL},      // LINK.L A0,#d32
+		{0x4E50, (*CPU).opLINK},       // LINK A0,#d16
+		{0x48D0, (*CPU).opMOVEMtoMem}, // MOVEM.L regs,(A0)
+		{0x4CD0, (*CPU).opMOVEMtoReg}, // MOVEM.L (A0),regs
+		{0x41D0, (*CPU).opLEA},        // LEA (A0),A0
+		{0x4850, (*CPU).opPEA},        // PEA (A0)
+		{0x4E60, (*CPU).opMOVEUSP},    // MOVE A0,USP
+		{0x4E68, (*CPU).opMOVEUSP},    // MOVE USP,A0
+		{0x4A80, (*CPU).opTST},        // TST.L D0
+		{0x4A50, (*CPU).opTST},        // TST.W (A0)
+		{0xA000, (*CPU).opIllegal},
+	}
+	for _, tt := range tests {
+		if reflect.ValueOf(opcodeTable[tt.opcode]).Pointer() != reflect.ValueOf(tt.handler).Pointer() {
+			t.Errorf("Opcode 0x%04X dispatched to the wrong handler", tt.opcode)
+		}
+	}
+}
+
+// TestCoverageReport tests the opcode coverage classification
+func TestCoverageReport(t *testing.T) {
+	tests := []struct {
+		opcode uint16
+		want   string
+	}{
+		{0x4E71, CoverageImplemented}, // NOP
+		{0x7042, CoverageImplemented}, // MOVEQ #$42,D0
+		{0xC0C1, CoverageImplemented}, // MULU D1,D0
+		{0x80C1, CoverageStub},        // DIVU D1,D0
+		{0x4AFC, CoverageIllegal},     // ILLEGAL
+	}
+	for _, tt := range tests {
+		if got := OpcodeCoverage(tt.opcode); got != tt.want {
+			t.Errorf("Opcode 0x%04X: expected %s, got %s", tt.opcode, tt.want, got)
+		}
+	}
+
+	report := CoverageReport()
+	total := 0
+	for _, n := range report {
+		total += n
+	}
+	if total != 0x10000 {
+		t.Errorf("Expected 65536 opcodes in the report, got %d", total)
+	}
+	if report[CoverageImplemented] == 0 || report[CoverageStub] == 0 || report[CoverageIllegal] == 0 {
+		t.Errorf("Expected every class to be populated, got %v", report)
+	}
+}
+
+// TestDecodeUnaryGroup tests that NEGX, CLR, NEG, NOT and TST dispatch by
+// their own opcode bits rather than by the size field
+func TestDecodeUnaryGroup(t *testing.T) {
+	tests := []struct {
+		opcode  uint16
+		handler opHandler
+	}{
+		{0x4000, (*CPU).opNEGX}, // NEGX.B D0
+		{0x4280, (*CPU).opCLR},  // CLR.L D0
+		{0x4450, (*CPU).opNEG},  // NEG.W (A0)
+		{0x4680, (*CPU).opNOT},  // NOT.L D0
+		{0x4A40, (*CPU).opTST},  // TST.W D0
+		{0x4A80, (*CPU).opTST},  // TST.L D0
+	}
+	for _, tt := range tests {
+		if reflect.ValueOf(opcodeTable[tt.opcode]).Pointer() != reflect.ValueOf(tt.handler).Pointer() {
+			t.Errorf("Opcode 0x%04X dispatched to the wrong handler", tt.opcode)
+		}
+	}
+}
+
+// BenchmarkExecuteNOPLoop measures dispatch speed on a tight NOP loop
+func BenchmarkExecuteNOPLoop(b *testing.B) {
+	cpu := NewCPU(CPU68000)
+	memory := &SimpleMemory{}
+	cpu.SetMemoryHandler(memory)
+
+	memory.Write32(0, 0x00001000)
+	memory.Write32(4, 0x00000400)
+	memory.Write16(0x400, 0x4E71) // loop: NOP
+	memory.Write16(0x402, 0x4E71) // NOP
+	memory.Write16(0x404, 0x4E71) // NOP
+	memory.Write16(0x406, 0x60F8) // BRA.S loop
+
+	cpu.Reset()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cpu.Execute(1000)
+	}
+}
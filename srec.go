@@ -0,0 +1,97 @@
+package musashi
+
+// srec.go - Motorola S-record and raw binary loaders
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LoadSRecord reads Motorola S-records from r and writes the S1/S2/S3 data
+// records into memory through h.Write8. It returns the entry point from the
+// S7/S8/S9 termination record, or 0 if there is none. Header (S0) and count
+// (S5/S6) records are checked but otherwise ignored. Errors report the line
+// number of the offending record.
+func LoadSRecord(h MemoryHandler, r io.Reader) (entry uint32, err error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if len(text) < 4 || text[0] != 'S' {
+			return 0, fmt.Errorf("srec line %d: not an S-record", line)
+		}
+		recType := text[1]
+
+		raw, err := hex.DecodeString(text[2:])
+		if err != nil {
+			return 0, fmt.Errorf("srec line %d: %v", line, err)
+		}
+		if len(raw) < 1 || int(raw[0]) != len(raw)-1 {
+			return 0, fmt.Errorf("srec line %d: byte count mismatch", line)
+		}
+
+		var sum uint8
+		for _, b := range raw[:len(raw)-1] {
+			sum += b
+		}
+		if ^sum != raw[len(raw)-1] {
+			return 0, fmt.Errorf("srec line %d: checksum mismatch (expected $%02X, got $%02X)",
+				line, ^sum, raw[len(raw)-1])
+		}
+
+		// Address field width by record type
+		var addrLen int
+		switch recType {
+		case '0', '1', '5', '9':
+			addrLen = 2
+		case '2', '6', '8':
+			addrLen = 3
+		case '3', '7':
+			addrLen = 4
+		default:
+			return 0, fmt.Errorf("srec line %d: unknown record type S%c", line, recType)
+		}
+
+		body := raw[1 : len(raw)-1]
+		if len(body) < addrLen {
+			return 0, fmt.Errorf("srec line %d: record too short", line)
+		}
+		var addr uint32
+		for _, b := range body[:addrLen] {
+			addr = addr<<8 | uint32(b)
+		}
+		data := body[addrLen:]
+
+		switch recType {
+		case '1', '2', '3':
+			for i, b := range data {
+				h.Write8(addr+uint32(i), b)
+			}
+		case '7', '8', '9':
+			entry = addr
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return entry, nil
+}
+
+// LoadBinary writes a flat binary image into memory through h.Write8,
+// starting at addr. Every byte is written, so images of odd length and
+// unaligned load addresses need no special handling.
+func LoadBinary(h MemoryHandler, data []byte, addr uint32) {
+	for i, b := range data {
+		h.Write8(addr+uint32(i), b)
+	}
+}
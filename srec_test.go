@@ -0,0 +1,80 @@
+package musashi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadSRecord(t *testing.T) {
+	const srec = `S00600004844521B
+S107040070054E71C0
+S206012000DEAD4D
+S30700FF0000BEEF4C
+S5030003F9
+S9030400F8
+`
+	ram := NewRAM(16 * 1024 * 1024)
+
+	entry, err := LoadSRecord(ram, strings.NewReader(srec))
+	if err != nil {
+		t.Fatalf("LoadSRecord failed: %v", err)
+	}
+	if entry != 0x400 {
+		t.Errorf("Expected entry 0x400, got 0x%08X", entry)
+	}
+
+	checks := []struct {
+		addr uint32
+		want uint16
+	}{
+		{0x400, 0x7005},
+		{0x402, 0x4E71},
+		{0x12000, 0xDEAD},
+		{0xFF0000, 0xBEEF},
+	}
+	for _, c := range checks {
+		if got := ram.Read16(c.addr); got != c.want {
+			t.Errorf("At 0x%06X: expected 0x%04X, got 0x%04X", c.addr, c.want, got)
+		}
+	}
+}
+
+func TestLoadSRecordErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		srec string
+		want string
+	}{
+		{"bad checksum", "S00600004844521B\nS107040070054E71C1\n", "line 2: checksum"},
+		{"bad count", "S108040070054E71C0\n", "line 1: byte count"},
+		{"not hex", "S1070400700X4E71C0\n", "line 1:"},
+		{"not a record", "\n:10010000\n", "line 2: not an S-record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSRecord(NewRAM(4096), strings.NewReader(tt.srec))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadBinary(t *testing.T) {
+	ram := NewRAM(4096)
+	LoadBinary(ram, []byte{0x70, 0x05, 0x4E, 0x71, 0xAB}, 0x401)
+
+	if got := ram.Read8(0x400); got != 0 {
+		t.Errorf("Expected byte before the image untouched, got 0x%02X", got)
+	}
+	if got := ram.Read16(0x402); got != 0x054E {
+		t.Errorf("Expected 0x054E at 0x402, got 0x%04X", got)
+	}
+	if got := ram.Read8(0x405); got != 0xAB {
+		t.Errorf("Expected tail byte 0xAB at 0x405, got 0x%02X", got)
+	}
+	if got := ram.Read8(0x406); got != 0 {
+		t.Errorf("Expected byte after the image untouched, got 0x%02X", got)
+	}
+}
@@ -0,0 +1,282 @@
+package musashi
+
+// state.go - Save-state serialization
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Save-state format identification
+const (
+	stateMagic   = "M68K"
+	stateVersion = 5
+)
+
+// Errors returned by LoadState
+var (
+	ErrStateMagic   = errors.New("musashi: not a CPU save state")
+	ErrStateVersion = errors.New("musashi: unsupported save state version")
+)
+
+// cpuState is the fixed-layout body of a save state, encoded big-endian
+type cpuState struct {
+	CPUType      uint8
+	D            [8]uint32
+	A            [8]uint32
+	PC           uint32
+	PPC          uint32
+	IR           uint16
+	SR           uint16
+	USP          uint32
+	ISP          uint32
+	MSP          uint32
+	SFC          uint8
+	DFC          uint8
+	VBR          uint32
+	CACR         uint32
+	CAAR         uint32
+	IRQLevel     uint8
+	VIRQ         [8]bool
+	IRQPulsed    bool
+	Stopped      bool
+	Halted       bool
+	PrefetchAddr uint32
+	PrefetchData uint32
+	Overshoot    int32
+	FP           [8]float64
+	FPCR         uint32
+	FPSR         uint32
+	FPIAR        uint32
+	TC           uint32
+	CRP          uint64
+	SRP          uint64
+	TT0          uint32
+	TT1          uint32
+	MMUSR        uint16
+}
+
+// SaveState encodes the full architectural state of the CPU (registers,
+// stack pointers, control, FPU and MMU registers, pending interrupts and
+// run state) in a versioned binary format suitable for save-states.
+// Memory contents and callbacks are not included.
+func (cpu *CPU) SaveState() ([]byte, error) {
+	st := cpuState{
+		CPUType:      uint8(cpu.cpuType),
+		D:            cpu.d,
+		A:            cpu.a,
+		PC:           cpu.pc,
+		PPC:          cpu.ppc,
+		IR:           cpu.ir,
+		SR:           cpu.sr,
+		USP:          cpu.usp,
+		ISP:          cpu.isp,
+		MSP:          cpu.msp,
+		SFC:          cpu.sfc,
+		DFC:          cpu.dfc,
+		VBR:          cpu.vbr,
+		CACR:         cpu.cacr,
+		CAAR:         cpu.caar,
+		IRQLevel:     cpu.irqLevel,
+		VIRQ:         cpu.virq,
+		IRQPulsed:    cpu.irqPulsed,
+		Stopped:      cpu.stopped,
+		Halted:       cpu.halted,
+		PrefetchAddr: cpu.prefetchAddr,
+		PrefetchData: cpu.prefetchData,
+		Overshoot:    int32(cpu.overshoot),
+		FP:           cpu.fp,
+		FPCR:         cpu.fpcr,
+		FPSR:         cpu.fpsr,
+		FPIAR:        cpu.fpiar,
+		TC:           cpu.tc,
+		CRP:          cpu.crp,
+		SRP:          cpu.srp,
+		TT0:          cpu.tt0,
+		TT1:          cpu.tt1,
+		MMUSR:        cpu.mmusr,
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(stateMagic)
+	if err := binary.Write(&buf, binary.BigEndian, uint16(stateVersion)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, &st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadState restores CPU state previously produced by SaveState.
+// The CPU is left unchanged if the data is not a valid save state.
+func (cpu *CPU) LoadState(data []byte) error {
+	if len(data) < len(stateMagic)+2 || string(data[:len(stateMagic)]) != stateMagic {
+		return ErrStateMagic
+	}
+	r := bytes.NewReader(data[len(stateMagic):])
+
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return err
+	}
+	if version != stateVersion {
+		return fmt.Errorf("%w: %d", ErrStateVersion, version)
+	}
+
+	var st cpuState
+	if err := binary.Read(r, binary.BigEndian, &st); err != nil {
+		return fmt.Errorf("musashi: truncated save state: %w", err)
+	}
+
+	if CPUType(st.CPUType) != cpu.cpuType {
+		cpu.SetCPUType(CPUType(st.CPUType))
+	}
+	cpu.d = st.D
+	cpu.a = st.A
+	cpu.pc = st.PC
+	cpu.ppc = st.PPC
+	cpu.ir = st.IR
+	cpu.sr = st.SR
+	cpu.usp = st.USP
+	cpu.isp = st.ISP
+	cpu.msp = st.MSP
+	cpu.sfc = st.SFC
+	cpu.dfc = st.DFC
+	cpu.vbr = st.VBR
+	cpu.cacr = st.CACR
+	cpu.caar = st.CAAR
+	cpu.irqLevel = st.IRQLevel
+	cpu.virq = st.VIRQ
+	cpu.irqPulsed = st.IRQPulsed
+	cpu.stopped = st.Stopped
+	cpu.halted = st.Halted
+	cpu.prefetchAddr = st.PrefetchAddr
+	cpu.prefetchData = st.PrefetchData
+	cpu.prefetchValid = false
+	cpu.overshoot = int(st.Overshoot)
+	cpu.fp = st.FP
+	cpu.fpcr = st.FPCR
+	cpu.fpsr = st.FPSR
+	cpu.fpiar = st.FPIAR
+	cpu.tc = st.TC
+	cpu.crp = st.CRP
+	cpu.srp = st.SRP
+	cpu.tt0 = st.TT0
+	cpu.tt1 = st.TT1
+	cpu.mmusr = st.MMUSR
+	return nil
+}
+
+// contextJSON is the JSON representation of a Context
+type contextJSON struct {
+	CPUType string    `json:"cpu_type"`
+	D       [8]uint32 `json:"d"`
+	A       [8]uint32 `json:"a"`
+	PC      uint32    `json:"pc"`
+	SR      uint16    `json:"sr"`
+	USP     uint32    `json:"usp"`
+	ISP     uint32    `json:"isp"`
+	MSP     uint32    `json:"msp"`
+	SFC     uint8     `json:"sfc"`
+	DFC     uint8     `json:"dfc"`
+	VBR     uint32    `json:"vbr"`
+	CACR    uint32    `json:"cacr"`
+	CAAR    uint32    `json:"caar"`
+}
+
+// MarshalJSON encodes the context as a JSON object, so that saved contexts
+// can be inspected and compared outside the package
+func (c *Context) MarshalJSON() ([]byte, error) {
+	return json.Marshal(contextJSON{
+		CPUType: c.cpuType.String(),
+		D:       c.d,
+		A:       c.a,
+		PC:      c.pc,
+		SR:      c.sr,
+		USP:     c.usp,
+		ISP:     c.isp,
+		MSP:     c.msp,
+		SFC:     c.sfc,
+		DFC:     c.dfc,
+		VBR:     c.vbr,
+		CACR:    c.cacr,
+		CAAR:    c.caar,
+	})
+}
+
+// UnmarshalJSON decodes a context produced by MarshalJSON
+func (c *Context) UnmarshalJSON(data []byte) error {
+	var cj contextJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+
+	cpuType, err := parseCPUType(cj.CPUType)
+	if err != nil {
+		return err
+	}
+
+	*c = Context{
+		cpuType: cpuType,
+		d:       cj.D,
+		a:       cj.A,
+		pc:      cj.PC,
+		sr:      cj.SR,
+		usp:     cj.USP,
+		isp:     cj.ISP,
+		msp:     cj.MSP,
+		sfc:     cj.SFC,
+		dfc:     cj.DFC,
+		vbr:     cj.VBR,
+		cacr:    cj.CACR,
+		caar:    cj.CAAR,
+	}
+	return nil
+}
+
+// DiffContext compares two contexts and returns one line per register
+// that differs, such as "D0: 0x00001234 != 0x00005678", in register order.
+// It returns nil when the contexts are equal.
+func DiffContext(a, b *Context) []string {
+	var diffs []string
+	diff := func(name string, x, y uint32, digits int) {
+		if x != y {
+			diffs = append(diffs, fmt.Sprintf("%s: 0x%0*X != 0x%0*X", name, digits, x, digits, y))
+		}
+	}
+
+	if a.cpuType != b.cpuType {
+		diffs = append(diffs, fmt.Sprintf("CPU: %s != %s", a.cpuType, b.cpuType))
+	}
+	for i := 0; i < 8; i++ {
+		diff(fmt.Sprintf("D%d", i), a.d[i], b.d[i], 8)
+	}
+	for i := 0; i < 8; i++ {
+		diff(fmt.Sprintf("A%d", i), a.a[i], b.a[i], 8)
+	}
+	diff("PC", a.pc, b.pc, 8)
+	diff("SR", uint32(a.sr), uint32(b.sr), 4)
+	diff("USP", a.usp, b.usp, 8)
+	diff("ISP", a.isp, b.isp, 8)
+	diff("MSP", a.msp, b.msp, 8)
+	diff("SFC", uint32(a.sfc), uint32(b.sfc), 1)
+	diff("DFC", uint32(a.dfc), uint32(b.dfc), 1)
+	diff("VBR", a.vbr, b.vbr, 8)
+	diff("CACR", a.cacr, b.cacr, 8)
+	diff("CAAR", a.caar, b.caar, 8)
+	return diffs
+}
+
+// parseCPUType returns the CPU type with the given String() name
+func parseCPUType(name string) (CPUType, error) {
+	for t := CPU68000; t <= CPUSCC68070; t++ {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return CPUInvalid, fmt.Errorf("musashi: unknown CPU type %q", name)
+}